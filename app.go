@@ -0,0 +1,303 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/command"
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/mgrs/timemgr"
+	"github.com/xhaoh94/gox/engine/types"
+	"github.com/xhaoh94/gox/engine/xevent"
+)
+
+type (
+	// App 节点实例，持有配置、网络、定位、事件和上下文，同一进程内可以运行多个App
+	App struct {
+		__init      bool
+		__start     bool
+		confPath    string
+		reloadLock  sync.Mutex
+		ctxCancelFn context.CancelFunc
+		mainModule  types.IModule
+		ready       atomic.Bool
+		updates     []timemgr.Handle
+		//main方式的消息处理队列，第一次使用时创建
+		mainLock   sync.Mutex
+		mainTasks  chan func()
+		mainHandle timemgr.Handle
+		//stopMain后关闭，等待入队的任务不再等待
+		mainDone chan struct{}
+		//已停止，不再创建队列
+		mainStopped bool
+		//当前生效的配置，热更新时整体替换
+		conf atomic.Pointer[AppConf]
+
+		Ctx context.Context
+		//启动时的配置，热更新不修改，运行中读取使用Conf()
+		Config *AppConf
+		Event  types.IEvent
+		//网络服务
+		NetWork types.INetwork
+		// 定位系统
+		Location types.ILocationSystem
+		//运维命令
+		Commands *command.Registry
+	}
+	appCtxKey struct{}
+)
+
+// NewApp 创建App
+func NewApp() *App {
+	return &App{Config: &AppConf{}, Event: xevent.New(), Commands: command.New()}
+}
+
+// Conf 当前生效的配置，热更新时替换为新的配置，返回的配置不能修改
+func (a *App) Conf() *AppConf {
+	if conf := a.conf.Load(); conf != nil {
+		return conf
+	}
+	return a.Config
+}
+
+// FromContext 获取ctx所属的App，没有时返回默认App
+func FromContext(ctx context.Context) *App {
+	if ctx != nil {
+		if a, ok := ctx.Value(appCtxKey{}).(*App); ok {
+			return a
+		}
+	}
+	return Default
+}
+
+// Init 初始化，按 YAML < 环境变量 < --set参数 的优先级加载配置并校验
+func (a *App) Init(appConfPath string) error {
+	if a.__init {
+		log.Printf("gox: 重复初始化")
+		return nil
+	}
+	conf, err := loadConf(appConfPath)
+	if err != nil {
+		return fmt.Errorf("gox: 加载配置失败 path:[%s]\n%w", appConfPath, err)
+	}
+	a.confPath = appConfPath
+	return a.InitConf(conf)
+}
+
+// InitConf 使用已有的配置初始化，不读取配置文件，配置不支持热更新
+func (a *App) InitConf(conf AppConf) error {
+	if a.__init {
+		log.Printf("gox: 重复初始化")
+		return nil
+	}
+	if err := conf.Validate(); err != nil {
+		return fmt.Errorf("gox: 配置错误\n%w", err)
+	}
+	a.__init = true
+	*a.Config = conf
+	a.conf.Store(&conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Ctx, a.ctxCancelFn = context.WithValue(ctx, appCtxKey{}, a), cancel
+	a.syncDefault()
+	if printConf {
+		conf.Dump(os.Stdout)
+	}
+	if err := logger.Init(conf.LogConfPath, conf.Development); err != nil {
+		return fmt.Errorf("gox: %w", err)
+	}
+	a.Event.Run(EventAppInit, a)
+	return nil
+}
+
+// Start 启动网络和模块，不阻塞
+func (a *App) Start() {
+	if a.__start {
+		return
+	}
+	if a.mainModule == nil {
+		logger.Fatal().Msg("gox: 没有设置主模块")
+		return
+	}
+	a.__start = true
+	conf := a.Conf()
+	logger.Info().Uint("ID", conf.AppID).Str("Type", conf.AppType).Str("Version", conf.Version).Msg("服务启动")
+	logger.Info().Msgf("[ByteOrder:%s]", conf.Network.Endian)
+	if err := timemgr.Start(conf.GetFrameRate()); err != nil {
+		a.__start = false
+		logger.Fatal().Err(err).Msg("gox: 启动失败")
+		return
+	}
+	a.NetWork.Init()
+	a.mainModule.Init(a.mainModule)
+	a.NetWork.Start()
+	a.Event.Run(EventNetworkStarted, a)
+	a.mainModule.Start(a.mainModule)
+	a.subscribeUpdates()
+	a.ready.Store(true)
+	a.Event.Run(EventModulesStarted, a)
+
+	logger.Info().Uint("ID", conf.AppID).Msg("服务启动成功")
+	go a.watchConf(a.Ctx)
+}
+
+// Run 启动并阻塞到收到退出信号，关闭后退出进程
+func (a *App) Run() {
+	defer app.Recover()
+	a.Start()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	go func() {
+		<-sigChan
+		logger.Warn().Msg("再次收到退出信号，强制退出")
+		os.Exit(1)
+	}()
+	a.Shutdown()
+	os.Exit(0)
+}
+
+// Shutdown 分阶段关闭
+func (a *App) Shutdown() {
+	if !a.__start {
+		return
+	}
+	a.__start = false
+	a.ready.Store(false)
+	timeout := a.Conf().GetShutdownTimeout()
+	logger.Info().Dur("Timeout", timeout).Msg("服务开始关闭")
+	a.Event.Run(EventShutdown, a)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	//标记下线，停止接收外部连接
+	a.NetWork.Drain(ctx)
+	//模块排空
+	a.mainModule.Drain(a.mainModule, ctx)
+	//等待处理中的消息和rpc，注销定位
+	a.NetWork.Wait(ctx)
+
+	a.ctxCancelFn()
+	for _, handle := range a.updates {
+		timemgr.Unsubscribe(handle)
+	}
+	a.updates = nil
+	a.stopMain()
+	timemgr.Stop()
+	a.mainModule.Destroy(a.mainModule)
+	a.NetWork.Destroy()
+	logger.Info().Msgf("服务退出[sid:%d]", a.Conf().AppID)
+}
+
+// IsReady 模块全部启动完成且没有开始关闭
+func (a *App) IsReady() bool {
+	return a.ready.Load()
+}
+
+// SetNetWork 设置网络模块
+func (a *App) SetNetWork(network types.INetwork) {
+	a.NetWork = network
+	a.syncDefault()
+}
+
+// SetLocation 设置定位系统
+func (a *App) SetLocation(location types.ILocationSystem) {
+	a.Location = location
+	a.syncDefault()
+}
+
+// SetModule 设置初始模块
+func (a *App) SetModule(module types.IModule) {
+	a.mainModule = module
+}
+
+// GetModule 通过模块名获取模块
+func (a *App) GetModule(name string) types.IModule {
+	if a.mainModule == nil {
+		return nil
+	}
+	var result types.IModule
+	walkModules(a.mainModule, func(mod types.IModule) bool {
+		if ModuleName(mod) == name {
+			result = mod
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// subscribeUpdates 实现了OnUpdate的模块按模块树顺序订阅帧更新
+func (a *App) subscribeUpdates() {
+	walkModules(a.mainModule, func(mod types.IModule) bool {
+		if update, ok := mod.(types.IModuleUpdate); ok {
+			a.updates = append(a.updates, timemgr.Subscribe(update.OnUpdate))
+		}
+		return true
+	})
+}
+
+var errMainStopped = errors.New("gox: App已关闭，main队列不再接收任务")
+
+// RunMain 放入帧更新协程执行，和模块OnUpdate串行，每帧只执行这一帧开始时已在队列中的任务
+// 队列长度为network.dispatch_queue_size，队列满时等待，App关闭后不再接收任务并返回错误
+func (a *App) RunMain(task func()) error {
+	a.mainLock.Lock()
+	if a.mainStopped {
+		a.mainLock.Unlock()
+		return errMainStopped
+	}
+	if a.mainTasks == nil {
+		tasks := make(chan func(), a.Conf().Network.GetDispatchQueueSize())
+		a.mainTasks = tasks
+		a.mainDone = make(chan struct{})
+		a.mainHandle = timemgr.Add(func() {
+			for n := len(tasks); n > 0; n-- {
+				runMainTask(<-tasks)
+			}
+		})
+	}
+	tasks, done := a.mainTasks, a.mainDone
+	a.mainLock.Unlock()
+	select {
+	case tasks <- task:
+		return nil
+	case <-done:
+		return errMainStopped
+	}
+}
+
+func runMainTask(task func()) {
+	defer app.Recover()
+	task()
+}
+
+// stopMain 取消main队列的帧更新，没有执行的任务不再执行，之后RunMain返回错误
+func (a *App) stopMain() {
+	a.mainLock.Lock()
+	defer a.mainLock.Unlock()
+	a.mainStopped = true
+	if a.mainTasks != nil {
+		timemgr.Unsubscribe(a.mainHandle)
+		close(a.mainDone)
+		a.mainTasks = nil
+		a.mainDone = nil
+	}
+}
+
+// syncDefault 默认App的字段同步到包级变量
+func (a *App) syncDefault() {
+	if a != Default {
+		return
+	}
+	Ctx = a.Ctx
+	Event = a.Event
+	NetWork = a.NetWork
+	Location = a.Location
+}
@@ -0,0 +1,96 @@
+package gox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/mgrs/timemgr"
+)
+
+func newTestApp(t *testing.T, queueSize int) *App {
+	t.Helper()
+	a := NewApp()
+	conf := AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:10001"}
+	conf.Network.DispatchQueueSize = queueSize
+	if err := a.InitConf(conf); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestRunMain(t *testing.T) {
+	timemgr.Start(100)
+	defer timemgr.Stop()
+	first, second := newTestApp(t, 4), newTestApp(t, 8)
+	done := make(chan int, 16)
+	for i := 0; i < 4; i++ {
+		first.RunMain(func() { done <- i })
+	}
+	second.RunMain(func() { panic("boom") })
+	second.RunMain(func() { done <- 100 })
+	if cap(first.mainTasks) != 4 || cap(second.mainTasks) != 8 {
+		t.Errorf("队列长度 = %d %d, 应为 4 8", cap(first.mainTasks), cap(second.mainTasks))
+	}
+	if first.mainHandle == second.mainHandle {
+		t.Error("每个App应该有自己的帧更新")
+	}
+	got := make(map[int]bool)
+	for len(got) < 5 {
+		select {
+		case i := <-done:
+			got[i] = true
+		case <-time.After(time.Second):
+			t.Fatalf("只执行了 %v", got)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if !got[i] {
+			t.Errorf("任务 %d 没有执行", i)
+		}
+	}
+
+	//停止后取消帧更新，队列中的任务不再执行
+	tasks := first.mainTasks
+	first.stopMain()
+	second.stopMain()
+	if first.mainTasks != nil {
+		t.Fatal("停止后队列没有释放")
+	}
+	tasks <- func() { done <- 200 }
+	select {
+	case i := <-done:
+		t.Errorf("停止后仍然执行了 %d", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRunMainStopped(t *testing.T) {
+	a := newTestApp(t, 1)
+	if err := a.RunMain(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	//取消帧更新，队列不再消费，第二个任务等待
+	timemgr.Unsubscribe(a.mainHandle)
+	blocked := make(chan error, 1)
+	go func() { blocked <- a.RunMain(func() {}) }()
+	select {
+	case err := <-blocked:
+		t.Fatalf("队列满时应该等待 %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	a.stopMain()
+	select {
+	case err := <-blocked:
+		if err != errMainStopped {
+			t.Errorf("等待中的任务返回 %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("停止后等待中的任务没有返回")
+	}
+	if err := a.RunMain(func() {}); err != errMainStopped {
+		t.Errorf("停止后返回 %v", err)
+	}
+	if a.mainTasks != nil {
+		t.Error("停止后重新创建了队列")
+	}
+}
@@ -2,6 +2,8 @@ package gox
 
 import (
 	"encoding/binary"
+	"math"
+	"runtime"
 	"time"
 )
 
@@ -14,12 +16,22 @@ type (
 		InteriorAddr string        `yaml:"interioraddr"`
 		OutsideAddr  string        `yaml:"outsideaddr"`
 		RpcAddr      string        `yaml:"rpcaddr"`
+		AdminAddr    string        `yaml:"admin_addr"`
+		ConsoleAddr  string        `yaml:"console_addr"`
 		Location     bool          `yaml:"location"`
 		LogConfPath  string        `yaml:"log_config_path"`
 		Db           DbConf        `yaml:"db"`
 		Network      NetworkConf   `yaml:"network"`
 		WebSocket    WebSocketConf `yaml:"webSocket"`
 		Etcd         EtcdConf      `yaml:"etcd"`
+		//管理接口执行命令的令牌，请求头 Authorization: Bearer <令牌>，不填时只允许本机执行
+		AdminToken string `yaml:"admin_token"`
+		//关闭时等待处理中消息的最长时间(秒) 默认10
+		ShutdownTimeout int `yaml:"shutdown_timeout"`
+		//配置文件变化检查间隔(秒) 0:只响应SIGHUP
+		ReloadInterval int `yaml:"reload_interval"`
+		//每秒更新帧数 默认30
+		FrameRate int `yaml:"frame_rate"`
 	}
 	DbConf struct {
 		Url      string `yaml:"url"`
@@ -29,10 +41,35 @@ type (
 	}
 	NetworkConf struct {
 		Endian binary.ByteOrder `yaml:"endian"`
-		//发送最大长度(websocket的话不能超过126) 默认0 不分片
+		//单个网络包的最大长度，超过时分片发送 默认0 只在超出包头上限时分片
 		SendMsgMaxLen int `yaml:"send_msg_max_len"`
-		//包体最大长度
+		//包体最大长度 默认0 不限制(uint32、varint包头默认16M)，发送时超过也会分片
 		ReadMsgMaxLen int `yaml:"read_msg_max_len"`
+		//分片重组后的最大长度 默认16M
+		FragmentMaxLen int `yaml:"fragment_max_len"`
+		//分片重组超时 默认10秒
+		FragmentTimeout time.Duration `yaml:"fragment_timeout"`
+		//压缩方式 flate(默认) gzip 或compress.Register注册的名字
+		Compress string `yaml:"compress"`
+		//消息体超过此长度时压缩 默认0 不压缩
+		CompressThreshold int `yaml:"compress_threshold"`
+		//每个Session发送队列的长度 默认1024
+		SendQueueSize int `yaml:"send_queue_size"`
+		//发送队列满时的处理 block(默认) drop_oldest drop_newest disconnect
+		//丢包后加密序号无法校验，drop_oldest drop_newest不能和encrypt同时使用
+		SendQueuePolicy SendQueuePolicy `yaml:"send_queue_policy"`
+		//消息处理方式 inline(默认) session pool main
+		Dispatch Dispatch `yaml:"dispatch"`
+		//pool方式的协程数量 默认CPU核数
+		DispatchWorkers int `yaml:"dispatch_workers"`
+		//session、pool、main方式等待处理的消息上限，满时暂停读取 默认1024
+		DispatchQueueSize int `yaml:"dispatch_queue_size"`
+		//包头长度格式 uint16(默认) uint32 varint
+		FrameHeader FrameHeader `yaml:"frame_header"`
+		//内部服务单独配置，不填的配置项使用network下的配置
+		Interior ServiceConf `yaml:"interior"`
+		//外部服务单独配置，不填的配置项使用network下的配置
+		Outside ServiceConf `yaml:"outside"`
 		//链接间隔
 		ReConnectInterval time.Duration `yaml:"reconnect_interval"`
 		//尝试链接最大次数
@@ -43,7 +80,90 @@ type (
 		ConnectTimeout time.Duration `yaml:"connect_timeout"`
 		//读超时
 		ReadTimeout time.Duration `yaml:"read_timeout"`
+		//Call、CallByCmd等待回应的超时 默认3秒，CallCtx按传入的ctx
+		RpcTimeout time.Duration `yaml:"rpc_timeout"`
+	}
+	//ServiceConf 单个服务的网络配置，同一个服务的两端需要一致
+	ServiceConf struct {
+		FrameHeader FrameHeader `yaml:"frame_header"`
+		//消息处理方式，不填使用network.dispatch
+		Dispatch Dispatch `yaml:"dispatch"`
+		//连接后X25519握手，包体使用AES-GCM加密
+		Encrypt bool `yaml:"encrypt"`
+		//TLS，只支持tcp服务，interior的配置同时用于grpc
+		Tls TlsConf `yaml:"tls"`
+		//限流
+		Limit LimitConf `yaml:"limit"`
+		//连接准入
+		Admit AdmitConf `yaml:"admit"`
+		//断线恢复，只支持outside
+		Resume ResumeConf `yaml:"resume"`
+		//心跳和空闲检查
+		Keepalive KeepaliveConf `yaml:"keepalive"`
+	}
+	//KeepaliveConf 心跳和空闲检查，两端需要一致，开发者模式下不生效
+	KeepaliveConf struct {
+		//发送心跳的一端 connector accept both none，对端需要原样回应
+		//内部服务默认connector，外部服务默认both，两端都能统计RTT
+		Initiator KeepaliveInitiator `yaml:"initiator"`
+		//心跳间隔(秒)，不填使用network.heartbeat
+		Interval int `yaml:"interval"`
+		//超过多少秒没有收到任何包时断开 0:不检查
+		Idle int `yaml:"idle"`
+	}
+	//ResumeConf 断线后保留Session，客户端在宽限时间内用令牌重连时恢复，并重发没有确认的包
+	ResumeConf struct {
+		//断线后保留的秒数 0:不开启
+		Grace int `yaml:"grace"`
+		//保留没有确认的包的数量，默认256
+		Buffer int `yaml:"buffer"`
+	}
+	//AdmitConf 接收连接的限制，只对接收的连接生效
+	AdmitConf struct {
+		//最大连接数 0:不限制
+		MaxSessions int `yaml:"max_sessions"`
+		//每个IP的最大连接数 0:不限制
+		MaxPerIP int `yaml:"max_per_ip"`
+		//连接后多少秒内没有收到有效的包时断开 0:不限制
+		FirstFrameTimeout int `yaml:"first_frame_timeout"`
+	}
+	//LimitConf 令牌桶限流，rate为每秒数量，burst为桶容量(默认等于rate)，rate为0时不限制
+	LimitConf struct {
+		//每个Session每秒的消息数
+		MsgRate  int `yaml:"msg_rate"`
+		MsgBurst int `yaml:"msg_burst"`
+		//每个Session每秒的字节数
+		ByteRate  int `yaml:"byte_rate"`
+		ByteBurst int `yaml:"byte_burst"`
+		//每个IP每秒的新连接数
+		ConnRate  int `yaml:"conn_rate"`
+		ConnBurst int `yaml:"conn_burst"`
+		//超出限制时 drop(默认) warn disconnect
+		Action LimitAction `yaml:"action"`
+	}
+	TlsConf struct {
+		CertFile string `yaml:"certfile"`
+		KeyFile  string `yaml:"keyfile"`
+		//校验对端证书的CA，不填使用系统根证书
+		CAFile string `yaml:"cafile"`
+		//双向认证，服务端要求并校验客户端证书
+		Mutual bool `yaml:"mutual"`
+		//校验服务端证书使用的名字，不填使用连接地址
+		ServerName string `yaml:"server_name"`
+		//内部连接校验对端证书的CN或DNS SAN是服务的app_type或app_type-app_id，只支持interior
+		VerifyEntity bool `yaml:"verify_entity"`
 	}
+	//FrameHeader 包头长度字段格式
+	FrameHeader string
+	//SendQueuePolicy 发送队列满时的处理方式
+	SendQueuePolicy string
+	//Dispatch 消息处理方式
+	Dispatch string
+	//LimitAction 超出限流时的处理方式
+	LimitAction string
+	//KeepaliveInitiator 发送心跳的一端
+	KeepaliveInitiator string
+
 	WebSocketConf struct {
 		WebSocketMessageType int    `yaml:"ws_message_type"`
 		WebSocketPattern     string `yaml:"ws_pattern"`
@@ -62,10 +182,30 @@ type (
 func (ut *NetworkConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type alias struct {
 		Endian string `yaml:"endian"`
-		//发送最大长度(websocket的话不能超过126) 默认0 不分片
+		//单个网络包的最大长度
 		SendMsgMaxLen int `yaml:"send_msg_max_len"`
 		//包体最大长度
 		ReadMsgMaxLen int `yaml:"read_msg_max_len"`
+		//分片重组后的最大长度
+		FragmentMaxLen int `yaml:"fragment_max_len"`
+		//分片重组超时
+		FragmentTimeout int `yaml:"fragment_timeout"`
+		//压缩方式
+		Compress string `yaml:"compress"`
+		//压缩阈值
+		CompressThreshold int `yaml:"compress_threshold"`
+		//发送队列长度
+		SendQueueSize int `yaml:"send_queue_size"`
+		//发送队列满时的处理
+		SendQueuePolicy SendQueuePolicy `yaml:"send_queue_policy"`
+		//消息处理方式
+		Dispatch          Dispatch `yaml:"dispatch"`
+		DispatchWorkers   int      `yaml:"dispatch_workers"`
+		DispatchQueueSize int      `yaml:"dispatch_queue_size"`
+		//包头长度格式
+		FrameHeader FrameHeader `yaml:"frame_header"`
+		Interior    ServiceConf `yaml:"interior"`
+		Outside     ServiceConf `yaml:"outside"`
 		//链接间隔
 		ReConnectInterval int `yaml:"reconnect_interval"`
 		//尝试链接最大次数
@@ -76,6 +216,8 @@ func (ut *NetworkConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		ConnectTimeout int `yaml:"connect_timeout"`
 		//ReadTimeout 读超时
 		ReadTimeout int `yaml:"read_timeout"`
+		//RPC超时
+		RpcTimeout int `yaml:"rpc_timeout"`
 	}
 
 	var tmp alias
@@ -91,6 +233,26 @@ func (ut *NetworkConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	ut.SendMsgMaxLen = tmp.SendMsgMaxLen
 	ut.ReadMsgMaxLen = tmp.ReadMsgMaxLen
+	ut.Compress = tmp.Compress
+	ut.CompressThreshold = tmp.CompressThreshold
+	ut.SendQueueSize = tmp.SendQueueSize
+	ut.SendQueuePolicy = tmp.SendQueuePolicy
+	ut.Dispatch = tmp.Dispatch
+	ut.DispatchWorkers = tmp.DispatchWorkers
+	ut.DispatchQueueSize = tmp.DispatchQueueSize
+	if tmp.FragmentMaxLen > 0 {
+		ut.FragmentMaxLen = tmp.FragmentMaxLen
+	} else {
+		ut.FragmentMaxLen = defaultFragmentMaxLen
+	}
+	if tmp.FragmentTimeout > 0 {
+		ut.FragmentTimeout = time.Duration(tmp.FragmentTimeout) * time.Second
+	} else {
+		ut.FragmentTimeout = 10 * time.Second
+	}
+	ut.FrameHeader = tmp.FrameHeader
+	ut.Interior = tmp.Interior
+	ut.Outside = tmp.Outside
 	ut.ReConnectInterval = time.Duration(tmp.ReConnectInterval) * time.Second
 	ut.ReConnectMax = tmp.ReConnectMax
 
@@ -107,9 +269,282 @@ func (ut *NetworkConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 
 	ut.ReadTimeout = time.Duration(tmp.ReadTimeout) * time.Second
+	if tmp.RpcTimeout > 0 {
+		ut.RpcTimeout = time.Duration(tmp.RpcTimeout) * time.Second
+	} else {
+		ut.RpcTimeout = defaultRpcTimeout
+	}
 	return nil
 }
 
+const (
+	//2字节长度，包体最大65535，默认
+	FrameHeaderUint16 FrameHeader = "uint16"
+	//4字节长度
+	FrameHeaderUint32 FrameHeader = "uint32"
+	//变长长度(1~5字节)，小包更省流量
+	FrameHeaderVarint FrameHeader = "varint"
+
+	//uint32、varint包头没有配置read_msg_max_len时的读取上限
+	defaultWideReadMsgMaxLen = 16 << 20
+	//分片重组的默认上限
+	defaultFragmentMaxLen = 16 << 20
+	//发送队列的默认长度
+	defaultSendQueueSize = 1024
+	//RPC的默认超时
+	defaultRpcTimeout = 3 * time.Second
+
+	//等待队列有空位，默认
+	SendQueueBlock SendQueuePolicy = "block"
+	//丢弃队列中最早的包
+	SendQueueDropOldest SendQueuePolicy = "drop_oldest"
+	//丢弃要发送的包
+	SendQueueDropNewest SendQueuePolicy = "drop_newest"
+	//断开连接
+	SendQueueDisconnect SendQueuePolicy = "disconnect"
+
+	//在读取协程中直接处理，默认
+	DispatchInline Dispatch = "inline"
+	//每个Session一个处理协程，按接收顺序处理，不阻塞读取
+	DispatchSession Dispatch = "session"
+	//共享的处理协程池，不保证顺序
+	DispatchPool Dispatch = "pool"
+	//在帧更新协程中按顺序处理，和模块OnUpdate在同一个协程，不需要加锁
+	DispatchMain Dispatch = "main"
+
+	//消息处理队列的默认长度
+	defaultDispatchQueueSize = 1024
+
+	//丢弃消息或拒绝连接，默认
+	LimitDrop LimitAction = "drop"
+	//只输出警告，继续处理
+	LimitWarn LimitAction = "warn"
+	//断开连接
+	LimitDisconnect LimitAction = "disconnect"
+
+	//连接者发送，内部服务默认
+	KeepaliveConnector KeepaliveInitiator = "connector"
+	//接收者发送
+	KeepaliveAccept KeepaliveInitiator = "accept"
+	//两端都发送，外部服务默认
+	KeepaliveBoth KeepaliveInitiator = "both"
+	//都不发送
+	KeepaliveNone KeepaliveInitiator = "none"
+)
+
+// Valid 是否是支持的包头格式，空表示默认
+func (header FrameHeader) Valid() bool {
+	switch header {
+	case "", FrameHeaderUint16, FrameHeaderUint32, FrameHeaderVarint:
+		return true
+	}
+	return false
+}
+
+// MaxLen 包头能表示的最大包体长度
+func (header FrameHeader) MaxLen() int {
+	switch header {
+	case FrameHeaderUint32, FrameHeaderVarint:
+		return math.MaxUint32
+	default:
+		return math.MaxUint16
+	}
+}
+
+// Valid 是否是支持的发送队列策略，空表示默认
+func (policy SendQueuePolicy) Valid() bool {
+	switch policy {
+	case "", SendQueueBlock, SendQueueDropOldest, SendQueueDropNewest, SendQueueDisconnect:
+		return true
+	}
+	return false
+}
+
+// Valid 是否是支持的消息处理方式，空表示默认
+func (dispatch Dispatch) Valid() bool {
+	switch dispatch {
+	case "", DispatchInline, DispatchSession, DispatchPool, DispatchMain:
+		return true
+	}
+	return false
+}
+
+// Valid 是否是支持的限流处理方式，空表示默认
+func (action LimitAction) Valid() bool {
+	switch action {
+	case "", LimitDrop, LimitWarn, LimitDisconnect:
+		return true
+	}
+	return false
+}
+
+// GetAction 超出限制时的处理方式
+func (conf LimitConf) GetAction() LimitAction {
+	if conf.Action == "" {
+		return LimitDrop
+	}
+	return conf.Action
+}
+
+// GetFirstFrameTimeout 等待第一个有效包的时间，0为不限制
+func (conf AdmitConf) GetFirstFrameTimeout() time.Duration {
+	return time.Duration(conf.FirstFrameTimeout) * time.Second
+}
+
+// Valid 是否是支持的心跳发送方，空表示默认
+func (initiator KeepaliveInitiator) Valid() bool {
+	switch initiator {
+	case "", KeepaliveConnector, KeepaliveAccept, KeepaliveBoth, KeepaliveNone:
+		return true
+	}
+	return false
+}
+
+// Sends 这一端是否发送心跳
+func (initiator KeepaliveInitiator) Sends(connector bool) bool {
+	switch initiator {
+	case KeepaliveAccept:
+		return !connector
+	case KeepaliveBoth:
+		return true
+	case KeepaliveNone:
+		return false
+	default:
+		return connector
+	}
+}
+
+// GetInterval 心跳间隔，没有配置时使用heartbeat
+func (conf KeepaliveConf) GetInterval(heartbeat time.Duration) time.Duration {
+	if conf.Interval > 0 {
+		return time.Duration(conf.Interval) * time.Second
+	}
+	return heartbeat
+}
+
+// GetIdle 空闲断开的时间，0为不检查
+func (conf KeepaliveConf) GetIdle() time.Duration {
+	return time.Duration(conf.Idle) * time.Second
+}
+
+// GetGrace 断线后保留的时间，0为不开启
+func (conf ResumeConf) GetGrace() time.Duration {
+	return time.Duration(conf.Grace) * time.Second
+}
+
+// GetBuffer 保留没有确认的包的数量
+func (conf ResumeConf) GetBuffer() int {
+	if conf.Buffer <= 0 {
+		return 256
+	}
+	return conf.Buffer
+}
+
+// ServiceConf 获取服务的网络配置，服务没有配置的项使用network下的配置
+func (conf *NetworkConf) ServiceConf(interior bool) ServiceConf {
+	serviceConf := conf.Outside
+	if interior {
+		serviceConf = conf.Interior
+	}
+	if serviceConf.FrameHeader == "" {
+		serviceConf.FrameHeader = conf.FrameHeader
+	}
+	if serviceConf.FrameHeader == "" {
+		serviceConf.FrameHeader = FrameHeaderUint16
+	}
+	if serviceConf.Dispatch == "" {
+		serviceConf.Dispatch = conf.Dispatch
+	}
+	if serviceConf.Dispatch == "" {
+		serviceConf.Dispatch = DispatchInline
+	}
+	//只有发送心跳的一端能统计RTT，外部服务的接收端也发送
+	if serviceConf.Keepalive.Initiator == "" && !interior {
+		serviceConf.Keepalive.Initiator = KeepaliveBoth
+	}
+	return serviceConf
+}
+
+// GetReadMsgMaxLen 读取包体的最大长度，0为不限制
+func (conf *NetworkConf) GetReadMsgMaxLen(header FrameHeader) int {
+	if conf.ReadMsgMaxLen > 0 {
+		return conf.ReadMsgMaxLen
+	}
+	if header.MaxLen() > math.MaxUint16 {
+		return defaultWideReadMsgMaxLen
+	}
+	return 0
+}
+
+// GetFrameMaxLen 单个网络包的最大长度，超过时分片发送
+// 不超过包头上限和读取上限，保证对端能读取(对端需要使用相同的配置)
+func (conf *NetworkConf) GetFrameMaxLen(header FrameHeader) int {
+	frameMax := header.MaxLen()
+	if readMax := conf.GetReadMsgMaxLen(header); readMax > 0 && readMax < frameMax {
+		frameMax = readMax
+	}
+	if conf.SendMsgMaxLen > 0 && conf.SendMsgMaxLen < frameMax {
+		frameMax = conf.SendMsgMaxLen
+	}
+	return frameMax
+}
+
+// GetFragmentMaxLen 分片重组后的最大长度
+func (conf *NetworkConf) GetFragmentMaxLen() int {
+	if conf.FragmentMaxLen > 0 {
+		return conf.FragmentMaxLen
+	}
+	return defaultFragmentMaxLen
+}
+
+// GetFragmentTimeout 分片重组超时
+func (conf *NetworkConf) GetFragmentTimeout() time.Duration {
+	if conf.FragmentTimeout > 0 {
+		return conf.FragmentTimeout
+	}
+	return 10 * time.Second
+}
+
+// GetRpcTimeout Call、CallByCmd等待回应的超时
+func (conf *NetworkConf) GetRpcTimeout() time.Duration {
+	if conf.RpcTimeout > 0 {
+		return conf.RpcTimeout
+	}
+	return defaultRpcTimeout
+}
+
+// GetSendQueueSize 每个Session发送队列的长度
+func (conf *NetworkConf) GetSendQueueSize() int {
+	if conf.SendQueueSize > 0 {
+		return conf.SendQueueSize
+	}
+	return defaultSendQueueSize
+}
+
+// GetSendQueuePolicy 发送队列满时的处理方式
+func (conf *NetworkConf) GetSendQueuePolicy() SendQueuePolicy {
+	if conf.SendQueuePolicy == "" {
+		return SendQueueBlock
+	}
+	return conf.SendQueuePolicy
+}
+
+// GetDispatchWorkers pool方式的协程数量
+func (conf *NetworkConf) GetDispatchWorkers() int {
+	if conf.DispatchWorkers > 0 {
+		return conf.DispatchWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// GetDispatchQueueSize 等待处理的消息上限
+func (conf *NetworkConf) GetDispatchQueueSize() int {
+	if conf.DispatchQueueSize > 0 {
+		return conf.DispatchQueueSize
+	}
+	return defaultDispatchQueueSize
+}
+
 func (ut *EtcdConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type alias struct {
 		EtcdList      []string `yaml:"etcd_list"`
@@ -132,3 +567,19 @@ func (ut *EtcdConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	ut.EtcdLeaseTime = tmp.EtcdLeaseTime
 	return nil
 }
+
+// GetFrameRate 每秒更新帧数
+func (conf *AppConf) GetFrameRate() int {
+	if conf.FrameRate > 0 {
+		return conf.FrameRate
+	}
+	return 30
+}
+
+// GetShutdownTimeout 关闭时的排空等待时间
+func (conf *AppConf) GetShutdownTimeout() time.Duration {
+	if conf.ShutdownTimeout > 0 {
+		return time.Duration(conf.ShutdownTimeout) * time.Second
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,177 @@
+package gox
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFrameMaxLen(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   NetworkConf
+		header FrameHeader
+		want   int
+	}{
+		{"uint16默认", NetworkConf{}, FrameHeaderUint16, math.MaxUint16},
+		{"uint32使用默认读取上限", NetworkConf{}, FrameHeaderUint32, defaultWideReadMsgMaxLen},
+		{"varint使用默认读取上限", NetworkConf{}, FrameHeaderVarint, defaultWideReadMsgMaxLen},
+		{"读取上限", NetworkConf{ReadMsgMaxLen: 4096}, FrameHeaderUint32, 4096},
+		{"读取上限大于包头上限", NetworkConf{ReadMsgMaxLen: 1 << 20}, FrameHeaderUint16, math.MaxUint16},
+		{"发送上限", NetworkConf{SendMsgMaxLen: 1024, ReadMsgMaxLen: 4096}, FrameHeaderUint32, 1024},
+		{"发送上限大于读取上限", NetworkConf{SendMsgMaxLen: 8192, ReadMsgMaxLen: 4096}, FrameHeaderUint16, 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.conf.GetFrameMaxLen(tt.header); got != tt.want {
+				t.Errorf("GetFrameMaxLen = %d, 应为 %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceConfKeepalive(t *testing.T) {
+	tests := []struct {
+		name      string
+		initiator KeepaliveInitiator
+		interior  bool
+		want      KeepaliveInitiator
+	}{
+		{"内部服务默认", "", true, KeepaliveConnector},
+		{"外部服务默认", "", false, KeepaliveBoth},
+		{"内部服务配置", KeepaliveAccept, true, KeepaliveAccept},
+		{"外部服务配置", KeepaliveConnector, false, KeepaliveConnector},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := NetworkConf{}
+			conf.Interior.Keepalive.Initiator = tt.initiator
+			conf.Outside.Keepalive.Initiator = tt.initiator
+			got := conf.ServiceConf(tt.interior).Keepalive.Initiator
+			if got.Sends(true) != tt.want.Sends(true) || got.Sends(false) != tt.want.Sends(false) {
+				t.Errorf("Initiator = %q, 应为 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSendQueuePolicy(t *testing.T) {
+	tests := []struct {
+		policy  SendQueuePolicy
+		encrypt bool
+		err     bool
+	}{
+		{"", true, false},
+		{SendQueueBlock, true, false},
+		{SendQueueDisconnect, true, false},
+		{SendQueueDropOldest, false, false},
+		{SendQueueDropNewest, false, false},
+		{SendQueueDropOldest, true, true},
+		{SendQueueDropNewest, true, true},
+		{"drop", false, true},
+	}
+	for _, tt := range tests {
+		for _, interior := range []bool{true, false} {
+			conf := AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:10001"}
+			conf.Network.SendQueuePolicy = tt.policy
+			if interior {
+				conf.Network.Interior.Encrypt = tt.encrypt
+			} else {
+				conf.Network.Outside.Encrypt = tt.encrypt
+			}
+			if err := conf.Validate(); (err != nil) != tt.err {
+				t.Errorf("policy = %q encrypt = %v interior = %v, err = %v", tt.policy, tt.encrypt, interior, err)
+			}
+		}
+	}
+}
+
+func TestValidateVerifyEntity(t *testing.T) {
+	tlsConf := TlsConf{CertFile: "node.pem", KeyFile: "node.key", VerifyEntity: true}
+	tests := []struct {
+		name  string
+		setup func(conf *NetworkConf)
+		err   bool
+	}{
+		{"内部服务", func(conf *NetworkConf) { conf.Interior.Tls = tlsConf }, false},
+		{"没有开启TLS", func(conf *NetworkConf) { conf.Interior.Tls = TlsConf{VerifyEntity: true} }, true},
+		{"外部服务", func(conf *NetworkConf) { conf.Outside.Tls = tlsConf }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:10001"}
+			tt.setup(&conf.Network)
+			if err := conf.Validate(); (err != nil) != tt.err {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
+
+// withSetConfs 临时设置--set参数
+func withSetConfs(t *testing.T, sets ...string) {
+	old := setConfs
+	setConfs = sets
+	t.Cleanup(func() { setConfs = old })
+}
+
+func writeConf(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfPrecedence(t *testing.T) {
+	path := writeConf(t, "app_id: 1\napp_type: gate\ninterioraddr: \"127.0.0.1:10001\"\nnetwork:\n    heartbeat: 30\n    rpc_timeout: 5\n    connect_timeout: 4\n")
+	t.Setenv(EnvName("network.heartbeat"), "20")
+	t.Setenv(EnvName("network.rpc_timeout"), "7")
+	t.Setenv(EnvName("etcd.etcd_list"), "127.0.0.1:2379, 127.0.0.1:2380,")
+	withSetConfs(t, "network.rpc_timeout=9", "app_type=login")
+
+	conf, err := loadConf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"只有YAML", conf.Network.ConnectTimeout, 4 * time.Second},
+		{"环境变量覆盖YAML", conf.Network.Heartbeat, 20 * time.Second},
+		{"--set覆盖环境变量", conf.Network.RpcTimeout, 9 * time.Second},
+		{"--set覆盖YAML", conf.AppType, "login"},
+		{"环境变量逗号分隔列表", strings.Join(conf.Etcd.EtcdList, ";"), "127.0.0.1:2379;127.0.0.1:2380"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, 应为 %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfErrors(t *testing.T) {
+	path := writeConf(t, "app_id: 1\napp_type: gate\ninterioraddr: \"127.0.0.1:10001\"\n")
+	t.Setenv(EnvName("network.heartbeat"), "[")
+	withSetConfs(t, "network.unknown=1", "network.read_msg_max_len=10")
+
+	_, err := loadConf(path)
+	if err == nil {
+		t.Fatal("应返回错误")
+	}
+	//所有错误一起返回
+	for _, want := range []string{
+		"环境变量[GOX_NETWORK_HEARTBEAT]",
+		"--set[network.unknown]: 没有此配置项",
+		"read_msg_max_len",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, 应包含 %s", err, want)
+		}
+	}
+}
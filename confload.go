@@ -0,0 +1,339 @@
+package gox
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const envPrefix = "GOX_"
+
+type (
+	//confSets --set参数，可重复
+	confSets []string
+	//confField 配置项
+	confField struct {
+		//配置路径 例:network.heartbeat
+		path  string
+		kind  reflect.Kind
+		index []int
+	}
+)
+
+var (
+	setConfs  confSets
+	printConf bool
+)
+
+func (sets *confSets) String() string {
+	return strings.Join(*sets, ",")
+}
+
+func (sets *confSets) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("格式错误[%s] 需要 key=value", v)
+	}
+	*sets = append(*sets, v)
+	return nil
+}
+
+// RegisterFlags 注册配置相关的命令行参数，需要在flag.Parse之前调用
+//
+//	--set network.heartbeat=10  覆盖配置项，可重复
+//	--print-config              打印生效的配置
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(&setConfs, "set", "覆盖配置项 key=value (例: network.heartbeat=10)，可重复")
+	fs.BoolVar(&printConf, "print-config", false, "打印生效的配置")
+}
+
+// EnvName 配置路径对应的环境变量名 例:network.heartbeat => GOX_NETWORK_HEARTBEAT
+func EnvName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// loadConf 加载配置：YAML < 环境变量 < --set参数，最后校验
+func loadConf(appConfPath string) (AppConf, error) {
+	appCfg := AppConf{}
+	raw := make(map[string]any)
+	if appConfPath != "" {
+		bytes, err := os.ReadFile(appConfPath)
+		if err != nil {
+			return appCfg, err
+		}
+		if err := yaml.Unmarshal(bytes, &raw); err != nil {
+			return appCfg, err
+		}
+		if raw == nil {
+			raw = make(map[string]any)
+		}
+	}
+
+	var errs []error
+	fields := confFields()
+	pathToField := make(map[string]confField, len(fields))
+	for _, field := range fields {
+		pathToField[field.path] = field
+		if v, ok := os.LookupEnv(EnvName(field.path)); ok {
+			if err := setConfValue(raw, field, v); err != nil {
+				errs = append(errs, fmt.Errorf("环境变量[%s]: %w", EnvName(field.path), err))
+			}
+		}
+	}
+	for _, kv := range setConfs {
+		k, v, _ := strings.Cut(kv, "=")
+		field, ok := pathToField[strings.TrimSpace(k)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("--set[%s]: 没有此配置项", k))
+			continue
+		}
+		if err := setConfValue(raw, field, v); err != nil {
+			errs = append(errs, fmt.Errorf("--set[%s]: %w", k, err))
+		}
+	}
+
+	bytes, err := yaml.Marshal(raw)
+	if err != nil {
+		return appCfg, errors.Join(append(errs, err)...)
+	}
+	if err := yaml.Unmarshal(bytes, &appCfg); err != nil {
+		return appCfg, errors.Join(append(errs, err)...)
+	}
+	errs = append(errs, appCfg.Validate())
+	return appCfg, errors.Join(errs...)
+}
+
+// setConfValue 把字符串值按配置项类型写入原始配置
+func setConfValue(raw map[string]any, field confField, v string) error {
+	var value any
+	switch field.kind {
+	case reflect.String, reflect.Interface:
+		value = v
+	case reflect.Slice:
+		list := make([]any, 0)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		value = list
+	default:
+		if err := yaml.Unmarshal([]byte(v), &value); err != nil {
+			return err
+		}
+	}
+	keys := strings.Split(field.path, ".")
+	node := raw
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := node[key].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			node[key] = child
+		}
+		node = child
+	}
+	node[keys[len(keys)-1]] = value
+	return nil
+}
+
+// confFields 获取所有配置项
+func confFields() []confField {
+	fields := make([]confField, 0)
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			path := tag
+			if prefix != "" {
+				path = prefix + "." + tag
+			}
+			fieldIndex := append(append([]int(nil), index...), i)
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, path, fieldIndex)
+				continue
+			}
+			fields = append(fields, confField{path: path, kind: f.Type.Kind(), index: fieldIndex})
+		}
+	}
+	walk(reflect.TypeOf(AppConf{}), "", nil)
+	return fields
+}
+
+// DumpConfig 打印默认App生效的配置，敏感配置项会被隐藏
+func DumpConfig(w io.Writer) {
+	Config.Dump(w)
+}
+
+// Dump 打印配置，敏感配置项会被隐藏
+func (conf *AppConf) Dump(w io.Writer) {
+	value := reflect.ValueOf(*conf)
+	for _, field := range confFields() {
+		v := value.FieldByIndex(field.index).Interface()
+		if (strings.Contains(field.path, "password") || strings.Contains(field.path, "token")) && v != "" {
+			v = "******"
+		}
+		fmt.Fprintf(w, "%s = %v  (%s)\n", field.path, v, EnvName(field.path))
+	}
+}
+
+// Validate 校验配置，返回所有错误
+func (conf *AppConf) Validate() error {
+	var errs []error
+	if conf.AppID == 0 {
+		errs = append(errs, errors.New("app_id: 必须大于0"))
+	}
+	if conf.AppType == "" {
+		errs = append(errs, errors.New("app_type: 不能为空"))
+	}
+	checkAddr := func(key string, addr string) {
+		if addr == "" {
+			return
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: 地址格式错误 %w", key, err))
+		}
+	}
+	if conf.InteriorAddr == "" {
+		errs = append(errs, errors.New("interioraddr: 不能为空"))
+	}
+	checkAddr("interioraddr", conf.InteriorAddr)
+	checkAddr("outsideaddr", conf.OutsideAddr)
+	checkAddr("rpcaddr", conf.RpcAddr)
+	checkAddr("admin_addr", conf.AdminAddr)
+	checkAddr("console_addr", conf.ConsoleAddr)
+	if conf.Network.SendMsgMaxLen < 0 || (conf.Network.SendMsgMaxLen > 0 && conf.Network.SendMsgMaxLen < 64) {
+		errs = append(errs, errors.New("network.send_msg_max_len: 需要为0或不小于64"))
+	}
+	if conf.Network.FragmentMaxLen < 0 {
+		errs = append(errs, errors.New("network.fragment_max_len: 不能小于0"))
+	}
+	if conf.Network.CompressThreshold < 0 {
+		errs = append(errs, errors.New("network.compress_threshold: 不能小于0"))
+	}
+	if conf.Network.SendQueueSize < 0 {
+		errs = append(errs, errors.New("network.send_queue_size: 不能小于0"))
+	}
+	if !conf.Network.SendQueuePolicy.Valid() {
+		errs = append(errs, errors.New("network.send_queue_policy: 只支持block、drop_oldest、drop_newest、disconnect"))
+	}
+	if policy := conf.Network.SendQueuePolicy; policy == SendQueueDropOldest || policy == SendQueueDropNewest {
+		//丢弃加密的包后对端校验序号失败
+		if conf.Network.Interior.Encrypt || conf.Network.Outside.Encrypt {
+			errs = append(errs, fmt.Errorf("network.send_queue_policy: %s不能和encrypt同时使用", policy))
+		}
+	}
+	if conf.Network.DispatchWorkers < 0 {
+		errs = append(errs, errors.New("network.dispatch_workers: 不能小于0"))
+	}
+	if conf.Network.DispatchQueueSize < 0 {
+		errs = append(errs, errors.New("network.dispatch_queue_size: 不能小于0"))
+	}
+	checkDispatch := func(key string, dispatch Dispatch) {
+		if !dispatch.Valid() {
+			errs = append(errs, fmt.Errorf("%s: 只支持inline、session、pool、main", key))
+		}
+	}
+	checkDispatch("network.dispatch", conf.Network.Dispatch)
+	checkDispatch("network.interior.dispatch", conf.Network.Interior.Dispatch)
+	checkDispatch("network.outside.dispatch", conf.Network.Outside.Dispatch)
+	if conf.Network.FragmentTimeout < 0 {
+		errs = append(errs, errors.New("network.fragment_timeout: 不能小于0"))
+	}
+	if conf.Network.RpcTimeout < 0 {
+		errs = append(errs, errors.New("network.rpc_timeout: 不能小于0"))
+	}
+	if conf.Network.ReadMsgMaxLen < 0 || (conf.Network.ReadMsgMaxLen > 0 && conf.Network.ReadMsgMaxLen < 64) {
+		errs = append(errs, errors.New("network.read_msg_max_len: 需要为0或不小于64"))
+	}
+	checkHeader := func(key string, header FrameHeader) {
+		if !header.Valid() {
+			errs = append(errs, fmt.Errorf("%s: 只支持uint16、uint32、varint", key))
+		}
+	}
+	checkHeader("network.frame_header", conf.Network.FrameHeader)
+	checkHeader("network.interior.frame_header", conf.Network.Interior.FrameHeader)
+	checkHeader("network.outside.frame_header", conf.Network.Outside.FrameHeader)
+	checkTls := func(key string, tlsConf TlsConf) {
+		if (tlsConf.CertFile == "") != (tlsConf.KeyFile == "") {
+			errs = append(errs, fmt.Errorf("%s.certfile/keyfile: 需要同时配置", key))
+		}
+		if tlsConf.Mutual && (tlsConf.CAFile == "" || tlsConf.CertFile == "") {
+			errs = append(errs, fmt.Errorf("%s.mutual: 双向认证需要配置cafile和certfile", key))
+		}
+	}
+	checkLimit := func(key string, limit LimitConf) {
+		if limit.MsgRate < 0 || limit.MsgBurst < 0 || limit.ByteRate < 0 || limit.ByteBurst < 0 || limit.ConnRate < 0 || limit.ConnBurst < 0 {
+			errs = append(errs, fmt.Errorf("%s: 不能小于0", key))
+		}
+		if !limit.Action.Valid() {
+			errs = append(errs, fmt.Errorf("%s.action: 只支持drop、warn、disconnect", key))
+		}
+	}
+	checkKeepalive := func(key string, keepalive KeepaliveConf) {
+		if !keepalive.Initiator.Valid() {
+			errs = append(errs, fmt.Errorf("%s.initiator: 只支持connector、accept、both、none", key))
+		}
+		if keepalive.Interval < 0 || keepalive.Idle < 0 {
+			errs = append(errs, fmt.Errorf("%s: 不能小于0", key))
+		}
+	}
+	checkKeepalive("network.interior.keepalive", conf.Network.Interior.Keepalive)
+	checkKeepalive("network.outside.keepalive", conf.Network.Outside.Keepalive)
+	checkAdmit := func(key string, admit AdmitConf) {
+		if admit.MaxSessions < 0 || admit.MaxPerIP < 0 || admit.FirstFrameTimeout < 0 {
+			errs = append(errs, fmt.Errorf("%s: 不能小于0", key))
+		}
+	}
+	checkAdmit("network.interior.admit", conf.Network.Interior.Admit)
+	checkAdmit("network.outside.admit", conf.Network.Outside.Admit)
+	if conf.Network.Interior.Resume != (ResumeConf{}) {
+		errs = append(errs, errors.New("network.interior.resume: 只支持outside"))
+	}
+	if conf.Network.Outside.Resume.Grace < 0 || conf.Network.Outside.Resume.Buffer < 0 {
+		errs = append(errs, errors.New("network.outside.resume: 不能小于0"))
+	}
+	checkLimit("network.interior.limit", conf.Network.Interior.Limit)
+	checkLimit("network.outside.limit", conf.Network.Outside.Limit)
+	checkTls("network.interior.tls", conf.Network.Interior.Tls)
+	checkTls("network.outside.tls", conf.Network.Outside.Tls)
+	if conf.Network.Interior.Tls.VerifyEntity && !conf.Network.Interior.Tls.Enabled() {
+		errs = append(errs, errors.New("network.interior.tls.verify_entity: 需要开启TLS"))
+	}
+	if conf.Network.Outside.Tls.VerifyEntity {
+		errs = append(errs, errors.New("network.outside.tls.verify_entity: 只支持interior"))
+	}
+	if conf.Network.ReConnectMax < 0 {
+		errs = append(errs, errors.New("network.reconnection_max: 不能小于0"))
+	}
+	if conf.Network.ReadTimeout < 0 {
+		errs = append(errs, errors.New("network.read_timeout: 不能小于0"))
+	}
+	switch conf.WebSocket.WebSocketMessageType {
+	case 0, 1, 2:
+	default:
+		errs = append(errs, errors.New("webSocket.ws_message_type: 只支持1:TextMessage 2:BinaryMessage"))
+	}
+	if (conf.WebSocket.CertFile == "") != (conf.WebSocket.KeyFile == "") {
+		errs = append(errs, errors.New("webSocket.ws_certfile/ws_keyfile: 需要同时配置"))
+	}
+	if conf.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown_timeout: 不能小于0"))
+	}
+	if conf.FrameRate < 0 || conf.FrameRate > 1000 {
+		errs = append(errs, errors.New("frame_rate: 需要在0~1000之间"))
+	}
+	if conf.ReloadInterval < 0 {
+		errs = append(errs, errors.New("reload_interval: 不能小于0"))
+	}
+	return errors.Join(errs...)
+}
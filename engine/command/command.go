@@ -0,0 +1,249 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	//ArgType 参数类型
+	ArgType int
+	//Arg 命令参数定义
+	Arg struct {
+		Name string
+		Type ArgType
+		//可选参数，只能放在必填参数后面
+		Optional bool
+	}
+	//Command 命令
+	Command struct {
+		Name string
+		Desc string
+		Args []Arg
+		//执行命令，返回的字符串输出给调用方
+		Fn func(ctx context.Context, args Args) (string, error)
+	}
+	//Args 解析后的参数
+	Args map[string]any
+	//Registry 命令注册表
+	Registry struct {
+		lock sync.RWMutex
+		cmds map[string]Command
+	}
+)
+
+const (
+	String ArgType = iota
+	Int
+	Uint
+	Bool
+	//剩余的所有内容，只能作为最后一个参数
+	Rest
+)
+
+// New 创建命令注册表，内置help命令
+func New() *Registry {
+	r := &Registry{cmds: make(map[string]Command)}
+	r.Register(Command{
+		Name: "help",
+		Desc: "列出所有命令",
+		Fn: func(ctx context.Context, args Args) (string, error) {
+			return r.usage(), nil
+		},
+	})
+	return r
+}
+
+func (t ArgType) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case Uint:
+		return "uint"
+	case Bool:
+		return "bool"
+	case Rest:
+		return "text"
+	default:
+		return "string"
+	}
+}
+
+// Usage 命令用法
+func (cmd Command) Usage() string {
+	var sb strings.Builder
+	sb.WriteString(cmd.Name)
+	for _, arg := range cmd.Args {
+		if arg.Optional {
+			fmt.Fprintf(&sb, " [%s:%s]", arg.Name, arg.Type)
+		} else {
+			fmt.Fprintf(&sb, " <%s:%s>", arg.Name, arg.Type)
+		}
+	}
+	return sb.String()
+}
+
+// Register 注册命令，重名或参数定义错误时返回错误
+func (r *Registry) Register(cmd Command) error {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \t\r\n") {
+		return fmt.Errorf("命令名[%s]不合法", cmd.Name)
+	}
+	if cmd.Fn == nil {
+		return fmt.Errorf("命令[%s]没有执行函数", cmd.Name)
+	}
+	optional := false
+	for i, arg := range cmd.Args {
+		if arg.Type == Rest && i != len(cmd.Args)-1 {
+			return fmt.Errorf("命令[%s]参数[%s]: text类型只能作为最后一个参数", cmd.Name, arg.Name)
+		}
+		if optional && !arg.Optional {
+			return fmt.Errorf("命令[%s]参数[%s]: 必填参数不能放在可选参数后面", cmd.Name, arg.Name)
+		}
+		optional = arg.Optional
+	}
+	defer r.lock.Unlock()
+	r.lock.Lock()
+	if _, ok := r.cmds[cmd.Name]; ok {
+		return fmt.Errorf("命令[%s]重复注册", cmd.Name)
+	}
+	r.cmds[cmd.Name] = cmd
+	return nil
+}
+
+// Unregister 注销命令
+func (r *Registry) Unregister(name string) {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+	delete(r.cmds, name)
+}
+
+// Commands 获取所有命令，按名字排序
+func (r *Registry) Commands() []Command {
+	r.lock.RLock()
+	list := make([]Command, 0, len(r.cmds))
+	for _, cmd := range r.cmds {
+		list = append(list, cmd)
+	}
+	r.lock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Exec 解析并执行一行命令，例: kick 12
+func (r *Registry) Exec(ctx context.Context, line string) (string, error) {
+	name, rest := cutToken(line)
+	if name == "" {
+		return "", errors.New("命令为空")
+	}
+	r.lock.RLock()
+	cmd, ok := r.cmds[name]
+	r.lock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("命令[%s]不存在，输入help查看所有命令", name)
+	}
+	args, err := cmd.parse(rest)
+	if err != nil {
+		return "", fmt.Errorf("%w\n用法: %s", err, cmd.Usage())
+	}
+	return cmd.Fn(ctx, args)
+}
+
+func (r *Registry) usage() string {
+	var sb strings.Builder
+	for _, cmd := range r.Commands() {
+		fmt.Fprintf(&sb, "%-40s %s\n", cmd.Usage(), cmd.Desc)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// parse 按参数定义解析参数
+func (cmd Command) parse(line string) (Args, error) {
+	args := make(Args, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		var token string
+		if arg.Type == Rest {
+			token, line = strings.TrimSpace(line), ""
+		} else {
+			token, line = cutToken(line)
+		}
+		if token == "" {
+			if arg.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("缺少参数[%s]", arg.Name)
+		}
+		v, err := arg.Type.parse(token)
+		if err != nil {
+			return nil, fmt.Errorf("参数[%s]需要是%s类型: %w", arg.Name, arg.Type, err)
+		}
+		args[arg.Name] = v
+	}
+	if strings.TrimSpace(line) != "" {
+		return nil, errors.New("参数过多")
+	}
+	return args, nil
+}
+
+func (t ArgType) parse(token string) (any, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(token, 10, 64)
+	case Uint:
+		return strconv.ParseUint(token, 10, 64)
+	case Bool:
+		return strconv.ParseBool(token)
+	default:
+		return token, nil
+	}
+}
+
+// cutToken 取出第一个参数，支持双引号包含空格
+func cutToken(line string) (string, string) {
+	line = strings.TrimLeft(line, " \t")
+	if strings.HasPrefix(line, `"`) {
+		if end := strings.Index(line[1:], `"`); end >= 0 {
+			return line[1 : end+1], line[end+2:]
+		}
+	}
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return strings.TrimSpace(line), ""
+}
+
+// String 获取字符串参数，没有时返回空
+func (args Args) String(name string) string {
+	v, _ := args[name].(string)
+	return v
+}
+
+// Int 获取int参数，没有时返回0
+func (args Args) Int(name string) int64 {
+	v, _ := args[name].(int64)
+	return v
+}
+
+// Uint 获取uint参数，没有时返回0
+func (args Args) Uint(name string) uint64 {
+	v, _ := args[name].(uint64)
+	return v
+}
+
+// Bool 获取bool参数，没有时返回false
+func (args Args) Bool(name string) bool {
+	v, _ := args[name].(bool)
+	return v
+}
+
+// Has 是否传入了参数
+func (args Args) Has(name string) bool {
+	_, ok := args[name]
+	return ok
+}
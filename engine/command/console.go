@@ -0,0 +1,114 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+)
+
+// Console 基于行的TCP控制台，每行一个命令，没有鉴权，只应监听内网地址
+type Console struct {
+	addr     string
+	ctx      context.Context
+	registry *Registry
+	listen   net.Listener
+	lock     sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewConsole 创建控制台，命令在ctx下执行
+func NewConsole(ctx context.Context, addr string, registry *Registry) *Console {
+	return &Console{
+		addr:     addr,
+		ctx:      ctx,
+		registry: registry,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start 监听地址并在后台接收连接
+func (console *Console) Start() error {
+	ln, err := net.Listen("tcp", console.addr)
+	if err != nil {
+		return err
+	}
+	console.listen = ln
+	logger.Info().Str("Addr", console.addr).Msg("控制台启动")
+	console.wg.Add(1)
+	go console.accept()
+	return nil
+}
+
+// Stop 关闭控制台和所有连接
+func (console *Console) Stop() {
+	if console.listen == nil {
+		return
+	}
+	console.listen.Close()
+	console.lock.Lock()
+	for conn := range console.conns {
+		conn.Close()
+	}
+	console.lock.Unlock()
+	console.wg.Wait()
+	logger.Info().Str("Addr", console.addr).Msg("控制台关闭")
+}
+
+func (console *Console) accept() {
+	defer console.wg.Done()
+	for {
+		conn, err := console.listen.Accept()
+		if err != nil {
+			return
+		}
+		console.lock.Lock()
+		console.conns[conn] = struct{}{}
+		console.lock.Unlock()
+		console.wg.Add(1)
+		go console.serve(conn)
+	}
+}
+
+func (console *Console) serve(conn net.Conn) {
+	defer app.Recover()
+	defer console.wg.Done()
+	defer func() {
+		console.lock.Lock()
+		delete(console.conns, conn)
+		console.lock.Unlock()
+		conn.Close()
+	}()
+	logger.Info().Str("Remote", conn.RemoteAddr().String()).Msg("控制台连接")
+	writer := bufio.NewWriter(conn)
+	scanner := bufio.NewScanner(conn)
+	writer.WriteString("> ")
+	writer.Flush()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+		case "quit", "exit":
+			return
+		default:
+			logger.Info().Str("Remote", conn.RemoteAddr().String()).Str("Line", line).Msg("控制台执行命令")
+			out, err := console.registry.Exec(console.ctx, line)
+			if err != nil {
+				out = "error: " + err.Error()
+			}
+			if out != "" {
+				writer.WriteString(out)
+				writer.WriteString("\n")
+			}
+		}
+		writer.WriteString("> ")
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -35,6 +35,7 @@ type (
 		cancle        context.CancelFunc
 		keepAliveChan <-chan *clientv3.LeaseKeepAliveResponse
 		etcdComponent IEtcdComponent
+		leaseTime     int64
 	}
 )
 
@@ -69,10 +70,10 @@ func (component *EtcdComponent) del(kv *mvccpb.KeyValue) {
 }
 
 // 创建etcd
-func NewEtcdConf(component IEtcdComponent) (*EtcdConf, error) {
+func NewEtcdConf(conf gox.EtcdConf, component IEtcdComponent) (*EtcdConf, error) {
 	clientConf := clientv3.Config{
-		Endpoints:   gox.Config.Etcd.EtcdList,
-		DialTimeout: gox.Config.Etcd.EtcdTimeout,
+		Endpoints:   conf.EtcdList,
+		DialTimeout: conf.EtcdTimeout,
 	}
 	client, err := clientv3.New(clientConf)
 	if err != nil {
@@ -84,6 +85,7 @@ func NewEtcdConf(component IEtcdComponent) (*EtcdConf, error) {
 		client:        client,
 		kv:            kv,
 		etcdComponent: component,
+		leaseTime:     conf.EtcdLeaseTime,
 	}
 	if err := es.setLease(); err != nil {
 		return nil, err
@@ -96,7 +98,7 @@ func NewEtcdConf(component IEtcdComponent) (*EtcdConf, error) {
 func (es *EtcdConf) setLease() error {
 	lease := clientv3.NewLease(es.client)
 	//设置租约时间
-	leaseResp, err := lease.Grant(es.client.Ctx(), gox.Config.Etcd.EtcdLeaseTime)
+	leaseResp, err := lease.Grant(es.client.Ctx(), es.leaseTime)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,25 @@
+package sessionhelper
+
+import "github.com/xhaoh94/gox/engine/types"
+
+// Get 获取指定类型的属性，不存在或类型不一致时返回false
+func Get[T any](session types.ISession, key string) (T, bool) {
+	var zero T
+	value, ok := session.Get(key)
+	if !ok {
+		return zero, false
+	}
+	v, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return v, true
+}
+
+// GetOr 获取指定类型的属性，不存在或类型不一致时返回默认值
+func GetOr[T any](session types.ISession, key string, def T) T {
+	if v, ok := Get[T](session, key); ok {
+		return v
+	}
+	return def
+}
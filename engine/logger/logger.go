@@ -1,13 +1,13 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 )
 
@@ -79,18 +79,16 @@ func LogConfig(path string) error {
 	} else {
 		bytes, err := os.ReadFile(path)
 		if err != nil {
-			log.Fatal().Err(err).Str("path", path).Msg("LogConfig")
-			return err
+			return fmt.Errorf("LogConfig path:[%s] err:[%w]", path, err)
 		}
 
 		err = yaml.Unmarshal(bytes, &logCfg)
 		if err != nil {
-			log.Fatal().Err(err).Str("path", path).Msg("LogConfig")
-			return err
+			return fmt.Errorf("LogConfig path:[%s] err:[%w]", path, err)
 		}
 	}
 	if logCfg.LogLevel == "" {
-		log.Fatal().Str("path", path).Msg("日志等级为空")
+		return fmt.Errorf("LogConfig path:[%s] 日志等级为空", path)
 	}
 	zerolog.CallerMarshalFunc = func(pc uintptr, file string, line int) string {
 		return filepath.Base(file) + ":" + strconv.Itoa(line)
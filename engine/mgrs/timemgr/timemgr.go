@@ -1,67 +1,192 @@
 package timemgr
 
 import (
+	"fmt"
+	"math"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+)
+
+type (
+	//Handle 订阅句柄，用于取消订阅
+	Handle uint64
+
+	subscriber struct {
+		handle   Handle
+		fn       func(dt float32)
+		canceled atomic.Bool
+		//Add传入的方法，Remove时比较
+		raw uintptr
+	}
 )
 
 var (
-	muxSync sync.RWMutex
-	fns     []func()
+	muxSync   sync.RWMutex
+	subs      []*subscriber
+	handles   map[Handle]*subscriber = make(map[Handle]*subscriber)
+	handleOps uint64
 
-	tick *time.Ticker
+	tick   *time.Ticker
+	stopCh chan struct{}
+	//启动计数，同进程多个App共用一个定时器
+	refs int
+	//第一次Start的帧率
+	frameRate int
 
+	//上一帧实际经过的时间(秒)，float32的位
+	deltaTime atomic.Uint32
+
+	// DeltaTime 帧间隔(秒)，Start时按帧率设置
+	//
+	// Deprecated: 使用FrameDelta获取上一帧实际经过的时间
 	DeltaTime float32
 )
 
-func init() {
-	fns = make([]func(), 0)
+// FrameDelta 上一帧实际经过的时间(秒)
+func FrameDelta() float32 {
+	return math.Float32frombits(deltaTime.Load())
 }
 
-func Add(fn func()) {
+// Subscribe 订阅每帧更新，dt为上一帧实际经过的时间(秒)
+func Subscribe(fn func(dt float32)) Handle {
+	sub := &subscriber{
+		handle: Handle(atomic.AddUint64(&handleOps, 1)),
+		fn:     fn,
+	}
 	muxSync.Lock()
-	fns = append(fns, fn)
+	subs = append(subs, sub)
+	handles[sub.handle] = sub
 	muxSync.Unlock()
+	return sub.handle
 }
-func Remove(fn func()) {
+
+// Unsubscribe 取消订阅，当前帧还没执行到的回调不会再执行
+func Unsubscribe(handle Handle) {
 	muxSync.Lock()
-	fns = delete(fns, fn)
+	defer muxSync.Unlock()
+	sub, ok := handles[handle]
+	if !ok {
+		return
+	}
+	sub.canceled.Store(true)
+	delete(handles, handle)
+	for i, v := range subs {
+		if v == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+}
+
+// Add 订阅每帧更新，不需要dt时使用
+func Add(fn func()) Handle {
+	handle := Subscribe(func(float32) { fn() })
+	muxSync.Lock()
+	if sub, ok := handles[handle]; ok {
+		sub.raw = reflect.ValueOf(fn).Pointer()
+	}
 	muxSync.Unlock()
+	return handle
 }
-func delete(list []func(), elem func()) []func() {
-	j := 0
-	sf1 := reflect.ValueOf(elem)
-	for _, v := range list {
-		sf2 := reflect.ValueOf(v)
-		if sf1.Pointer() != sf2.Pointer() {
-			list[j] = v
-			j++
+
+// Remove 取消Add订阅的方法，按方法的代码地址比较，同一个方法订阅多次时全部取消
+// 同一个函数字面量创建的闭包代码地址相同，会被一起取消
+//
+// Deprecated: 使用Add返回的Handle调用Unsubscribe，只取消这一次订阅
+func Remove(fn func()) {
+	ptr := reflect.ValueOf(fn).Pointer()
+	muxSync.RLock()
+	var list []Handle
+	for _, sub := range subs {
+		if sub.raw == ptr {
+			list = append(list, sub.handle)
 		}
 	}
-	return list[:j]
+	muxSync.RUnlock()
+	for _, handle := range list {
+		Unsubscribe(handle)
+	}
 }
 
-func Start(farme int) {
-	DeltaTime = 1 / float32(farme)
-	tick = time.NewTicker(time.Second / time.Duration(farme))
-	go update()
+// Start 按帧率启动定时器，同进程的App共用一个定时器，帧率和已启动的不同时返回错误
+func Start(frame int) error {
+	muxSync.Lock()
+	defer muxSync.Unlock()
+	if refs > 0 && frame != frameRate {
+		return fmt.Errorf("timemgr: 帧率[%d]和已启动的[%d]不同，同进程的App共用定时器", frame, frameRate)
+	}
+	refs++
+	if refs > 1 {
+		return nil
+	}
+	frameRate = frame
+	interval := time.Second / time.Duration(frame)
+	deltaTime.Store(math.Float32bits(float32(interval.Seconds())))
+	DeltaTime = float32(interval.Seconds())
+	tick = time.NewTicker(interval)
+	stopCh = make(chan struct{})
+	go update(tick, stopCh, interval)
+	return nil
 }
+
+// Stop 停止定时器，和Start调用次数相同时才真正停止
 func Stop() {
+	muxSync.Lock()
+	defer muxSync.Unlock()
+	if refs == 0 {
+		return
+	}
+	refs--
+	if refs > 0 {
+		return
+	}
 	tick.Stop()
+	close(stopCh)
 }
-func update() {
+
+func update(tick *time.Ticker, stopCh chan struct{}, interval time.Duration) {
 	defer app.Recover()
-	for range tick.C {
-		if len(fns) == 0 {
-			continue
-		}
-		muxSync.RLock()
-		for _, v := range fns {
-			v()
+	last := time.Now()
+	var overruns int
+	var lastWarn time.Time
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-tick.C:
+			dt := float32(now.Sub(last).Seconds())
+			last = now
+			deltaTime.Store(math.Float32bits(dt))
+
+			muxSync.RLock()
+			list := append([]*subscriber(nil), subs...)
+			muxSync.RUnlock()
+			for _, sub := range list {
+				if !sub.canceled.Load() {
+					call(sub, dt)
+				}
+			}
+
+			//单帧耗时超过帧间隔，每秒最多输出一次
+			if cost := time.Since(now); cost > interval {
+				overruns++
+				if time.Since(lastWarn) >= time.Second {
+					logger.Warn().Dur("Cost", cost).Dur("Interval", interval).Int("Count", overruns).
+						Int("Subscribers", len(list)).Msg("timemgr 帧更新超时")
+					overruns = 0
+					lastWarn = time.Now()
+				}
+			}
 		}
-		muxSync.RUnlock()
 	}
 }
+
+func call(sub *subscriber, dt float32) {
+	defer app.Recover()
+	sub.fn(dt)
+}
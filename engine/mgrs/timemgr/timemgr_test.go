@@ -0,0 +1,88 @@
+package timemgr
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartShared(t *testing.T) {
+	if err := Start(50); err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+	if err := Start(10); err == nil {
+		t.Fatal("帧率不同应返回错误")
+	}
+	if err := Start(50); err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+	if dt := FrameDelta(); dt != 0.02 {
+		t.Errorf("FrameDelta = %v, 应为 0.02", dt)
+	}
+	var frames atomic.Int32
+	handle := Subscribe(func(dt float32) { frames.Add(1) })
+	defer Unsubscribe(handle)
+	time.Sleep(300 * time.Millisecond)
+	if n := frames.Load(); n < 8 {
+		t.Errorf("300ms 内只更新了 %d 帧", n)
+	}
+	Stop()
+	if refs != 1 {
+		t.Errorf("refs = %d, 应为 1", refs)
+	}
+	Start(50)
+}
+
+var removeCalls atomic.Int32
+
+func countRemove() {
+	removeCalls.Add(1)
+}
+
+func TestRemove(t *testing.T) {
+	Add(countRemove)
+	Add(countRemove)
+	other := Add(func() {})
+	defer Unsubscribe(other)
+	Remove(countRemove)
+	muxSync.RLock()
+	n := len(subs)
+	muxSync.RUnlock()
+	if n != 1 {
+		t.Fatalf("Remove 后剩余 %d 个订阅, 应为 1", n)
+	}
+	Start(100)
+	defer Stop()
+	time.Sleep(50 * time.Millisecond)
+	if calls := removeCalls.Load(); calls != 0 {
+		t.Errorf("Remove 后仍然执行了 %d 次", calls)
+	}
+}
+
+func TestRemoveSameLiteral(t *testing.T) {
+	newFn := func() func() { return func() {} }
+	first, second := newFn(), newFn()
+	handle := Add(first)
+	other := Add(second)
+	//同一个函数字面量创建的闭包一起取消
+	Remove(first)
+	muxSync.RLock()
+	_, ok1 := handles[handle]
+	_, ok2 := handles[other]
+	muxSync.RUnlock()
+	if ok1 || ok2 {
+		t.Errorf("Remove 后订阅 %v %v, 应都已取消", ok1, ok2)
+	}
+
+	handle, other = Add(first), Add(second)
+	defer Unsubscribe(other)
+	Unsubscribe(handle)
+	muxSync.RLock()
+	_, ok2 = handles[other]
+	muxSync.RUnlock()
+	if !ok2 {
+		t.Error("Unsubscribe 取消了其他订阅")
+	}
+}
@@ -0,0 +1,152 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/network/xhttp"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	//adminServer 管理接口，提供存活、就绪探针和运行状态查询
+	adminServer struct {
+		network *NetWork
+		server  *xhttp.HttpServer
+	}
+	sessionInfo struct {
+		ID     uint32 `json:"id"`
+		Remote string `json:"remote"`
+		Local  string `json:"local"`
+		Tag    string `json:"tag"`
+		User   uint64 `json:"user,omitempty"`
+		//发送队列状态
+		Queue types.QueueStats `json:"queue"`
+		//连接质量和流量
+		Stats types.SessionStats `json:"stats"`
+		//TLS对端证书的身份
+		Peer *types.PeerIdentity `json:"peer,omitempty"`
+	}
+)
+
+func newAdminServer(network *NetWork, addr string) *adminServer {
+	admin := &adminServer{
+		network: network,
+		server:  xhttp.NewServer(addr),
+	}
+	admin.server.AddRoute("/healthz", admin.healthz)
+	admin.server.AddRoute("/readyz", admin.readyz)
+	admin.server.AddRoute("/services", admin.services)
+	admin.server.AddRoute("/sessions", admin.sessions)
+	admin.server.AddRoute("/limits", admin.limits)
+	admin.server.AddRoute("/locations", admin.locations)
+	admin.server.AddRoute("/protocols", admin.protocols)
+	admin.server.AddRoute("/command", admin.command)
+	return admin
+}
+
+func (admin *adminServer) start() {
+	if err := admin.server.Start(); err != nil {
+		logger.Fatal().Err(err).Msg("管理接口启动失败")
+	}
+}
+
+func (admin *adminServer) stop() {
+	admin.server.Stop()
+}
+
+// 进程存活即返回成功
+func (admin *adminServer) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// 模块启动完成并且服务注册成功才算就绪，开始关闭后不再就绪
+func (admin *adminServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if !admin.network.app.IsReady() {
+		http.Error(w, "not started", http.StatusServiceUnavailable)
+		return
+	}
+	if !admin.network.serviceSystem.IsRegistered() {
+		http.Error(w, "not registered", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (admin *adminServer) services(w http.ResponseWriter, r *http.Request) {
+	list := admin.network.GetAllServiceEntitys()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GetID() < list[j].GetID()
+	})
+	writeJson(w, list)
+}
+
+func (admin *adminServer) sessions(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string][]sessionInfo)
+	if admin.network.outside != nil {
+		result["outside"] = toSessionInfos(admin.network.outside)
+	}
+	if admin.network.interior != nil {
+		result["interior"] = toSessionInfos(admin.network.interior)
+	}
+	writeJson(w, result)
+}
+
+func (admin *adminServer) limits(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]types.LimitStats)
+	for name, ser := range map[string]types.IService{"outside": admin.network.outside, "interior": admin.network.interior} {
+		if stats, ok := ser.(interface{ LimitStats() types.LimitStats }); ok {
+			result[name] = stats.LimitStats()
+		}
+	}
+	writeJson(w, result)
+}
+
+func (admin *adminServer) locations(w http.ResponseWriter, r *http.Request) {
+	self, other := admin.network.location.Snapshot()
+	writeJson(w, map[string]map[uint32]uint{
+		"self":  self,
+		"other": other,
+	})
+}
+
+func (admin *adminServer) protocols(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, protoreg.Protocols())
+}
+
+func toSessionInfos(ser types.IService) []sessionInfo {
+	sessions := ser.Sessions()
+	list := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		info := sessionInfo{
+			ID:     session.ID(),
+			Remote: session.RemoteAddr(),
+			Local:  session.LocalAddr(),
+			User:   session.UserID(),
+			Stats:  session.Stats(),
+		}
+		if queue, ok := session.(interface{ QueueStats() types.QueueStats }); ok {
+			info.Queue = queue.QueueStats()
+		}
+		if tag, ok := session.(interface{ GetTagName() string }); ok {
+			info.Tag = tag.GetTagName()
+		}
+		if peer := session.PeerIdentity(); !peer.IsZero() {
+			info.Peer = &peer
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		logger.Error().Err(err).Msg("管理接口序列化失败")
+	}
+}
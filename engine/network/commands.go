@@ -0,0 +1,132 @@
+package network
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/command"
+	"github.com/xhaoh94/gox/engine/logger"
+)
+
+// registerCommands 注册网络系统内置的运维命令
+func (network *NetWork) registerCommands() {
+	cmds := []command.Command{
+		{
+			Name: "kick",
+			Desc: "断开指定的Session",
+			Args: []command.Arg{{Name: "sessionId", Type: command.Uint}},
+			Fn:   network.kickCommand,
+		},
+		{
+			Name: "reload",
+			Desc: "重新加载配置",
+			Fn: func(ctx context.Context, args command.Args) (string, error) {
+				if err := network.app.Reload(); err != nil {
+					return "", err
+				}
+				return "配置已重新加载", nil
+			},
+		},
+		{
+			Name: "locate",
+			Desc: "查找实体所在的服务器",
+			Args: []command.Arg{{Name: "locationId", Type: command.Uint}},
+			Fn:   network.locateCommand,
+		},
+		{
+			Name: "broadcast",
+			Desc: "广播消息，由监听EventBroadcast的模块发送给客户端",
+			Args: []command.Arg{{Name: "msg", Type: command.Rest}},
+			Fn: func(ctx context.Context, args command.Args) (string, error) {
+				network.app.Event.Run(gox.EventBroadcast, args.String("msg"))
+				return "已广播", nil
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		if err := network.app.Commands.Register(cmd); err != nil {
+			logger.Error().Err(err).Msg("注册内置命令失败")
+		}
+	}
+}
+
+func (network *NetWork) kickCommand(ctx context.Context, args command.Args) (string, error) {
+	sid := uint32(args.Uint("sessionId"))
+	session := network.GetSessionById(sid)
+	if session == nil {
+		return "", fmt.Errorf("Session[%d]不存在", sid)
+	}
+	remote := session.RemoteAddr()
+	session.Close()
+	return fmt.Sprintf("已断开Session[%d] %s", sid, remote), nil
+}
+
+func (network *NetWork) locateCommand(ctx context.Context, args command.Args) (string, error) {
+	if !network.app.Conf().Location {
+		return "", fmt.Errorf("本服务没有开启Location")
+	}
+	locationID := uint32(args.Uint("locationId"))
+	appID, ok := network.location.Locate(locationID)
+	if !ok {
+		return "", fmt.Errorf("没有找到Location[%d]", locationID)
+	}
+	return fmt.Sprintf("Location[%d]在服务[%d]", locationID, appID), nil
+}
+
+// 管理接口执行命令，只接受POST 例: curl -d "kick 12" http://admin_addr/command
+// 配置admin_token时需要请求头 Authorization: Bearer <令牌>，没有配置时只允许本机且不是浏览器跨站发起的请求
+func (admin *adminServer) command(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := admin.authorize(r); err != nil {
+		logger.Warn().Str("Remote", r.RemoteAddr).Err(err).Msg("管理接口拒绝执行命令")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	line := strings.TrimSpace(string(body))
+	app := admin.network.app
+	out, err := app.Commands.Exec(app.Ctx, line)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte(out + "\n"))
+}
+
+// authorize 检查执行命令的权限
+func (admin *adminServer) authorize(r *http.Request) error {
+	if token := admin.network.app.Conf().AdminToken; token != "" {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			return errors.New("令牌错误")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return errors.New("没有配置admin_token时只允许本机执行")
+	}
+	//浏览器跨站发起的请求会带Origin
+	if r.Header.Get("Origin") != "" {
+		return errors.New("没有配置admin_token时不接受浏览器发起的请求")
+	}
+	return nil
+}
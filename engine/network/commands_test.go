@@ -0,0 +1,67 @@
+package network
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/command"
+)
+
+func newTestAdmin(t *testing.T, token string) (*adminServer, *int) {
+	app := gox.NewApp()
+	if err := app.InitConf(gox.AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:1", AdminToken: token}); err != nil {
+		t.Fatal(err)
+	}
+	runs := new(int)
+	app.Commands.Register(command.Command{
+		Name: "touch",
+		Fn: func(ctx context.Context, args command.Args) (string, error) {
+			*runs++
+			return "ok", nil
+		},
+	})
+	return &adminServer{network: &NetWork{app: app}}, runs
+}
+
+func TestAdminCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		remote string
+		header map[string]string
+		code   int
+	}{
+		{"GET拒绝", "", http.MethodGet, "127.0.0.1:5000", nil, http.StatusMethodNotAllowed},
+		{"本机POST", "", http.MethodPost, "127.0.0.1:5000", nil, http.StatusOK},
+		{"本机IPv6", "", http.MethodPost, "[::1]:5000", nil, http.StatusOK},
+		{"其他机器没有令牌", "", http.MethodPost, "10.0.0.2:5000", nil, http.StatusForbidden},
+		{"浏览器跨站", "", http.MethodPost, "127.0.0.1:5000", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"令牌正确", "secret", http.MethodPost, "10.0.0.2:5000", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"令牌错误", "secret", http.MethodPost, "127.0.0.1:5000", map[string]string{"Authorization": "Bearer wrong"}, http.StatusForbidden},
+		{"缺少令牌", "secret", http.MethodPost, "127.0.0.1:5000", nil, http.StatusForbidden},
+		{"令牌GET拒绝", "secret", http.MethodGet, "127.0.0.1:5000", map[string]string{"Authorization": "Bearer secret"}, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, runs := newTestAdmin(t, tt.token)
+			r := httptest.NewRequest(tt.method, "/command?line=touch", strings.NewReader("touch"))
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			admin.command(w, r)
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, 应为 %d body=%s", w.Code, tt.code, w.Body.String())
+			}
+			if want := tt.code == http.StatusOK; (*runs == 1) != want {
+				t.Errorf("执行次数 = %d", *runs)
+			}
+		})
+	}
+}
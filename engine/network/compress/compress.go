@@ -0,0 +1,114 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	flateCompressor struct{}
+	gzipCompressor  struct{}
+)
+
+var (
+	Flate flateCompressor
+	Gzip  gzipCompressor
+
+	lock        sync.RWMutex
+	compressors = map[string]types.ICompressor{
+		"flate": Flate,
+		"gzip":  Gzip,
+	}
+
+	flatePool = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	gzipPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(nil)
+	}}
+
+	ErrTooLarge = errors.New("解压后的长度超出上限")
+)
+
+// Register 注册压缩方式，配置network.compress使用注册的名字，需要在Init之前注册
+func Register(name string, compressor types.ICompressor) {
+	lock.Lock()
+	compressors[name] = compressor
+	lock.Unlock()
+}
+
+// Get 通过名字获取压缩方式，空名字为flate
+func Get(name string) (types.ICompressor, bool) {
+	if name == "" {
+		return Flate, true
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	compressor, ok := compressors[name]
+	return compressor, ok
+}
+
+func (flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	w := flatePool.Get().(*flate.Writer)
+	defer flatePool.Put(w)
+	w.Reset(&buffer)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(data []byte, maxLen int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return readLimit(r, maxLen)
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	w := gzipPool.Get().(*gzip.Writer)
+	defer gzipPool.Put(w)
+	w.Reset(&buffer)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, maxLen int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, maxLen)
+}
+
+// readLimit 最多读取maxLen，防止解压炸弹
+func readLimit(r io.Reader, maxLen int) ([]byte, error) {
+	if maxLen <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxLen)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxLen {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
@@ -3,6 +3,8 @@ package location
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"sync"
 	"time"
 
@@ -11,8 +13,10 @@ import (
 	"github.com/xhaoh94/gox/engine/helper/cmdhelper"
 	"github.com/xhaoh94/gox/engine/helper/commonhelper"
 	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/mgrs/timemgr"
 	"github.com/xhaoh94/gox/engine/network/codec"
 	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/network/rpc"
 	"github.com/xhaoh94/gox/engine/types"
 )
 
@@ -32,32 +36,87 @@ type (
 		lockSelf sync.RWMutex
 		//注册在本服务器的实体
 		slefLocationMap map[uint32]uint
+		//实体的帧更新订阅
+		updates map[uint32]timemgr.Handle
 	}
 )
 
-func New() *LocationSystem {
-	locationSystem := &LocationSystem{}
-	gox.Location = locationSystem
+var registerOnce sync.Once
+
+func New(app *gox.App) *LocationSystem {
+	locationSystem := &LocationSystem{SyncLocation: SyncLocation{app: app}}
+	app.SetLocation(locationSystem)
 	return locationSystem
 }
 func (location *LocationSystem) Init() {
 	location.otherLocationMap = make(map[uint32]uint, 0)
 	location.slefLocationMap = make(map[uint32]uint, 0)
-	if gox.Config.Location {
-		protoreg.BindCodec(LocationRelay, codec.MsgPack)
-		protoreg.BindCodec(LocationGet, codec.MsgPack)
-		protoreg.BindCodec(LocationRegister, codec.MsgPack)
-		protoreg.RegisterRpcCmd(LocationRelay, location.RelayHandler)
-		protoreg.RegisterRpcCmd(LocationGet, location.GetHandler)
-		protoreg.Register(LocationRegister, location.RegisterHandler)
+	location.updates = make(map[uint32]timemgr.Handle)
+	if location.app.Conf().Location {
+		//协议是进程内全局注册的，多个App共用，处理时通过ctx找到所属App的定位系统
+		registerOnce.Do(func() {
+			protoreg.BindCodec(LocationRelay, codec.MsgPack)
+			protoreg.BindCodec(LocationGet, codec.MsgPack)
+			protoreg.BindCodec(LocationRegister, codec.MsgPack)
+			protoreg.RegisterRpcCmd(LocationRelay, relayHandler)
+			protoreg.BindRelay(LocationRelay) //拦截器只对转发的CMD执行
+			protoreg.RegisterRpcCmd(LocationGet, getHandler)
+			protoreg.Register(LocationRegister, registerHandler)
+		})
 	}
 }
+
+// fromContext 获取ctx所属App的定位系统
+func fromContext(ctx context.Context) *LocationSystem {
+	return gox.FromContext(ctx).Location.(*LocationSystem)
+}
+func relayHandler(ctx context.Context, session types.ISession, req *LocationRelayRequire) (*LocationRelayResponse, error) {
+	return fromContext(ctx).RelayHandler(ctx, session, req)
+}
+func getHandler(ctx context.Context, session types.ISession, req *LocationGetRequire) (*LocationGetResponse, error) {
+	return fromContext(ctx).GetHandler(ctx, session, req)
+}
+func registerHandler(ctx context.Context, session types.ISession, req *LocationRegisterRequire) {
+	fromContext(ctx).RegisterHandler(ctx, session, req)
+}
 func (location *LocationSystem) Start() {
 }
 
 func (location *LocationSystem) Stop() {
 }
 
+// Drain 关闭前注销本服务器上的所有实体
+func (location *LocationSystem) Drain() {
+	if !location.app.Conf().Location {
+		return
+	}
+	location.lockSelf.Lock()
+	datas := make([]uint32, 0, len(location.slefLocationMap))
+	for locationID := range location.slefLocationMap {
+		datas = append(datas, locationID)
+	}
+	clear(location.slefLocationMap)
+	location.unsubscribeAll()
+	location.lockSelf.Unlock()
+	if len(datas) == 0 {
+		return
+	}
+	logger.Info().Int("Count", len(datas)).Msg("注销本服务Location")
+	location.SyncLocation.register(false, datas)
+	location.emit(gox.EventLocationUnregistered, datas)
+}
+
+// Snapshot 获取注册在本服务器的实体和缓存的其他服务器实体
+func (location *LocationSystem) Snapshot() (self map[uint32]uint, other map[uint32]uint) {
+	location.lockSelf.RLock()
+	self = maps.Clone(location.slefLocationMap)
+	location.lockSelf.RUnlock()
+	location.lockOther.RLock()
+	other = maps.Clone(location.otherLocationMap)
+	location.lockOther.RUnlock()
+	return
+}
+
 func (location *LocationSystem) RelayHandler(ctx context.Context, session types.ISession, req *LocationRelayRequire) (*LocationRelayResponse, error) {
 
 	location.lockSelf.RLock()
@@ -70,7 +129,7 @@ func (location *LocationSystem) RelayHandler(ctx context.Context, session types.
 		if err := session.Codec(cmd).Unmarshal(req.Require, require); err != nil {
 			return relayResponse, nil
 		}
-		response, err := protoreg.Call(cmd, ctx, session, require)
+		response, err := protoreg.CallRelay(cmd, ctx, session, require)
 		if err != nil || !req.IsCall {
 			return relayResponse, nil
 		}
@@ -94,7 +153,7 @@ func (location *LocationSystem) GetHandler(ctx context.Context, session types.IS
 	return &LocationGetResponse{Datas: datas}, nil
 }
 func (location *LocationSystem) RegisterHandler(ctx context.Context, session types.ISession, req *LocationRegisterRequire) {
-	if req.AppID > 0 && req.AppID != gox.Config.AppID && len(req.LocationIDs) > 0 {
+	if req.AppID > 0 && req.AppID != location.app.Conf().AppID && len(req.LocationIDs) > 0 {
 		location.lockOther.Lock()
 		for _, locationID := range req.LocationIDs {
 			if req.IsRegister {
@@ -126,6 +185,53 @@ func (location *LocationSystem) del(Datas []uint32) {
 	}
 }
 
+// subscribeUpdate 实体实现了OnUpdate时订阅帧更新，需要持有lockSelf
+func (location *LocationSystem) subscribeUpdate(entity types.ILocation) {
+	update, ok := entity.(types.ILocationUpdate)
+	if !ok {
+		return
+	}
+	locationID := entity.LocationID()
+	location.unsubscribeUpdate(locationID)
+	location.updates[locationID] = timemgr.Subscribe(update.OnUpdate)
+}
+
+// unsubscribeUpdate 取消实体的帧更新，需要持有lockSelf
+func (location *LocationSystem) unsubscribeUpdate(locationID uint32) {
+	if handle, ok := location.updates[locationID]; ok {
+		timemgr.Unsubscribe(handle)
+		delete(location.updates, locationID)
+	}
+}
+
+// unsubscribeAll 取消所有实体的帧更新，需要持有lockSelf
+func (location *LocationSystem) unsubscribeAll() {
+	for locationID := range location.updates {
+		location.unsubscribeUpdate(locationID)
+	}
+}
+
+// Locate 查找实体所在的服务器，本服务器和缓存中没有时向其他服务器查询
+func (location *LocationSystem) Locate(locationID uint32) (uint, bool) {
+	location.lockSelf.RLock()
+	appID, ok := location.slefLocationMap[locationID]
+	location.lockSelf.RUnlock()
+	if ok {
+		return appID, true
+	}
+	location.lockOther.RLock()
+	appID, ok = location.otherLocationMap[locationID]
+	location.lockOther.RUnlock()
+	if ok {
+		return appID, true
+	}
+	location.updateLocationToAppID(locationID, nil)
+	location.lockOther.RLock()
+	appID, ok = location.otherLocationMap[locationID]
+	location.lockOther.RUnlock()
+	return appID, ok
+}
+
 // 更新location所在的服务器，
 // excludeIDs 排除的服务器列表
 func (location *LocationSystem) updateLocationToAppID(locationID uint32, excludeServiceIDs []uint) {
@@ -133,8 +239,15 @@ func (location *LocationSystem) updateLocationToAppID(locationID uint32, exclude
 	location.add(datas)
 }
 
+// emit 每个实体派发一次事件
+func (location *LocationSystem) emit(event string, locationIDs []uint32) {
+	for _, locationID := range locationIDs {
+		location.app.Event.Run(event, locationID)
+	}
+}
+
 func (location *LocationSystem) Register(entity types.ILocation) {
-	if !gox.Config.Location {
+	if !location.app.Conf().Location {
 		logger.Error().Msg("没有启动Location的服务器不可以添加实体")
 		return
 	}
@@ -146,14 +259,16 @@ func (location *LocationSystem) Register(entity types.ILocation) {
 	go entity.Init(entity)
 
 	location.lockSelf.Lock()
-	location.slefLocationMap[locationID] = gox.Config.AppID
-	logger.Debug().Uint32("LocationID", locationID).Uint("AppID", gox.Config.AppID).Msg("注册Location")
+	location.slefLocationMap[locationID] = location.app.Conf().AppID
+	location.subscribeUpdate(entity)
+	logger.Debug().Uint32("LocationID", locationID).Uint("AppID", location.app.Conf().AppID).Msg("注册Location")
 	location.lockSelf.Unlock()
 
 	location.SyncLocation.register(true, []uint32{locationID})
+	location.app.Event.Run(gox.EventLocationRegistered, locationID)
 }
 func (location *LocationSystem) Registers(entitys []types.ILocation) {
-	if !gox.Config.Location {
+	if !location.app.Conf().Location {
 		logger.Error().Msg("没有启动Location的服务器不可以注册实体")
 		return
 	}
@@ -166,16 +281,18 @@ func (location *LocationSystem) Registers(entitys []types.ILocation) {
 			continue
 		}
 		go entity.Init(entity)
-		location.slefLocationMap[locationID] = gox.Config.AppID
-		logger.Debug().Uint32("LocationID", locationID).Uint("AppID", gox.Config.AppID).Msg("注册Location")
+		location.slefLocationMap[locationID] = location.app.Conf().AppID
+		location.subscribeUpdate(entity)
+		logger.Debug().Uint32("LocationID", locationID).Uint("AppID", location.app.Conf().AppID).Msg("注册Location")
 		datas = append(datas, locationID)
 	}
 	location.lockSelf.Unlock()
 
 	location.SyncLocation.register(true, datas)
+	location.emit(gox.EventLocationRegistered, datas)
 }
 func (location *LocationSystem) UnRegister(entity types.ILocation) {
-	if !gox.Config.Location {
+	if !location.app.Conf().Location {
 		logger.Error().Msg("没有启动Location的服务器不可以注销实体")
 		return
 	}
@@ -189,21 +306,24 @@ func (location *LocationSystem) UnRegister(entity types.ILocation) {
 	}
 	location.lockSelf.Lock()
 	delete(location.slefLocationMap, locationID)
+	location.unsubscribeUpdate(locationID)
 	logger.Debug().Uint32("LocationID", locationID).Msg("移除Location")
 	location.lockSelf.Unlock()
 	location.SyncLocation.register(false, []uint32{locationID})
+	location.app.Event.Run(gox.EventLocationUnregistered, locationID)
 	go entity.Destroy(entity)
 }
 func (location *LocationSystem) UnRegisters(entitys []types.ILocation) {
-	if !gox.Config.Location {
+	if !location.app.Conf().Location {
 		logger.Error().Msg("没有启动Location的服务器不可以删除实体")
 		return
 	}
-	if len(location.otherLocationMap) == 0 {
-		return
-	}
 	datas := make([]uint32, 0)
 	location.lockSelf.Lock()
+	if len(location.slefLocationMap) == 0 {
+		location.lockSelf.Unlock()
+		return
+	}
 	for _, entity := range entitys {
 		locationID := entity.LocationID()
 		if locationID == 0 {
@@ -211,23 +331,25 @@ func (location *LocationSystem) UnRegisters(entitys []types.ILocation) {
 			continue
 		}
 		delete(location.slefLocationMap, locationID)
+		location.unsubscribeUpdate(locationID)
 		logger.Debug().Uint32("LocationID", locationID).Msg("移除Location")
 		datas = append(datas, locationID)
 	}
 	location.lockSelf.Unlock()
 
 	location.SyncLocation.register(false, datas)
+	location.emit(gox.EventLocationUnregistered, datas)
 
 	for _, entity := range entitys {
 		go entity.Destroy(entity)
 	}
 }
 func (location *LocationSystem) ServiceClose(appID uint) {
-	if appID == gox.Config.AppID {
+	if appID == location.app.Conf().AppID {
+		location.lockSelf.Lock()
 		clear(location.slefLocationMap)
-		return
-	}
-	if len(location.otherLocationMap) == 0 {
+		location.unsubscribeAll()
+		location.lockSelf.Unlock()
 		return
 	}
 	defer location.lockOther.Unlock()
@@ -270,8 +392,8 @@ func (location *LocationSystem) Send(locationID uint32, require any) {
 					logger.Warn().Uint32("CMD", cmd).Msg("LocationSend 发送消息,找不到对应的CMD处理方法")
 					continue
 				}
-				session := gox.NetWork.GetSessionByAppID(gox.Config.AppID)
-				_, err := protoreg.Call(cmd, gox.Ctx, session, _require)
+				session := location.app.NetWork.GetSessionByAppID(location.app.Conf().AppID)
+				_, err := protoreg.Call(cmd, location.app.Ctx, session, _require)
 				if err != nil {
 					logger.Warn().Err(err).Uint32("CMD", cmd).Msg("LocationSend 发送消息失败")
 				}
@@ -285,7 +407,7 @@ func (location *LocationSystem) Send(locationID uint32, require any) {
 				location.updateLocationToAppID(_locationID, excludeIDs)
 				continue
 			}
-			session := gox.NetWork.GetSessionByAppID(id)
+			session := location.app.NetWork.GetSessionByAppID(id)
 			if session == nil {
 				waitFn(id)
 				continue
@@ -296,7 +418,9 @@ func (location *LocationSystem) Send(locationID uint32, require any) {
 				logger.Warn().Err(err).Uint32("CMD", cmd).Msg("LocationSend 序列化失败")
 				return
 			}
-			tmpResponse := location.relay(session, cmd, _locationID, false, msgData)
+			ctx, cancel := rpc.WithDefaultTimeout(location.app.Ctx, location.app.Conf().Network.GetRpcTimeout())
+			tmpResponse := location.relay(ctx, session, cmd, _locationID, false, msgData)
+			cancel()
 			if tmpResponse == nil {
 				return
 			}
@@ -308,7 +432,16 @@ func (location *LocationSystem) Send(locationID uint32, require any) {
 		}
 	}(locationID, require)
 }
+
+// Call 按network.rpc_timeout等待回应，包括重试的时间
 func (location *LocationSystem) Call(locationID uint32, require any, response any) error {
+	ctx, cancel := rpc.WithDefaultTimeout(location.app.Ctx, location.app.Conf().Network.GetRpcTimeout())
+	defer cancel()
+	return location.CallCtx(ctx, locationID, require, response)
+}
+
+// CallCtx 按ctx的截止时间和取消等待回应，包括重试的时间
+func (location *LocationSystem) CallCtx(ctx context.Context, locationID uint32, require any, response any) error {
 	if locationID == 0 {
 		return errors.New("LocationCall LocationID不能为空")
 	}
@@ -316,7 +449,10 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 	waitFn := func(id uint) {
 		location.del([]uint32{locationID})
 		excludeIDs = append(excludeIDs, id)
-		time.Sleep(time.Millisecond * waitTime) //等待一下
+		select { //等待一下
+		case <-ctx.Done():
+		case <-time.After(time.Millisecond * waitTime):
+		}
 	}
 
 	loopCnt := 0
@@ -326,6 +462,9 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 		if loopCnt > 3 {
 			return errors.New("LocationCall:超出尝试发送上限")
 		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("LocationCall: %w", context.Cause(ctx))
+		}
 
 		location.lockSelf.RLock()
 		_, ok := location.slefLocationMap[locationID]
@@ -336,8 +475,10 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 				logger.Warn().Uint32("CMD", cmd).Msg("LocationCall 发送消息,找不到对应的CMD处理方法")
 				continue
 			}
-			session := gox.NetWork.GetSessionByAppID(gox.Config.AppID)
-			resp, err := protoreg.Call(cmd, gox.Ctx, session, require)
+			session := location.app.NetWork.GetSessionByAppID(location.app.Conf().AppID)
+			localCtx, cancel := location.appContext(ctx)
+			resp, err := protoreg.Call(cmd, localCtx, session, require)
+			cancel()
 			if err != nil {
 				return err
 			}
@@ -354,7 +495,7 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 			location.updateLocationToAppID(locationID, excludeIDs)
 			continue
 		}
-		session := gox.NetWork.GetSessionByAppID(id)
+		session := location.app.NetWork.GetSessionByAppID(id)
 		if session == nil {
 			waitFn(id)
 			continue
@@ -365,13 +506,13 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 			return err
 		}
 
-		tmpResponse := location.relay(session, cmd, locationID, true, msgData)
+		tmpResponse := location.relay(ctx, session, cmd, locationID, true, msgData)
 		if tmpResponse == nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("LocationCall: %w", context.Cause(ctx))
+			}
 			return errors.New("转发消息失败")
 		}
-		if err != nil {
-			return err
-		}
 		if !tmpResponse.IsSuc { //可能实体转移到其他服务器了，等待一下，再重新请求
 			waitFn(id)
 			continue
@@ -384,6 +525,22 @@ func (location *LocationSystem) Call(locationID uint32, require any, response an
 		return nil
 	}
 }
+
+// appContext 本地处理使用App的ctx，加上调用方的截止时间和取消
+func (location *LocationSystem) appContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var appCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		appCtx, cancel = context.WithDeadline(location.app.Ctx, deadline)
+	} else {
+		appCtx, cancel = context.WithCancel(location.app.Ctx)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	return appCtx, func() {
+		stop()
+		cancel()
+	}
+}
 func (location *LocationSystem) Broadcast(locationIDs []uint32, require any) {
 	for _, locationID := range locationIDs {
 		location.Send(locationID, require)
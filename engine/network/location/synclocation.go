@@ -1,6 +1,8 @@
 package location
 
 import (
+	"context"
+
 	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/helper/commonhelper"
 	"github.com/xhaoh94/gox/engine/logger"
@@ -9,30 +11,31 @@ import (
 
 type (
 	SyncLocation struct {
+		app *gox.App
 	}
 )
 
-func (sl *SyncLocation) relay(session types.ISession, cmd uint32, locationID uint32, isCall bool, msgDatas []byte) *LocationRelayResponse {
+func (sl *SyncLocation) relay(ctx context.Context, session types.ISession, cmd uint32, locationID uint32, isCall bool, msgDatas []byte) *LocationRelayResponse {
 	tmpRequire := &LocationRelayRequire{}
 	tmpRequire.LocationID = locationID
 	tmpRequire.CMD = cmd
 	tmpRequire.IsCall = isCall
 	tmpRequire.Require = msgDatas
 	tmpResponse := &LocationRelayResponse{}
-	if err := session.CallByCmd(LocationRelay, tmpRequire, tmpResponse); err != nil {
+	if err := session.CallByCmdCtx(ctx, LocationRelay, tmpRequire, tmpResponse); err != nil {
 		logger.Warn().Err(err).Uint32("CMD", cmd).Msg("Location relay error")
 		return nil
 	}
 	return tmpResponse
 }
 func (sl *SyncLocation) get(datas []uint32, excludeIDs []uint) []LocationData {
-	entitys := gox.NetWork.GetServiceEntitys(types.WithExcludeID(gox.Config.AppID), types.WithLocation(), types.WithExcludeIDs(excludeIDs))
+	entitys := sl.app.NetWork.GetServiceEntitys(types.WithExcludeID(sl.app.Conf().AppID), types.WithLocation(), types.WithExcludeIDs(excludeIDs))
 	Datas := make([]LocationData, 0)
 	for _, entity := range entitys {
 		if len(datas) == 0 {
 			break
 		}
-		session := gox.NetWork.GetSessionByAddr(entity.GetInteriorAddr())
+		session := sl.app.NetWork.GetSessionByAddr(entity.GetInteriorAddr())
 		if session == nil {
 			continue
 		}
@@ -48,15 +51,15 @@ func (sl *SyncLocation) get(datas []uint32, excludeIDs []uint) []LocationData {
 	return Datas
 }
 func (sl *SyncLocation) register(isRegister bool, datas []uint32) {
-	entitys := gox.NetWork.GetServiceEntitys(types.WithExcludeID(gox.Config.AppID), types.WithLocation())
+	entitys := sl.app.NetWork.GetServiceEntitys(types.WithExcludeID(sl.app.Conf().AppID), types.WithLocation())
 	for _, entity := range entitys {
 		if len(datas) == 0 {
 			break
 		}
-		session := gox.NetWork.GetSessionByAddr(entity.GetInteriorAddr())
+		session := sl.app.NetWork.GetSessionByAddr(entity.GetInteriorAddr())
 		if session == nil {
 			continue
 		}
-		session.Send(LocationRegister, &LocationRegisterRequire{IsRegister: isRegister, AppID: gox.Config.AppID, LocationIDs: datas})
+		session.Send(LocationRegister, &LocationRegisterRequire{IsRegister: isRegister, AppID: sl.app.Conf().AppID, LocationIDs: datas})
 	}
 }
@@ -1,8 +1,14 @@
 package network
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
 	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/command"
 	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/network/compress"
 	"github.com/xhaoh94/gox/engine/network/location"
 	"github.com/xhaoh94/gox/engine/network/rpc"
 	"github.com/xhaoh94/gox/engine/types"
@@ -10,6 +16,7 @@ import (
 
 type (
 	NetWork struct {
+		app           *gox.App
 		__init        bool
 		__start       bool
 		outside       types.IService
@@ -17,17 +24,31 @@ type (
 		rpc           *rpc.RPC
 		serviceSystem *ServiceSystem
 		location      *location.LocationSystem
+		admin         *adminServer
+		console       *command.Console
 	}
 )
 
+// New 创建默认App的网络系统
 func New() *NetWork {
+	return NewWithApp(gox.Default)
+}
+
+// NewWithApp 创建指定App的网络系统，同一进程运行多个节点时使用
+func NewWithApp(app *gox.App) *NetWork {
 	return &NetWork{
+		app:           app,
 		rpc:           rpc.New(),
-		serviceSystem: newServiceSystem(gox.Ctx),
-		location:      location.New(),
+		serviceSystem: newServiceSystem(app),
+		location:      location.New(app),
 	}
 }
 
+// App 所属的App
+func (network *NetWork) App() *gox.App {
+	return network.app
+}
+
 func (network *NetWork) Outside() types.IService {
 	return network.outside
 }
@@ -79,10 +100,31 @@ func (network *NetWork) Init() {
 		return
 	}
 	network.__init = true
+	if _, ok := compress.Get(network.app.Conf().Network.Compress); !ok {
+		logger.Fatal().Str("Compress", network.app.Conf().Network.Compress).Msg("网络系统: 没有注册此压缩方式")
+		return
+	}
+	if err := network.checkTls(); err != nil {
+		logger.Fatal().Err(err).Msg("网络系统: TLS配置错误")
+		return
+	}
+	network.registerCommands()
+	if addr := network.app.Conf().ConsoleAddr; addr != "" {
+		network.console = command.NewConsole(network.app.Ctx, addr, network.app.Commands)
+		if err := network.console.Start(); err != nil {
+			logger.Fatal().Err(err).Msg("控制台启动失败")
+		}
+	}
+	if addr := network.app.Conf().AdminAddr; addr != "" {
+		network.admin = newAdminServer(network, addr)
+		network.admin.start()
+	}
 	network.interior.Start()
 	if network.outside != nil {
 		network.outside.Start()
 	}
+	network.rpc.SetAddr(network.app.Conf().RpcAddr)
+	network.setRpcTls()
 	network.rpc.Start()
 	network.serviceSystem.Start()
 	network.location.Init()
@@ -95,6 +137,35 @@ func (network *NetWork) Start() {
 	network.rpc.Serve()
 	network.location.Start()
 }
+
+// Drain 开始关闭：在注册表中标记下线，并停止接收外部连接
+func (network *NetWork) Drain(ctx context.Context) {
+	if !network.__start {
+		return
+	}
+	network.serviceSystem.Drain()
+	if network.outside != nil {
+		network.outside.StopAccept()
+	}
+}
+
+// Wait 等待处理中的消息和rpc完成，最后注销定位
+func (network *NetWork) Wait(ctx context.Context) {
+	if !network.__start {
+		return
+	}
+	if network.outside != nil && !network.outside.Wait(ctx) {
+		logger.Warn().Msg("网络系统: 等待外部消息处理超时")
+	}
+	if !network.interior.Wait(ctx) {
+		logger.Warn().Msg("网络系统: 等待内部消息处理超时")
+	}
+	if !network.rpc.Wait(ctx) {
+		logger.Warn().Msg("网络系统: 等待rpc超时")
+	}
+	network.location.Drain()
+}
+
 func (network *NetWork) Destroy() {
 	if !network.__init {
 		return
@@ -108,6 +179,14 @@ func (network *NetWork) Destroy() {
 	network.rpc.Stop()
 	network.serviceSystem.Stop()
 	network.location.Stop()
+	if network.console != nil {
+		network.console.Stop()
+		network.console = nil
+	}
+	if network.admin != nil {
+		network.admin.stop()
+		network.admin = nil
+	}
 }
 
 // 通过id获取服务配置
@@ -125,22 +204,108 @@ func (ss *NetWork) GetServiceEntitys(opts ...types.ServiceOptionFunc) []types.IS
 	return ss.serviceSystem.GetServiceEntitys(opts...)
 }
 
+// GetAllServiceEntitys 包括关闭中的服务器
+func (ss *NetWork) GetAllServiceEntitys(opts ...types.ServiceOptionFunc) []types.IServiceEntity {
+	return ss.serviceSystem.GetAllServiceEntitys(opts...)
+}
+
 // SetOutsideService 设置外部服务类型
 func (network *NetWork) SetOutsideService(ser types.IService, codec types.ICodec) {
-	addr := gox.Config.OutsideAddr
+	addr := network.app.Conf().OutsideAddr
 	if addr == "" {
 		return
 	}
+	network.bindApp(ser, false)
 	ser.Init(addr, codec)
 	network.outside = ser
 }
 
 // SetInteriorService 设置内部服务类型
 func (network *NetWork) SetInteriorService(ser types.IService, codec types.ICodec) {
-	addr := gox.Config.InteriorAddr
+	addr := network.app.Conf().InteriorAddr
 	if addr == "" {
 		return
 	}
+	network.bindApp(ser, true)
 	ser.Init(addr, codec)
 	network.interior = ser
 }
+
+// SetRegistry 设置服务注册表，默认使用etcd，需要在Init之前调用
+func (network *NetWork) SetRegistry(registry Registry) {
+	network.serviceSystem.registry = registry
+}
+
+// setRpcTls grpc使用内部服务的TLS配置
+func (network *NetWork) setRpcTls() {
+	tlsConf := network.app.Conf().Network.Interior.Tls
+	if !tlsConf.Enabled() {
+		return
+	}
+	var serverConf *tls.Config
+	if network.app.Conf().RpcAddr != "" {
+		var err error
+		if serverConf, err = tlsConf.ServerConfig(); err != nil {
+			logger.Fatal().Err(err).Msg("grpc TLS配置错误")
+			return
+		}
+	}
+	clientConf, err := tlsConf.ClientConfig()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("grpc TLS配置错误")
+		return
+	}
+	network.rpc.SetTls(serverConf, clientConf)
+}
+
+// checkTls 服务类型在代码中设置，不能在配置校验时检查，启动前检查服务是否支持TLS
+func (network *NetWork) checkTls() error {
+	conf := &network.app.Conf().Network
+	check := func(key string, ser types.IService, interior bool) error {
+		if ser == nil || !conf.ServiceConf(interior).Tls.Enabled() {
+			return nil
+		}
+		if support, ok := ser.(interface{ SupportTls() bool }); !ok || !support.SupportTls() {
+			return fmt.Errorf("%s: 只支持tcp服务", key)
+		}
+		return nil
+	}
+	if err := check("network.interior.tls", network.interior, true); err != nil {
+		return err
+	}
+	if err := check("network.outside.tls", network.outside, false); err != nil {
+		return err
+	}
+	if conf.Interior.Tls.VerifyEntity {
+		if verifier, ok := network.interior.(interface {
+			SetPeerVerifier(func(string, types.PeerIdentity) error)
+		}); ok {
+			verifier.SetPeerVerifier(network.verifyEntity)
+		}
+	}
+	return nil
+}
+
+// verifyEntity 内部连接的对端证书需要是这个地址注册的服务，CN或DNS SAN为 app_type 或 app_type-app_id
+func (network *NetWork) verifyEntity(addr string, identity types.PeerIdentity) error {
+	for _, entity := range network.GetAllServiceEntitys() {
+		if entity.GetInteriorAddr() != addr {
+			continue
+		}
+		if identity.HasName(entity.GetType()) || identity.HasName(fmt.Sprintf("%s-%d", entity.GetType(), entity.GetID())) {
+			return nil
+		}
+		return fmt.Errorf("证书身份[%s %v]不是服务[%s-%d]", identity.CommonName, identity.DNSNames, entity.GetType(), entity.GetID())
+	}
+	return fmt.Errorf("没有找到地址[%s]注册的服务", addr)
+}
+
+// bindApp 服务绑定所属的App，并标记是内部还是外部服务
+func (network *NetWork) bindApp(ser types.IService, interior bool) {
+	if binder, ok := ser.(interface{ SetApp(*gox.App) }); ok {
+		binder.SetApp(network.app)
+	}
+	if binder, ok := ser.(interface{ SetInterior(bool) }); ok {
+		binder.SetInterior(interior)
+	}
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/service/kcp"
+	"github.com/xhaoh94/gox/engine/network/service/tcp"
+	"github.com/xhaoh94/gox/engine/network/service/ws"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func TestCheckTls(t *testing.T) {
+	tlsConf := gox.TlsConf{CertFile: "node.pem", KeyFile: "node.key"}
+	tests := []struct {
+		name     string
+		interior types.IService
+		outside  types.IService
+		setup    func(conf *gox.NetworkConf)
+		err      string
+	}{
+		{"tcp内部服务", new(tcp.TService), nil, func(conf *gox.NetworkConf) { conf.Interior.Tls = tlsConf }, ""},
+		{"tcp外部服务", new(tcp.TService), new(tcp.TService), func(conf *gox.NetworkConf) { conf.Outside.Tls = tlsConf }, ""},
+		{"kcp内部服务", new(kcp.KService), nil, func(conf *gox.NetworkConf) { conf.Interior.Tls = tlsConf }, "network.interior.tls"},
+		{"ws外部服务", new(tcp.TService), new(ws.WService), func(conf *gox.NetworkConf) { conf.Outside.Tls = tlsConf }, "network.outside.tls"},
+		{"kcp没有开启TLS", new(kcp.KService), new(ws.WService), func(conf *gox.NetworkConf) {}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := gox.AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:1"}
+			tt.setup(&conf.Network)
+			app := gox.NewApp()
+			if err := app.InitConf(conf); err != nil {
+				t.Fatal(err)
+			}
+			network := &NetWork{app: app, interior: tt.interior, outside: tt.outside}
+			err := network.checkTls()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, 应包含 %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyEntity(t *testing.T) {
+	app := gox.NewApp()
+	if err := app.InitConf(gox.AppConf{AppID: 1, AppType: "gate", InteriorAddr: "127.0.0.1:1"}); err != nil {
+		t.Fatal(err)
+	}
+	network := NewWithApp(app)
+	network.serviceSystem.idToService[2] = ServiceEntity{AppID: 2, AppType: "scene", InteriorAddr: "127.0.0.1:2"}
+	tests := []struct {
+		name     string
+		addr     string
+		identity types.PeerIdentity
+		ok       bool
+	}{
+		{"CN为类型", "127.0.0.1:2", types.PeerIdentity{CommonName: "scene"}, true},
+		{"CN为类型和ID", "127.0.0.1:2", types.PeerIdentity{CommonName: "scene-2"}, true},
+		{"SAN为类型和ID", "127.0.0.1:2", types.PeerIdentity{CommonName: "node", DNSNames: []string{"a", "scene-2"}}, true},
+		{"ID不一致", "127.0.0.1:2", types.PeerIdentity{CommonName: "scene-3"}, false},
+		{"类型不一致", "127.0.0.1:2", types.PeerIdentity{DNSNames: []string{"gate"}}, false},
+		{"没有证书", "127.0.0.1:2", types.PeerIdentity{}, false},
+		{"地址没有注册", "127.0.0.1:3", types.PeerIdentity{CommonName: "scene"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := network.verifyEntity(tt.addr, tt.identity); (err == nil) != tt.ok {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package protoreg
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+var (
+	interceptorLock    sync.RWMutex
+	globalInterceptors []types.ProtoInterceptor
+	cmdInterceptors    map[uint32][]types.ProtoInterceptor = make(map[uint32][]types.ProtoInterceptor)
+	relayCmds          map[uint32]bool                     = make(map[uint32]bool)
+)
+
+type relayKey struct{}
+
+// Use 添加全局协议拦截器，所有协议和定位消息按添加顺序执行
+func Use(interceptors ...types.ProtoInterceptor) {
+	interceptorLock.Lock()
+	globalInterceptors = append(globalInterceptors, interceptors...)
+	interceptorLock.Unlock()
+}
+
+// UseCmd 添加CMD的协议拦截器，在全局和服务的拦截器之后执行
+func UseCmd(cmd uint32, interceptors ...types.ProtoInterceptor) {
+	interceptorLock.Lock()
+	cmdInterceptors[cmd] = append(cmdInterceptors[cmd], interceptors...)
+	interceptorLock.Unlock()
+}
+
+// BindRelay 标记转发协议，转发协议本身不执行拦截器，处理函数通过CallRelay对转发的CMD执行
+func BindRelay(cmd uint32) {
+	interceptorLock.Lock()
+	relayCmds[cmd] = true
+	interceptorLock.Unlock()
+}
+
+func isRelay(cmd uint32) bool {
+	interceptorLock.RLock()
+	defer interceptorLock.RUnlock()
+	return relayCmds[cmd]
+}
+
+// CallRelay 触发转发的CMD，使用转发协议所在服务的拦截器
+func CallRelay(cmd uint32, ctx context.Context, session types.ISession, require any) (any, error) {
+	interceptors, _ := ctx.Value(relayKey{}).([]types.ProtoInterceptor)
+	return CallWith(cmd, ctx, session, require, interceptors...)
+}
+
+// interceptorsOf 按 全局、传入、CMD 的顺序合并拦截器
+func interceptorsOf(cmd uint32, interceptors []types.ProtoInterceptor) []types.ProtoInterceptor {
+	interceptorLock.RLock()
+	defer interceptorLock.RUnlock()
+	byCmd := cmdInterceptors[cmd]
+	if len(globalInterceptors) == 0 && len(byCmd) == 0 {
+		return interceptors
+	}
+	chain := make([]types.ProtoInterceptor, 0, len(globalInterceptors)+len(interceptors)+len(byCmd))
+	chain = append(chain, globalInterceptors...)
+	chain = append(chain, interceptors...)
+	return append(chain, byCmd...)
+}
+
+// Recover 把回调中的panic转成错误返回，RPC请求会收到空回应
+func Recover() types.ProtoInterceptor {
+	return func(ctx context.Context, session types.ISession, cmd uint32, require any, next types.ProtoHandler) (response any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error().Uint32("CMD", cmd).Str("Stack", string(debug.Stack())).Msgf("协议处理panic: %v", r)
+				response, err = nil, fmt.Errorf("协议[%d]处理panic: %v", cmd, r)
+			}
+		}()
+		return next(ctx, session, cmd, require)
+	}
+}
+
+// Logging 记录协议的处理耗时和错误，超过slow时输出警告，slow为0时不检查
+func Logging(slow time.Duration) types.ProtoInterceptor {
+	return func(ctx context.Context, session types.ISession, cmd uint32, require any, next types.ProtoHandler) (any, error) {
+		start := time.Now()
+		response, err := next(ctx, session, cmd, require)
+		cost := time.Since(start)
+		if err != nil {
+			logger.Warn().Uint32("CMD", cmd).Dur("Cost", cost).Err(err).Msg("协议处理失败")
+		} else if slow > 0 && cost > slow {
+			logger.Warn().Uint32("CMD", cmd).Dur("Cost", cost).Msg("协议处理超时")
+		} else {
+			logger.Debug().Uint32("CMD", cmd).Dur("Cost", cost).Msg("协议处理")
+		}
+		return response, err
+	}
+}
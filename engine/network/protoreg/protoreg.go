@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
+	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/app"
 	"github.com/xhaoh94/gox/engine/helper/cmdhelper"
 	"github.com/xhaoh94/gox/engine/helper/commonhelper"
@@ -18,6 +20,15 @@ var (
 	bindCodecLock sync.RWMutex
 	bindCodecMap  map[uint32]types.ICodec = make(map[uint32]types.ICodec)
 
+	bindCompressLock sync.RWMutex
+	bindCompressMap  map[uint32]bindCompress = make(map[uint32]bindCompress)
+
+	bindLimitLock sync.RWMutex
+	bindLimitMap  map[uint32]bindLimit = make(map[uint32]bindLimit)
+
+	bindDispatchLock sync.RWMutex
+	bindDispatchMap  map[uint32]gox.Dispatch = make(map[uint32]gox.Dispatch)
+
 	bindFnLock sync.RWMutex
 	bindFnMap  map[uint32]reflect.Value = make(map[uint32]reflect.Value)
 
@@ -85,10 +96,40 @@ func unBind(cmd uint32) error {
 
 // 触发
 func Call(event uint32, ctx context.Context, session types.ISession, require any) (any, error) {
-	values, err := call(event, ctx, session, require)
-	if err != nil {
-		return nil, err
+	return CallWith(event, ctx, session, require)
+}
+
+// CallWith 按 全局、传入、CMD 的顺序执行拦截器后触发回调
+// 转发协议不执行拦截器，传入的拦截器留给转发的CMD使用
+func CallWith(cmd uint32, ctx context.Context, session types.ISession, require any, interceptors ...types.ProtoInterceptor) (response any, err error) {
+	defer app.Recover()
+	if isRelay(cmd) {
+		return call(context.WithValue(ctx, relayKey{}, interceptors), session, cmd, require)
+	}
+	chain := interceptorsOf(cmd, interceptors)
+	var next types.ProtoHandler = call
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, inner := chain[i], next
+		next = func(ctx context.Context, session types.ISession, cmd uint32, require any) (any, error) {
+			return interceptor(ctx, session, cmd, require, inner)
+		}
+	}
+	return next(ctx, session, cmd, require)
+}
+
+// 发送事件，存在返回参数
+func call(ctx context.Context, session types.ISession, cmd uint32, require any) (any, error) {
+	bindFnLock.RLock()
+	fn, ok := bindFnMap[cmd]
+	bindFnLock.RUnlock()
+	if !ok {
+		return nil, errors.New("没有找到监听的事件")
 	}
+	in := make([]reflect.Value, 3)
+	in[0] = reflect.ValueOf(ctx)
+	in[1] = reflect.ValueOf(session)
+	in[2] = reflect.ValueOf(require)
+	values := fn.Call(in)
 	switch len(values) {
 	case 0:
 		return nil, nil
@@ -109,30 +150,6 @@ func Call(event uint32, ctx context.Context, session types.ISession, require any
 	}
 }
 
-// 发送事件，存在返回参数
-func call(cmd uint32, ctx context.Context, session types.ISession, require any) ([]reflect.Value, error) {
-	defer app.Recover()
-	bindFnLock.RLock()
-	fn, ok := bindFnMap[cmd]
-	bindFnLock.RUnlock()
-	if !ok {
-		return nil, errors.New("没有找到监听的事件")
-	}
-	in := make([]reflect.Value, 3)
-	in[0] = reflect.ValueOf(ctx)
-	in[1] = reflect.ValueOf(session)
-	in[2] = reflect.ValueOf(require)
-	// numIn := fn.Type().NumIn()
-	// for i := range params {
-	// 	if i >= numIn {
-	// 		break
-	// 	}
-	// 	param := params[i]
-	// 	in[i] = reflect.ValueOf(param)
-	// }
-	return fn.Call(in), nil
-}
-
 // 是否有注册绑定回调
 func HasBindCallBack(cmd uint32) bool {
 	bindFnLock.RLock()
@@ -158,6 +175,65 @@ func GetCodec(cmd uint32) types.ICodec {
 	return nil
 }
 
+type bindCompress struct {
+	compressor types.ICompressor
+	threshold  int
+}
+
+// 绑定CMD对应的压缩方式，消息体超过threshold时压缩，threshold为0时此CMD不压缩，compressor为nil时使用配置的压缩方式
+func BindCompress(cmd uint32, compressor types.ICompressor, threshold int) {
+	bindCompressLock.Lock()
+	bindCompressMap[cmd] = bindCompress{compressor: compressor, threshold: threshold}
+	bindCompressLock.Unlock()
+}
+
+// 获取CMD对应的压缩方式，没有绑定时返回false
+func GetCompress(cmd uint32) (types.ICompressor, int, bool) {
+	defer bindCompressLock.RUnlock()
+	bindCompressLock.RLock()
+	if bind, ok := bindCompressMap[cmd]; ok {
+		return bind.compressor, bind.threshold, true
+	}
+	return nil, 0, false
+}
+
+type bindLimit struct {
+	rate  int
+	burst int
+}
+
+// 绑定CMD的限流，每个Session每秒最多rate个，burst为桶容量(0时等于rate)，超出时按服务的limit.action处理
+func BindLimit(cmd uint32, rate int, burst int) {
+	bindLimitLock.Lock()
+	bindLimitMap[cmd] = bindLimit{rate: rate, burst: burst}
+	bindLimitLock.Unlock()
+}
+
+// 获取CMD绑定的限流，没有绑定时返回false
+func GetLimit(cmd uint32) (int, int, bool) {
+	defer bindLimitLock.RUnlock()
+	bindLimitLock.RLock()
+	if bind, ok := bindLimitMap[cmd]; ok {
+		return bind.rate, bind.burst, true
+	}
+	return 0, 0, false
+}
+
+// 绑定CMD的消息处理方式，优先于服务配置的dispatch
+func BindDispatch(cmd uint32, dispatch gox.Dispatch) {
+	bindDispatchLock.Lock()
+	bindDispatchMap[cmd] = dispatch
+	bindDispatchLock.Unlock()
+}
+
+// 获取CMD绑定的消息处理方式，没有绑定时返回false
+func GetDispatch(cmd uint32) (gox.Dispatch, bool) {
+	defer bindDispatchLock.RUnlock()
+	bindDispatchLock.RLock()
+	dispatch, ok := bindDispatchMap[cmd]
+	return dispatch, ok
+}
+
 // 注册协议对应消息体和回调函数
 func Register[T types.ProtoFn[V], V any](cmd uint32, fn T) {
 
@@ -260,3 +336,48 @@ func RemoveLocation(entity types.ILocation) {
 		}
 	}
 }
+
+// Protocol 已注册的协议信息
+type Protocol struct {
+	CMD      uint32 `json:"cmd"`
+	Require  string `json:"require"`
+	Response string `json:"response,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Compress string `json:"compress,omitempty"`
+	Dispatch string `json:"dispatch,omitempty"`
+	Limit    string `json:"limit,omitempty"`
+}
+
+// Protocols 获取所有已注册回调的协议，按CMD排序
+func Protocols() []Protocol {
+	bindFnLock.RLock()
+	list := make([]Protocol, 0, len(bindFnMap))
+	for cmd, fn := range bindFnMap {
+		fnType := fn.Type()
+		protocol := Protocol{CMD: cmd}
+		if fnType.NumIn() > 2 {
+			protocol.Require = fnType.In(2).String()
+		}
+		if fnType.NumOut() == 2 {
+			protocol.Response = fnType.Out(0).String()
+		}
+		if codec := GetCodec(cmd); codec != nil {
+			protocol.Codec = fmt.Sprintf("%T", codec)
+		}
+		if compressor, threshold, ok := GetCompress(cmd); ok && compressor != nil {
+			protocol.Compress = fmt.Sprintf("%T>%d", compressor, threshold)
+		}
+		if dispatch, ok := GetDispatch(cmd); ok {
+			protocol.Dispatch = string(dispatch)
+		}
+		if rate, burst, ok := GetLimit(cmd); ok {
+			protocol.Limit = fmt.Sprintf("%d/s burst:%d", rate, burst)
+		}
+		list = append(list, protocol)
+	}
+	bindFnLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CMD < list[j].CMD
+	})
+	return list
+}
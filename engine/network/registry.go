@@ -0,0 +1,191 @@
+package network
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/etcd"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+type (
+	//Registry 服务注册表，默认使用etcd
+	Registry interface {
+		//连接注册表
+		Open() error
+		//写入数据，连接关闭后自动删除
+		Put(key, value string) error
+		Del(key string) error
+		//获取前缀下已有的数据并监听变化
+		Watch(prefix string, onPut func(key string, value []byte), onDel func(key string)) error
+		Close()
+	}
+
+	etcdRegistry struct {
+		etcd.EtcdComponent
+		conf gox.EtcdConf
+		es   *etcd.EtcdConf
+	}
+
+	//MemoryRegistry 进程内的服务注册表，同进程的多个节点共用，用于测试
+	MemoryRegistry struct {
+		lock     sync.Mutex
+		kvs      map[string]memoryValue
+		watchers []*memoryWatcher
+	}
+	memoryValue struct {
+		value string
+		owner *memoryClient
+	}
+	memoryWatcher struct {
+		prefix string
+		owner  *memoryClient
+		onPut  func(key string, value []byte)
+		onDel  func(key string)
+	}
+	memoryClient struct {
+		registry *MemoryRegistry
+		isOpen   bool
+	}
+)
+
+func newEtcdRegistry(conf gox.EtcdConf) *etcdRegistry {
+	return &etcdRegistry{conf: conf}
+}
+
+func (r *etcdRegistry) Open() error {
+	if len(r.conf.EtcdList) == 0 {
+		return errors.New("EtcdList 为空")
+	}
+	es, err := etcd.NewEtcdConf(r.conf, r)
+	if err != nil {
+		return err
+	}
+	r.es = es
+	return nil
+}
+func (r *etcdRegistry) Put(key, value string) error {
+	return r.es.Put(key, value)
+}
+func (r *etcdRegistry) Del(key string) error {
+	return r.es.Del(key)
+}
+func (r *etcdRegistry) Watch(prefix string, onPut func(key string, value []byte), onDel func(key string)) error {
+	r.EtcdComponent.OnPut = func(kv *mvccpb.KeyValue) {
+		if kv.Value == nil {
+			return
+		}
+		onPut(string(kv.Key), kv.Value)
+	}
+	r.EtcdComponent.OnDel = func(kv *mvccpb.KeyValue) {
+		onDel(string(kv.Key))
+	}
+	return r.es.Get(prefix, true)
+}
+func (r *etcdRegistry) Close() {
+	if r.es != nil {
+		r.es.Close()
+	}
+}
+
+// NewMemoryRegistry 创建进程内的服务注册表
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		kvs: make(map[string]memoryValue),
+	}
+}
+
+// Client 创建一个节点使用的连接，连接关闭时删除它写入的数据
+func (m *MemoryRegistry) Client() Registry {
+	return &memoryClient{registry: m}
+}
+
+// 回调在注册表锁内同步执行，保证顺序，回调中不能再操作注册表
+func (m *MemoryRegistry) put(owner *memoryClient, key, value string) {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	m.kvs[key] = memoryValue{value: value, owner: owner}
+	for _, w := range m.watchers {
+		if strings.HasPrefix(key, w.prefix) {
+			w.onPut(key, []byte(value))
+		}
+	}
+}
+func (m *MemoryRegistry) del(key string) {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	m.delLocked(key)
+}
+func (m *MemoryRegistry) delLocked(key string) {
+	if _, ok := m.kvs[key]; !ok {
+		return
+	}
+	delete(m.kvs, key)
+	for _, w := range m.watchers {
+		if strings.HasPrefix(key, w.prefix) {
+			w.onDel(key)
+		}
+	}
+}
+func (m *MemoryRegistry) watch(w *memoryWatcher) {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	m.watchers = append(m.watchers, w)
+	for key, v := range m.kvs {
+		if strings.HasPrefix(key, w.prefix) {
+			w.onPut(key, []byte(v.value))
+		}
+	}
+}
+func (m *MemoryRegistry) close(owner *memoryClient) {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	watchers := m.watchers[:0]
+	for _, w := range m.watchers {
+		if w.owner != owner {
+			watchers = append(watchers, w)
+		}
+	}
+	m.watchers = watchers
+	for key, v := range m.kvs {
+		if v.owner == owner {
+			m.delLocked(key)
+		}
+	}
+}
+
+func (c *memoryClient) Open() error {
+	c.isOpen = true
+	return nil
+}
+func (c *memoryClient) Put(key, value string) error {
+	if !c.isOpen {
+		return errors.New("注册表没有连接")
+	}
+	c.registry.put(c, key, value)
+	return nil
+}
+func (c *memoryClient) Del(key string) error {
+	if !c.isOpen {
+		return errors.New("注册表没有连接")
+	}
+	c.registry.del(key)
+	return nil
+}
+func (c *memoryClient) Watch(prefix string, onPut func(key string, value []byte), onDel func(key string)) error {
+	if !c.isOpen {
+		return errors.New("注册表没有连接")
+	}
+	c.registry.watch(&memoryWatcher{prefix: prefix, owner: c, onPut: onPut, onDel: onDel})
+	return nil
+}
+func (c *memoryClient) Close() {
+	if !c.isOpen {
+		return
+	}
+	c.isOpen = false
+	c.registry.close(c)
+}
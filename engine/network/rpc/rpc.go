@@ -1,25 +1,34 @@
 package rpc
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 type (
 	RPC struct {
 		grpc   *GRPC    //谷歌的grpc框架
 		rpxMap sync.Map //内部自带的rpc存储器
+		rpxCnt int32    //等待中的rpc数量
+		addr   string   //grpc服务地址
 	}
 	GRPC struct {
 		addr2Conn map[string]*grpc.ClientConn
 		addrMutex sync.Mutex
 		server    *grpc.Server
 		listen    net.Listener
+		serverTls *tls.Config
+		clientTls *tls.Config
 	}
 )
 
@@ -27,6 +36,7 @@ type (
 func (rx *RPC) Put(rpx *Rpx) {
 	rpx.del = rx.del
 	rx.rpxMap.Store(rpx.RID(), rpx)
+	atomic.AddInt32(&rx.rpxCnt, 1)
 }
 
 // 获取RPC
@@ -40,12 +50,31 @@ func (rx *RPC) Get(id uint32) *Rpx {
 // 删除rpc
 func (rx *RPC) del(id uint32) {
 	if dr, ok := rx.rpxMap.LoadAndDelete(id); ok {
+		atomic.AddInt32(&rx.rpxCnt, -1)
 		dr.(*Rpx).release()
 	}
 }
 
+// Wait 等待进行中的rpc完成，超时返回false
+func (rx *RPC) Wait(ctx context.Context) bool {
+	for atomic.LoadInt32(&rx.rpxCnt) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
+}
+
 func (rx *RPC) SetAddr(addr string) {
+	rx.addr = addr
+}
 
+// SetTls 设置grpc的TLS配置，为nil时不加密，需要在Start之前调用
+func (rx *RPC) SetTls(serverConf *tls.Config, clientConf *tls.Config) {
+	rx.grpc.serverTls = serverConf
+	rx.grpc.clientTls = clientConf
 }
 
 func (rx *RPC) Serve() {
@@ -56,9 +85,8 @@ func (rx *RPC) Serve() {
 
 // 开启服务
 func (rx *RPC) Start() {
-	rpcAddr := gox.Config.RpcAddr
-	if rpcAddr != "" {
-		rx.grpc.start(rpcAddr)
+	if rx.addr != "" {
+		rx.grpc.start(rx.addr)
 	}
 }
 
@@ -99,7 +127,11 @@ func (grx *GRPC) start(addr string) {
 		if err != nil {
 			logger.Fatal().Err(err).Msg("gprc 监听失败")
 		}
-		grx.server = grpc.NewServer()
+		var opts []grpc.ServerOption
+		if grx.serverTls != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(grx.serverTls)))
+		}
+		grx.server = grpc.NewServer(opts...)
 		logger.Info().Str("RpcAddr", addr).Msg("gprc 等待客户端连接...")
 	}
 }
@@ -120,7 +152,11 @@ func (grx *GRPC) getConnByAddr(addr string) *grpc.ClientConn {
 		return conn
 	}
 	var err error
-	conn, err = grpc.Dial(addr, grpc.WithInsecure())
+	creds := insecure.NewCredentials()
+	if grx.clientTls != nil {
+		creds = credentials.NewTLS(grx.clientTls)
+	}
+	conn, err = grpc.Dial(addr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		logger.Fatal().Err(err).Msg("获取grpc客户端失败")
 	}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,6 +14,9 @@ import (
 // Rpx 自定义rpcdata
 type (
 	Rpx struct {
+		//保护回应的写入，等待结束后不再写入
+		lock     sync.Mutex
+		done     bool
 		err      error
 		rid      uint32
 		errChan  chan error
@@ -35,47 +39,62 @@ func init() {
 	}
 }
 
+// NewRpx ctx结束时停止等待，没有截止时间时一直等到回应或ctx取消
 func NewRpx(ctx context.Context, rpcID uint32, response interface{}) *Rpx {
 	rpx := pool.Get().(*Rpx)
-	rpx.errChan = make(chan error)
+	rpx.errChan = make(chan error, 1)
 	rpx.ctx = ctx
 	rpx.rid = rpcID
 	rpx.response = response
 	rpx.err = nil
+	rpx.done = false
 	return rpx
 }
 
-// Run 调用
+// Run 调用，response已经写入时使用
 func (rpx *Rpx) Run(err error) {
-	if rpx.err == nil {
-		rpx.errChan <- err
+	rpx.Resolve(rpx.RID(), func(interface{}) error { return err })
+}
+
+// Resolve 收到回应，fn解析到response，rid不一致(已回收)或已经结束时忽略
+func (rpx *Rpx) Resolve(rid uint32, fn func(response interface{}) error) {
+	rpx.lock.Lock()
+	defer rpx.lock.Unlock()
+	if rpx.done || rpx.rid != rid || rid == 0 {
+		return
+	}
+	rpx.done = true
+	var err error
+	if fn != nil {
+		err = fn(rpx.response)
 	}
+	rpx.errChan <- err
 }
 
 // Await 异步等待
 func (rpx *Rpx) Await() error {
-	if rpx.err == nil {
-		select {
-		case <-rpx.ctx.Done():
-			rpx.err = errors.New("rpx Context Done")
-			break
-		case rpx.err = <-rpx.errChan:
-			break
-		case <-time.After(time.Second * 3):
-			rpx.err = errors.New("rpx 超时")
-			logger.Error().Msg("rpx 超时")
-			break
+	select {
+	case rpx.err = <-rpx.errChan:
+	case <-rpx.ctx.Done():
+		rpx.lock.Lock()
+		if rpx.done { //同时收到了回应
+			rpx.err = <-rpx.errChan
+		} else {
+			rpx.done = true
+			rpx.err = fmt.Errorf("rpx %w", context.Cause(rpx.ctx))
+			if errors.Is(rpx.err, context.DeadlineExceeded) {
+				logger.Warn().Uint32("RID", rpx.rid).Msg("rpx 超时")
+			}
 		}
+		rpx.lock.Unlock()
 	}
+	//close会回收rpx，需要先取出错误
+	err := rpx.err
 	rpx.close()
-	return rpx.err
+	return err
 }
 
 func (rpx *Rpx) close() {
-	if rpx.errChan != nil {
-		close(rpx.errChan)
-	}
-
 	if rpx.rid != 0 && rpx.del != nil {
 		rpx.del(rpx.rid)
 	} else {
@@ -84,12 +103,14 @@ func (rpx *Rpx) close() {
 }
 
 func (rpx *Rpx) release() {
+	rpx.lock.Lock()
 	rpx.rid = 0
 	rpx.err = nil
 	rpx.errChan = nil
 	rpx.ctx = nil
 	rpx.response = nil
 	rpx.del = nil
+	rpx.lock.Unlock()
 	pool.Put(rpx)
 }
 
@@ -99,9 +120,30 @@ func (rpx *Rpx) GetResponse() interface{} {
 
 // RID 获取RPCID
 func (rpx *Rpx) RID() uint32 {
+	rpx.lock.Lock()
+	defer rpx.lock.Unlock()
 	return rpx.rid
 }
 
 func AssignID() uint32 {
 	return atomic.AddUint32(&rpxOps, 1)
 }
+
+type defaultTimeoutKey struct{}
+
+// WithDefaultTimeout 按network.rpc_timeout等待的ctx，请求不带截止时间发送，没有升级的节点也能处理
+func WithDefaultTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return context.WithValue(ctx, defaultTimeoutKey{}, ctx), cancel
+}
+
+// IsDefaultTimeout ctx的截止时间来自WithDefaultTimeout，之后又设置了更早的截止时间时返回false
+func IsDefaultTimeout(ctx context.Context) bool {
+	timeoutCtx, ok := ctx.Value(defaultTimeoutKey{}).(context.Context)
+	if !ok {
+		return false
+	}
+	deadline, _ := ctx.Deadline()
+	defaultDeadline, _ := timeoutCtx.Deadline()
+	return deadline.Equal(defaultDeadline)
+}
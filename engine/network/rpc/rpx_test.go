@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIsDefaultTimeout(t *testing.T) {
+	defaultCtx, cancel := WithDefaultTimeout(context.Background(), time.Second)
+	defer cancel()
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want bool
+	}{
+		{"默认超时", func() (context.Context, context.CancelFunc) { return defaultCtx, func() {} }, true},
+		{"派生的ctx", func() (context.Context, context.CancelFunc) { return context.WithCancel(defaultCtx) }, true},
+		{"更晚的截止时间", func() (context.Context, context.CancelFunc) { return context.WithTimeout(defaultCtx, time.Minute) }, true},
+		{"更早的截止时间", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(defaultCtx, time.Millisecond*100)
+		}, false},
+		{"没有截止时间", func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) }, false},
+		{"其他截止时间", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Second)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			if got := IsDefaultTimeout(ctx); got != tt.want {
+				t.Errorf("IsDefaultTimeout = %v, 应为 %v", got, tt.want)
+			}
+		})
+	}
+}
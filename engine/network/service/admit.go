@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	//admission 接收连接的计数，Admit时占用，Session断开时释放
+	admission struct {
+		lock    sync.Mutex
+		total   int
+		perIP   map[string]int
+		hooks   []func(remoteAddr string) error
+		hookMux sync.RWMutex
+	}
+)
+
+// AddAcceptHook 添加接收连接的检查，返回错误时拒绝连接，在创建Session之前执行
+func (service *Service) AddAcceptHook(hook func(remoteAddr string) error) {
+	service.admission.hookMux.Lock()
+	service.admission.hooks = append(service.admission.hooks, hook)
+	service.admission.hookMux.Unlock()
+}
+
+// Admit 检查是否接收新连接，通过时占用连接数，之后需要调用OnAccept或ReleaseAdmit
+func (service *Service) Admit(remoteAddr string) error {
+	err := service.admit(remoteAddr)
+	if err != nil {
+		service.limited.admit.Add(1)
+		logger.Debug().Str("Addr", remoteAddr).Err(err).Msg("拒绝连接")
+	}
+	return err
+}
+
+func (service *Service) admit(remoteAddr string) error {
+	ip := remoteIP(remoteAddr)
+	if !service.allowConn(ip) {
+		return errors.New("新连接超出限制")
+	}
+	service.admission.hookMux.RLock()
+	hooks := service.admission.hooks
+	service.admission.hookMux.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(remoteAddr); err != nil {
+			return err
+		}
+	}
+	conf := service.Conf().Admit
+	admission := &service.admission
+	admission.lock.Lock()
+	defer admission.lock.Unlock()
+	if conf.MaxSessions > 0 && admission.total >= conf.MaxSessions {
+		return fmt.Errorf("连接数超出上限[%d]", conf.MaxSessions)
+	}
+	if conf.MaxPerIP > 0 && admission.perIP[ip] >= conf.MaxPerIP {
+		return fmt.Errorf("IP连接数超出上限[%d]", conf.MaxPerIP)
+	}
+	admission.reserve(ip)
+	return nil
+}
+
+// reserveAdmit 不检查上限直接占用，恢复的Session接管新连接时使用
+func (service *Service) reserveAdmit(remoteAddr string) {
+	service.admission.lock.Lock()
+	service.admission.reserve(remoteIP(remoteAddr))
+	service.admission.lock.Unlock()
+}
+
+func (admission *admission) reserve(ip string) {
+	if admission.perIP == nil {
+		admission.perIP = make(map[string]int)
+	}
+	admission.total++
+	admission.perIP[ip]++
+}
+
+// ReleaseAdmit Admit通过后没有创建Session时释放占用
+func (service *Service) ReleaseAdmit(remoteAddr string) {
+	ip := remoteIP(remoteAddr)
+	admission := &service.admission
+	admission.lock.Lock()
+	defer admission.lock.Unlock()
+	if admission.perIP[ip] <= 0 {
+		return
+	}
+	admission.total--
+	if admission.perIP[ip]--; admission.perIP[ip] == 0 {
+		delete(admission.perIP, ip)
+	}
+}
+
+// closeIfNoFrame 接收的连接超时没有收到有效的包时断开
+func (session *Session) closeIfNoFrame(timeout time.Duration) {
+	id := session.id
+	time.AfterFunc(timeout, func() {
+		if session.id == id && !session.received.Load() {
+			logger.Warn().Uint32("ID", id).Dur("Timeout", timeout).Msg("Session 没有收到有效的包")
+			session.stopWith(types.CloseIdle)
+		}
+	})
+}
+
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
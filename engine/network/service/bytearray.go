@@ -2,14 +2,17 @@ package service
 
 import (
 	"encoding/binary"
+	"errors"
+	"io"
 	"sync"
 
+	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/helper/codechelper"
 	"github.com/xhaoh94/gox/engine/types"
 )
 
 // |------------------------------------------|
-// msglen 包的总长度
+// msglen 包的总长度，格式由network.frame_header配置(uint16 uint32 varint)
 // type   包数据类型(0x01:单向请求 0x02:心跳请求 0x03:心跳响应 0x04:rpc请求 0x05:rpc响应)
 // cmd    数据结构对应的cmd
 // rpc    rpc请求或响应时附带的rpcid
@@ -17,7 +20,7 @@ import (
 // |-------------------------------------------------|
 // [ 必填 ]   [ 必填 ]  [ 必填 ]  [ 选填 ] [  选填  ]
 // [msglen]  [ type ]  [ cmd  ]  [  rpc ] [  msg  ]
-// [uint16]  [ byte ]  [uint32]  [uint32] [[n]byte]
+// [header]  [ byte ]  [uint32]  [uint32] [[n]byte]
 // |------------------------------------------------|
 
 var bytePool sync.Pool = sync.Pool{New: func() any {
@@ -31,6 +34,7 @@ type ByteArray struct {
 	position uint32
 	data     []byte
 	endian   binary.ByteOrder
+	header   gox.FrameHeader
 }
 
 func NewByteArray(endian binary.ByteOrder) *ByteArray {
@@ -167,15 +171,65 @@ func (bytearray *ByteArray) RemainData() []byte {
 	return bytearray.ReadBytes(bytearray.RemainLength())
 }
 
+// SetFrameHeader 设置包头格式，默认uint16
+func (bytearray *ByteArray) SetFrameHeader(header gox.FrameHeader) {
+	bytearray.header = header
+}
+
+// Data 加上包头的完整数据，长度超出包头格式上限时需要调用方先检查
 func (bytearray *ByteArray) Data() []byte {
-	bytes := codechelper.ToBytes(uint16(len(bytearray.data)), bytearray.endian)
+	l := len(bytearray.data)
+	var bytes []byte
+	switch bytearray.header {
+	case gox.FrameHeaderUint32:
+		bytes = codechelper.ToBytes(uint32(l), bytearray.endian)
+	case gox.FrameHeaderVarint:
+		bytes = binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen32+l), uint64(l))
+	default:
+		bytes = codechelper.ToBytes(uint16(l), bytearray.endian)
+	}
 	bytes = append(bytes, bytearray.data...)
 	return bytes
 }
 
+// readFrameLen 按包头格式读取包体长度
+func readFrameLen(r io.Reader, header gox.FrameHeader, endian binary.ByteOrder) (uint32, error) {
+	switch header {
+	case gox.FrameHeaderUint32:
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return codechelper.BytesTo[uint32](buf, endian), nil
+	case gox.FrameHeaderVarint:
+		var v uint32
+		buf := make([]byte, 1)
+		for i := 0; i < binary.MaxVarintLen32; i++ {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return 0, err
+			}
+			if i == binary.MaxVarintLen32-1 && buf[0] > 0x0f {
+				break
+			}
+			v |= uint32(buf[0]&0x7f) << (7 * i)
+			if buf[0] < 0x80 {
+				return v, nil
+			}
+		}
+		return 0, errors.New("varint包头格式错误")
+	default:
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return uint32(codechelper.BytesTo[uint16](buf, endian)), nil
+	}
+}
+
 func (bytearray *ByteArray) Release() {
 	bytearray.data = bytearray.data[:0]
 	bytearray.position = 0
 	bytearray.endian = nil
+	bytearray.header = ""
 	bytePool.Put(bytearray)
 }
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func TestFrameHeader(t *testing.T) {
+	tests := []struct {
+		header gox.FrameHeader
+		endian binary.ByteOrder
+		length int
+		//包头的字节
+		want []byte
+	}{
+		{gox.FrameHeaderUint16, binary.LittleEndian, 3, []byte{3, 0}},
+		{gox.FrameHeaderUint16, binary.BigEndian, 300, []byte{1, 44}},
+		{gox.FrameHeaderUint16, binary.LittleEndian, math.MaxUint16, []byte{0xff, 0xff}},
+		{gox.FrameHeaderUint32, binary.LittleEndian, 70000, []byte{0x70, 0x11, 0x01, 0}},
+		{gox.FrameHeaderUint32, binary.BigEndian, 70000, []byte{0, 0x01, 0x11, 0x70}},
+		{gox.FrameHeaderVarint, binary.LittleEndian, 127, []byte{0x7f}},
+		{gox.FrameHeaderVarint, binary.BigEndian, 128, []byte{0x80, 0x01}},
+		{gox.FrameHeaderVarint, binary.LittleEndian, 70000, []byte{0xf0, 0xa2, 0x04}},
+		{"", binary.LittleEndian, 5, []byte{5, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.header), func(t *testing.T) {
+			pkt := NewByteArray(tt.endian)
+			defer pkt.Release()
+			pkt.SetFrameHeader(tt.header)
+			pkt.AppendBytes(make([]byte, tt.length))
+			data := pkt.Data()
+			if !bytes.Equal(data[:len(tt.want)], tt.want) || len(data) != len(tt.want)+tt.length {
+				t.Fatalf("包头 = %v 总长度 %d, 应为 %v", data[:min(len(data), 8)], len(data), tt.want)
+			}
+			r := bytes.NewReader(data)
+			msglen, err := readFrameLen(r, tt.header, tt.endian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(msglen) != tt.length || r.Len() != tt.length {
+				t.Errorf("读取长度 = %d 剩余 %d, 应为 %d", msglen, r.Len(), tt.length)
+			}
+		})
+	}
+}
+
+func TestReadFrameLenInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		header gox.FrameHeader
+		data   []byte
+		want   uint32
+		err    bool
+	}{
+		{"varint最大值", gox.FrameHeaderVarint, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, math.MaxUint32, false},
+		{"varint超出uint32", gox.FrameHeaderVarint, []byte{0xff, 0xff, 0xff, 0xff, 0x10}, 0, true},
+		{"varint超过5字节", gox.FrameHeaderVarint, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, 0, true},
+		{"varint不完整", gox.FrameHeaderVarint, []byte{0x80, 0x80}, 0, true},
+		{"varint为空", gox.FrameHeaderVarint, nil, 0, true},
+		{"uint16不完整", gox.FrameHeaderUint16, []byte{1}, 0, true},
+		{"uint32不完整", gox.FrameHeaderUint32, []byte{1, 0, 0}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msglen, err := readFrameLen(bytes.NewReader(tt.data), tt.header, binary.LittleEndian)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, 应返回错误 %v", err, tt.err)
+			}
+			if msglen != tt.want {
+				t.Errorf("长度 = %d, 应为 %d", msglen, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReaderFrameLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		err   string
+	}{
+		{"空包", []byte{0}, "空包"},
+		{"超出读取上限", append(binary.AppendUvarint(nil, 65), make([]byte, 65)...), "超出界限"},
+		{"varint格式错误", []byte{0xff, 0xff, 0xff, 0xff, 0xff}, "varint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, _ := newTestSession(t, TagAccept, func(conf *gox.AppConf) {
+				conf.Network.FrameHeader = gox.FrameHeaderVarint
+				conf.Network.ReadMsgMaxLen = 64
+			})
+			closed, err := session.parseReader(bytes.NewReader(tt.frame))
+			if !closed || err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("closed = %v err = %v, 应关闭并包含 %s", closed, err, tt.err)
+			}
+			if reason := session.closeReason.Load(); tt.err != "varint" && (reason == nil || *reason != types.CloseProtocol) {
+				t.Errorf("关闭原因 = %v", reason)
+			}
+		})
+	}
+}
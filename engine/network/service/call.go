@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/helper/cmdhelper"
+	"github.com/xhaoh94/gox/engine/network/rpc"
+)
+
+// RPC的截止时间和取消
+// 调用方的ctx有截止时间时发送 [RPC_REQUIRE_DEADLINE][CMD uint32][RPCID uint32][剩余毫秒 uint32][消息体]，没有时发送 [RPC_REQUIRE][CMD][RPCID][消息体]
+// Call、CallByCmd只使用默认的network.rpc_timeout，发送RPC_REQUIRE，没有升级的节点也能处理
+// 接收方从收到请求开始计时，处理回调的ctx到期或调用方取消时结束，Session断开时也结束
+// 调用方在收到回应之前放弃(ctx取消或超时)时发送 [RPC_CANCEL][RPCID uint32]，接收方结束对应回调的ctx
+// 处理前ctx已经结束的请求不再处理也不回应，inline方式在读取协程中处理，处理期间收不到RPC_CANCEL，只按截止时间结束
+
+// errSessionClosed 等待回应时Session断开
+var errSessionClosed = errors.New("session closed")
+
+type (
+	//callCancels 处理中的RPC请求，RPC_CANCEL时结束对应的ctx
+	callCancels struct {
+		lock    sync.Mutex
+		cancels map[uint32]context.CancelFunc
+	}
+)
+
+func (calls *callCancels) add(rpcID uint32, cancel context.CancelFunc) {
+	calls.lock.Lock()
+	if calls.cancels == nil {
+		calls.cancels = make(map[uint32]context.CancelFunc)
+	}
+	calls.cancels[rpcID] = cancel
+	calls.lock.Unlock()
+}
+
+func (calls *callCancels) del(rpcID uint32) {
+	calls.lock.Lock()
+	delete(calls.cancels, rpcID)
+	calls.lock.Unlock()
+}
+
+// cancel 结束对应请求的ctx，已经处理完时忽略
+func (calls *callCancels) cancel(rpcID uint32) {
+	calls.lock.Lock()
+	cancel, ok := calls.cancels[rpcID]
+	delete(calls.cancels, rpcID)
+	calls.lock.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (calls *callCancels) reset() {
+	calls.lock.Lock()
+	for _, cancel := range calls.cancels {
+		cancel()
+	}
+	calls.cancels = nil
+	calls.lock.Unlock()
+}
+
+// CallCtx 呼叫，按ctx的截止时间和取消等待回应，截止时间会传给接收方
+func (session *Session) CallCtx(ctx context.Context, require any, response any) error {
+	cmd := cmdhelper.ToCmd(require, response, 0)
+	return session.CallByCmdCtx(ctx, cmd, require, response)
+}
+
+// CallByCmdCtx ctx没有截止时间时一直等到回应、ctx取消或Session断开
+func (session *Session) CallByCmdCtx(ctx context.Context, cmd uint32, require any, response any) error {
+	sessionCtx := session.ctx
+	if !session.isAct() || sessionCtx == nil {
+		return errors.New("session not active")
+	}
+	if cmd == 0 {
+		return errors.New("cmd == 0 ")
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("rpx %w", context.Cause(ctx))
+	}
+
+	pkt := session.newPacket()
+	defer pkt.Release()
+	rpcID := rpc.AssignID()
+	deadline, ok := ctx.Deadline()
+	if ok && rpc.IsDefaultTimeout(ctx) {
+		ok = false
+	}
+	if ok {
+		pkt.AppendByte(RPC_REQUIRE_DEADLINE)
+	} else {
+		pkt.AppendByte(RPC_REQUIRE)
+	}
+	pkt.AppendUint32(cmd)
+	pkt.AppendUint32(rpcID)
+	if ok {
+		pkt.AppendUint32(remainMillis(deadline))
+	}
+	if err := session.appendMessage(pkt, cmd, require); err != nil {
+		return err
+	}
+	if err := session.checkPacket(pkt); err != nil {
+		return err
+	}
+	//调用方的ctx结束或Session断开都停止等待
+	waitCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(sessionCtx, func() { cancel(errSessionClosed) })
+	defer stop()
+
+	rpx := rpc.NewRpx(waitCtx, rpcID, response)
+	session.rpc().Put(rpx)
+	session.sendMessage(pkt)
+	err := rpx.Await()
+	if err != nil && ctx.Err() != nil && sessionCtx.Err() == nil {
+		session.sendCancel(rpcID)
+	}
+	return err
+}
+
+// remainMillis 距离截止时间的毫秒数，至少1毫秒
+func remainMillis(deadline time.Time) uint32 {
+	remain := time.Until(deadline)
+	if remain <= time.Millisecond {
+		return 1
+	}
+	ms := (remain + time.Millisecond - 1) / time.Millisecond
+	if ms > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ms)
+}
+
+// sendCancel 通知接收方调用方已经放弃
+func (session *Session) sendCancel(rpcID uint32) {
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(RPC_CANCEL)
+	pkt.AppendUint32(rpcID)
+	session.sendPacket(pkt)
+}
+
+// callContext 请求处理回调的ctx，timeout为0时没有截止时间，处理完调用done
+func (session *Session) callContext(rpcID uint32, timeout time.Duration) (ctx context.Context, done func()) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(session.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(session.ctx)
+	}
+	session.calls.add(rpcID, cancel)
+	return ctx, func() {
+		session.calls.del(rpcID)
+		cancel()
+	}
+}
@@ -3,10 +3,13 @@ package service
 import (
 	"errors"
 	"io"
+	"net"
 	"sync"
 	"time"
 
 	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/types"
 )
 
@@ -14,24 +17,55 @@ type (
 	//Channel 通信信道
 	Channel struct {
 		Session *Session
+		app     *gox.App
 		// rfn        func([]byte)
 		// cfn        func()
-		wfn        func([]byte)
-		writeMutex sync.Mutex
+		wfn func([]byte)
+		//批量写入，信道支持时一次写入队列中的所有包
+		bfn        func(net.Buffers)
 		remoteAddr string
 		localAddr  string
 		// endian     binary.ByteOrder
 
+		//发送队列，由写协程按顺序写入，发送方不会被慢连接阻塞
+		queueLock   sync.Mutex
+		notEmpty    *sync.Cond
+		notFull     *sync.Cond
+		queue       [][]byte
+		spare       [][]byte
+		queueClosed bool
+		writeRun    bool
+		writing     bool
+		dropped     uint64
+		writeWg     sync.WaitGroup
+
 		Wg    sync.WaitGroup
 		IsRun bool
 	}
 )
 
+// App 信道所属的App
+func (channel *Channel) App() *gox.App {
+	if channel.app == nil {
+		return gox.Default
+	}
+	return channel.app
+}
+
 func (channel *Channel) ReadTimeout() time.Duration {
-	if gox.Config.Development {
+	conf := channel.App().Conf()
+	if conf.Development {
 		return 0
 	}
-	return gox.Config.Network.ReadTimeout
+	return conf.Network.ReadTimeout
+}
+
+// ReadDeadline 下一次读取的截止时间，读超时为0时不限制(支持热更新)
+func (channel *Channel) ReadDeadline() time.Time {
+	if readTimeout := channel.ReadTimeout(); readTimeout > 0 {
+		return time.Now().Add(readTimeout)
+	}
+	return time.Time{}
 }
 
 // RemoteAddr 获取连接地址
@@ -44,44 +78,159 @@ func (channel *Channel) LocalAddr() string {
 	return channel.localAddr
 }
 
-// Send 发送数据
+// Send 放入发送队列，队列满时按send_queue_policy处理
 func (channel *Channel) Send(data []byte) {
-	defer channel.writeMutex.Unlock()
-	channel.writeMutex.Lock()
-	if !channel.IsRun {
+	defer channel.queueLock.Unlock()
+	channel.queueLock.Lock()
+	if !channel.IsRun || channel.queueClosed {
 		return
 	}
-	sendMax := gox.Config.Network.SendMsgMaxLen
-	if sendMax > 0 { //分片发送
-		DLen := len(data)
-		pos := 0
-		var endPos int
-		for channel.IsRun && pos < DLen {
-			endPos = pos + sendMax
-			if DLen < endPos {
-				endPos = DLen
+	conf := &channel.App().Conf().Network
+	size, policy := conf.GetSendQueueSize(), conf.GetSendQueuePolicy()
+	if !channel.writeRun {
+		channel.writeRun = true
+		channel.writeWg.Add(1)
+		go channel.writeLoop()
+	}
+	for len(channel.queue) >= size {
+		switch policy {
+		case gox.SendQueueDropNewest:
+			channel.dropped++
+			return
+		case gox.SendQueueDropOldest:
+			n := copy(channel.queue, channel.queue[1:])
+			channel.queue[n] = nil
+			channel.queue = channel.queue[:n]
+			channel.dropped++
+		case gox.SendQueueDisconnect:
+			channel.dropped++
+			if session := channel.Session; session != nil {
+				logger.Warn().Uint32("ID", session.ID()).Str("Addr", channel.remoteAddr).Int("Size", size).Msg("Session 发送队列已满，断开连接")
+				go session.stopWith(types.CloseOverflow)
+			}
+			channel.queueClosed = true
+			channel.notFull.Broadcast()
+			return
+		default:
+			channel.notFull.Wait()
+			if !channel.IsRun || channel.queueClosed {
+				return
 			}
-			channel.wfn(data[pos:endPos])
-			pos = endPos
 		}
-	} else {
+	}
+	//超长的包已经在Session中分片，每次写入都是一个完整的包
+	channel.queue = append(channel.queue, data)
+	channel.notEmpty.Signal()
+}
+
+// writeLoop 写协程，每次取出队列中所有的包写入
+func (channel *Channel) writeLoop() {
+	defer channel.writeWg.Done()
+	for {
+		channel.queueLock.Lock()
+		for len(channel.queue) == 0 && !channel.queueClosed {
+			channel.notEmpty.Wait()
+		}
+		if len(channel.queue) == 0 {
+			channel.queueLock.Unlock()
+			return
+		}
+		batch := channel.queue
+		channel.queue, channel.spare = channel.spare[:0], nil
+		channel.writing = true
+		channel.notFull.Broadcast()
+		channel.queueLock.Unlock()
+
+		channel.write(batch)
+
+		channel.queueLock.Lock()
+		clear(batch)
+		channel.spare = batch[:0]
+		channel.writing = false
+		channel.queueLock.Unlock()
+	}
+}
+
+func (channel *Channel) write(batch [][]byte) {
+	defer app.Recover()
+	if !channel.IsRun {
+		return
+	}
+	if channel.bfn != nil {
+		channel.bfn(batch)
+		return
+	}
+	for _, data := range batch {
 		channel.wfn(data)
 	}
 }
 
+// Flush 等待发送队列写完，超时返回false
+func (channel *Channel) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		channel.queueLock.Lock()
+		idle := len(channel.queue) == 0 && !channel.writing
+		channel.queueLock.Unlock()
+		if idle {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// QueueStats 发送队列状态
+func (channel *Channel) QueueStats() types.QueueStats {
+	defer channel.queueLock.Unlock()
+	channel.queueLock.Lock()
+	stats := types.QueueStats{
+		Depth:   len(channel.queue),
+		Dropped: channel.dropped,
+	}
+	if !channel.queueClosed {
+		stats.Capacity = channel.App().Conf().Network.GetSendQueueSize()
+	}
+	return stats
+}
+
+// SetWriteBuffers 设置批量写入，例如net.Buffers.WriteTo使用writev一次写入多个包
+func (channel *Channel) SetWriteBuffers(bfn func(net.Buffers)) {
+	channel.bfn = bfn
+}
+
 // OnStop 停止信道
 func (channel *Channel) OnStop() {
+	//关闭发送队列，等待写协程退出，连接已关闭剩余的包不再写入
+	channel.queueLock.Lock()
+	channel.queueClosed = true
+	channel.notEmpty.Broadcast()
+	channel.notFull.Broadcast()
+	channel.queueLock.Unlock()
+	channel.writeWg.Wait()
+	channel.queueLock.Lock()
+	clear(channel.queue)
+	channel.queue = channel.queue[:0]
+	channel.writeRun = false
+	channel.dropped = 0
+	channel.queueLock.Unlock()
+
 	if channel.Session != nil {
-		channel.Session.release()
+		channel.Session.onStop()
 		channel.Session = nil
 	}
 	channel.localAddr = ""
 	channel.remoteAddr = ""
 	channel.wfn = nil
+	channel.bfn = nil
+	channel.app = nil
 }
 
 func (channel *Channel) SetSession(session types.ISession) {
 	channel.Session = session.(*Session)
+	channel.app = channel.Session.app
 }
 
 // Init 初始化
@@ -89,12 +238,23 @@ func (channel *Channel) Init(wfn func([]byte), remoteAddr string, localAddr stri
 	channel.wfn = wfn
 	channel.remoteAddr = remoteAddr
 	channel.localAddr = localAddr
+	channel.queueLock.Lock()
+	if channel.notEmpty == nil {
+		channel.notEmpty = sync.NewCond(&channel.queueLock)
+		channel.notFull = sync.NewCond(&channel.queueLock)
+	}
+	channel.queueClosed = false
+	channel.queueLock.Unlock()
 }
 
 // Read
 func (channel *Channel) Read(r io.Reader) (bool, error) {
 	if channel.Session != nil {
-		return channel.Session.parseReader(r)
+		stop, err := channel.Session.parseReader(r)
+		if stop {
+			channel.ReadFailed(err)
+		}
+		return stop, err
 	}
 	return true, errors.New("session is nil")
 }
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+)
+
+func TestSendQueuePolicy(t *testing.T) {
+	tests := []struct {
+		policy gox.SendQueuePolicy
+		//写入的包
+		written string
+		dropped uint64
+		closed  bool
+	}{
+		{gox.SendQueueBlock, "abcd", 0, false},
+		{gox.SendQueueDropOldest, "acd", 1, false},
+		{gox.SendQueueDropNewest, "abc", 1, false},
+		{gox.SendQueueDisconnect, "abc", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			service := newTestService(t, func(conf *gox.AppConf) {
+				conf.Network.SendQueueSize = 2
+				conf.Network.SendQueuePolicy = tt.policy
+			})
+			var (
+				lock    sync.Mutex
+				written string
+				writing = make(chan struct{}, 8)
+				gate    = make(chan struct{})
+			)
+			channel := &Channel{app: service.App(), IsRun: true}
+			channel.Init(func(data []byte) {
+				writing <- struct{}{}
+				<-gate
+				lock.Lock()
+				written += string(data)
+				lock.Unlock()
+			}, "127.0.0.1:20000", "127.0.0.1:10000")
+			defer channel.OnStop()
+
+			//写协程阻塞在第一个包，之后的包留在队列中
+			channel.Send([]byte("a"))
+			<-writing
+			channel.Send([]byte("b"))
+			channel.Send([]byte("c"))
+			sent := make(chan struct{})
+			go func() {
+				channel.Send([]byte("d"))
+				close(sent)
+			}()
+			select {
+			case <-sent:
+				if tt.policy == gox.SendQueueBlock {
+					t.Fatal("队列满时应该等待")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.policy != gox.SendQueueBlock {
+					t.Fatal("队列满时不应该等待")
+				}
+			}
+			stats := channel.QueueStats()
+			if stats.Dropped != tt.dropped {
+				t.Errorf("dropped = %d, 应为 %d", stats.Dropped, tt.dropped)
+			}
+			if closed := stats.Capacity == 0; closed != tt.closed {
+				t.Errorf("队列关闭 = %v, 应为 %v", closed, tt.closed)
+			}
+			close(gate)
+			<-sent
+			if !channel.Flush(time.Second) {
+				t.Fatal("发送队列没有写完")
+			}
+			//关闭后的包不再发送
+			channel.Send([]byte("e"))
+			channel.Flush(time.Second)
+			lock.Lock()
+			defer lock.Unlock()
+			want := tt.written
+			if !tt.closed {
+				want += "e"
+			}
+			if written != want {
+				t.Errorf("写入 = %q, 应为 %q", written, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+)
+
+// 消息处理方式，CMD绑定的方式优先，否则使用服务的配置
+// inline  在读取协程中处理，处理慢时阻塞这个连接的读取
+// session 每个Session一个处理协程，同一个Session的消息按顺序处理
+// pool    服务共享的协程池，不保证顺序
+// main    每个App一个队列，在帧更新协程中和模块OnUpdate串行执行
+// 不同方式的CMD之间不保证顺序，队列满时读取协程等待
+
+type (
+	//workerPool 服务共享的处理协程池
+	workerPool struct {
+		tasks chan func()
+		wg    sync.WaitGroup
+	}
+)
+
+func newWorkerPool(workers int, size int) *workerPool {
+	pool := &workerPool{tasks: make(chan func(), size)}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+			for task := range pool.tasks {
+				runTask(task)
+			}
+		}()
+	}
+	return pool
+}
+
+// stop 处理完队列中的任务后退出
+func (pool *workerPool) stop() {
+	close(pool.tasks)
+	pool.wg.Wait()
+}
+
+func runTask(task func()) {
+	defer app.Recover()
+	task()
+}
+
+// dispatchMode CMD的消息处理方式
+func (session *Session) dispatchMode(cmd uint32) gox.Dispatch {
+	if dispatch, ok := protoreg.GetDispatch(cmd); ok {
+		return dispatch
+	}
+	return session.service.Conf().Dispatch
+}
+
+// dispatch 按消息处理方式执行，release会等待执行中的任务完成，之后出队的任务不再执行
+func (session *Session) dispatch(cmd uint32, task func()) {
+	id, service, ctx := session.id, session.service, session.ctx
+	atomic.AddInt32(&service.handling, 1)
+	run := func() {
+		defer atomic.AddInt32(&service.handling, -1)
+		session.taskLock.RLock()
+		defer session.taskLock.RUnlock()
+		if session.id == id {
+			task()
+		}
+	}
+	switch session.dispatchMode(cmd) {
+	case gox.DispatchSession:
+		serial := session.serialQueue(ctx)
+		select {
+		case serial <- run:
+		case <-ctx.Done():
+			run()
+		}
+		if ctx.Err() != nil { //处理协程可能已经退出，剩下的任务在这里执行
+			drainTasks(serial)
+		}
+	case gox.DispatchPool:
+		session.service.workerPool().tasks <- run
+	case gox.DispatchMain:
+		if err := session.app.RunMain(run); err != nil {
+			atomic.AddInt32(&service.handling, -1)
+			logger.Warn().Uint32("CMD", cmd).Err(err).Msg("Session 丢弃消息")
+		}
+	default:
+		run()
+	}
+}
+
+// serialQueue 第一次使用时创建session方式的队列，处理协程在Session关闭后退出
+func (session *Session) serialQueue(ctx context.Context) chan func() {
+	session.serialLock.Lock()
+	defer session.serialLock.Unlock()
+	if session.serial == nil {
+		serial := make(chan func(), session.app.Conf().Network.GetDispatchQueueSize())
+		session.serial = serial
+		go func() {
+			for {
+				select {
+				case task := <-serial:
+					runTask(task)
+				case <-ctx.Done():
+					drainTasks(serial)
+					return
+				}
+			}
+		}()
+	}
+	return session.serial
+}
+
+// drainTasks 执行队列中剩下的任务，Session回收后任务不再执行，只减少处理中的计数
+func drainTasks(tasks chan func()) {
+	for {
+		select {
+		case task := <-tasks:
+			runTask(task)
+		default:
+			return
+		}
+	}
+}
+
+// workerPool 第一次使用时创建协程池
+func (service *Service) workerPool() *workerPool {
+	service.poolLock.Lock()
+	defer service.poolLock.Unlock()
+	if service.pool == nil {
+		conf := &service.App().Conf().Network
+		service.pool = newWorkerPool(conf.GetDispatchWorkers(), conf.GetDispatchQueueSize())
+	}
+	return service.pool
+}
+
+// stopWorkerPool 所有Session关闭后停止协程池
+func (service *Service) stopWorkerPool() {
+	service.poolLock.Lock()
+	pool := service.pool
+	service.pool = nil
+	service.poolLock.Unlock()
+	if pool != nil {
+		pool.stop()
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+)
+
+func TestDispatchSessionRelease(t *testing.T) {
+	session, _ := newTestSession(t, TagAccept, func(conf *gox.AppConf) {
+		conf.Network.Dispatch = gox.DispatchSession
+		conf.Network.DispatchQueueSize = 1
+	})
+	service, ctx := session.service, session.ctx
+	started, block := make(chan struct{}), make(chan struct{})
+	session.dispatch(rawCmd, func() {
+		close(started)
+		<-block
+	})
+	<-started
+	session.dispatch(rawCmd, func() {})
+	//队列已满，发送方等待
+	sent := make(chan struct{})
+	go func() {
+		session.dispatch(rawCmd, func() {})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("队列满时应该等待")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	go session.reset()
+	<-ctx.Done()
+	close(block)
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("关闭后等待中的发送方没有返回")
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&service.handling) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("处理中的计数 = %d", atomic.LoadInt32(&service.handling))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/logger"
+)
+
+// |-----------------------------------------------------------|
+// 超过单包长度的包拆成多个分片包发送，接收端重组后按原包解析
+// type   0x06
+// id     分片组id，同一个Session内唯一
+// index  分片序号，从0开始
+// count  分片总数
+// |-----------------------------------------------------------|
+// [ 必填 ]  [ 必填 ]  [ 必填 ]  [ 必填 ]  [ 必填 ]  [ 必填 ]
+// [header]  [ type ]  [  id  ]  [index ]  [count ]  [ chunk ]
+// [header]  [ byte ]  [uint32]  [uint32]  [uint32]  [[n]byte]
+// |-----------------------------------------------------------|
+
+const (
+	// fragmentOverhead 分片包除数据外的长度
+	fragmentOverhead = 1 + 4 + 4 + 4
+	// fragmentMaxPending 每个Session同时重组的分片组上限
+	fragmentMaxPending = 64
+)
+
+type (
+	//fragment 重组中的分片组
+	fragment struct {
+		chunks   map[uint32][]byte
+		count    uint32
+		size     int
+		deadline time.Time
+	}
+	//fragments 接收端的分片重组，只在接收协程中使用
+	fragments struct {
+		pending map[uint32]*fragment
+		//所有分片组已接收的长度
+		size int
+	}
+)
+
+// add 添加分片，分片组完整时返回重组后的包
+func (frags *fragments) add(id uint32, index uint32, count uint32, chunk []byte, maxLen int, timeout time.Duration) ([]byte, error) {
+	now := time.Now()
+	frags.expire(now)
+	if count == 0 || index >= count {
+		return nil, fmt.Errorf("分片序号错误 index:%d count:%d", index, count)
+	}
+	if len(chunk) == 0 {
+		return nil, fmt.Errorf("分片组[%d]空分片[%d]", id, index)
+	}
+	//除最后一个外的分片都不小于这个分片，数量过多时重组后一定超出上限
+	if uint64(count-1)*uint64(len(chunk)) >= uint64(maxLen) {
+		frags.drop(id)
+		return nil, fmt.Errorf("分片组[%d]分片数量[%d]超出上限", id, count)
+	}
+	if frags.size+len(chunk) > maxLen {
+		frags.drop(id)
+		return nil, fmt.Errorf("分片重组长度超出上限[%d]", maxLen)
+	}
+	if frags.pending == nil {
+		frags.pending = make(map[uint32]*fragment)
+	}
+	frag, ok := frags.pending[id]
+	if !ok {
+		if len(frags.pending) >= fragmentMaxPending {
+			return nil, fmt.Errorf("重组中的分片组数量超出上限[%d]", fragmentMaxPending)
+		}
+		frag = &fragment{chunks: make(map[uint32][]byte), count: count, deadline: now.Add(timeout)}
+		frags.pending[id] = frag
+	}
+	if count != frag.count {
+		frags.drop(id)
+		return nil, fmt.Errorf("分片组[%d]分片数量不一致", id)
+	}
+	if _, ok := frag.chunks[index]; ok {
+		return nil, fmt.Errorf("分片组[%d]重复分片[%d]", id, index)
+	}
+	//接收缓冲会被回收，需要复制
+	frag.chunks[index] = append(make([]byte, 0, len(chunk)), chunk...)
+	frag.size += len(chunk)
+	frags.size += len(chunk)
+	if uint32(len(frag.chunks)) < count {
+		return nil, nil
+	}
+	frags.drop(id)
+	buf := make([]byte, 0, frag.size)
+	for i := uint32(0); i < count; i++ {
+		buf = append(buf, frag.chunks[i]...)
+	}
+	return buf, nil
+}
+
+// expire 丢弃超时的分片组
+func (frags *fragments) expire(now time.Time) {
+	for id, frag := range frags.pending {
+		if now.After(frag.deadline) {
+			logger.Warn().Uint32("ID", id).Int("Received", len(frag.chunks)).Uint32("Count", frag.count).Msg("分片重组超时")
+			frags.drop(id)
+		}
+	}
+}
+
+func (frags *fragments) drop(id uint32) {
+	if frag, ok := frags.pending[id]; ok {
+		frags.size -= frag.size
+		delete(frags.pending, id)
+	}
+}
+
+func (frags *fragments) reset() {
+	frags.pending = nil
+	frags.size = 0
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func TestFragmentsAdd(t *testing.T) {
+	type step struct {
+		id, index, count uint32
+		chunk            string
+		//添加前等待的时间
+		wait time.Duration
+		want string
+		err  bool
+	}
+	tests := []struct {
+		name   string
+		maxLen int
+		steps  []step
+		//剩余的分片组数量和长度
+		pending, size int
+	}{
+		{"按顺序重组", 16, []step{
+			{id: 1, index: 0, count: 3, chunk: "ab"},
+			{id: 1, index: 1, count: 3, chunk: "cd"},
+			{id: 1, index: 2, count: 3, chunk: "e", want: "abcde"},
+		}, 0, 0},
+		{"乱序重组", 16, []step{
+			{id: 1, index: 2, count: 3, chunk: "e"},
+			{id: 1, index: 0, count: 3, chunk: "ab"},
+			{id: 1, index: 1, count: 3, chunk: "cd", want: "abcde"},
+		}, 0, 0},
+		{"多个分片组交错", 16, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 2, index: 0, count: 2, chunk: "xy"},
+			{id: 2, index: 1, count: 2, chunk: "z", want: "xyz"},
+		}, 1, 2},
+		{"单个分片", 16, []step{
+			{id: 1, index: 0, count: 1, chunk: "abc", want: "abc"},
+		}, 0, 0},
+		{"刚好达到上限", 4, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 1, index: 1, count: 2, chunk: "cd", want: "abcd"},
+		}, 0, 0},
+		{"超出上限", 4, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 1, index: 1, count: 2, chunk: "cde", err: true},
+		}, 0, 0},
+		{"所有分片组共用上限", 4, []step{
+			{id: 1, index: 0, count: 2, chunk: "abc"},
+			{id: 2, index: 0, count: 2, chunk: "xy", err: true},
+		}, 1, 3},
+		{"重复分片", 16, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 1, index: 0, count: 2, chunk: "ab", err: true},
+			{id: 1, index: 1, count: 2, chunk: "c", want: "abc"},
+		}, 0, 0},
+		{"分片数量不一致", 16, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 1, index: 1, count: 3, chunk: "c", err: true},
+			{id: 1, index: 1, count: 2, chunk: "c"},
+		}, 1, 1},
+		{"序号超出数量", 16, []step{
+			{id: 1, index: 2, count: 2, chunk: "ab", err: true},
+		}, 0, 0},
+		{"数量为0", 16, []step{
+			{id: 1, index: 0, count: 0, chunk: "ab", err: true},
+		}, 0, 0},
+		{"空分片", 16, []step{
+			{id: 1, index: 0, count: 2, chunk: "", err: true},
+		}, 0, 0},
+		{"分片数量超出上限", 16, []step{
+			{id: 1, index: 0, count: 9, chunk: "ab", err: true},
+		}, 0, 0},
+		{"最后的小分片", 16, []step{
+			{id: 1, index: 2, count: 3, chunk: "e"},
+			{id: 1, index: 0, count: 3, chunk: "abcdefg"},
+			{id: 1, index: 1, count: 3, chunk: "hijklmn", want: "abcdefghijklmne"},
+		}, 0, 0},
+		{"数量超出上限的分片组丢弃", 16, []step{
+			{id: 1, index: 0, count: 3, chunk: "a"},
+			{id: 1, index: 1, count: 3, chunk: "bcdefghi", err: true},
+		}, 0, 0},
+		{"超时丢弃", 16, []step{
+			{id: 1, index: 0, count: 2, chunk: "ab"},
+			{id: 1, index: 1, count: 2, chunk: "c", wait: 20 * time.Millisecond},
+		}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var frags fragments
+			for i, s := range tt.steps {
+				if s.wait > 0 {
+					time.Sleep(s.wait)
+				}
+				buf, err := frags.add(s.id, s.index, s.count, []byte(s.chunk), tt.maxLen, 10*time.Millisecond)
+				if (err != nil) != s.err {
+					t.Fatalf("第%d步 err = %v", i, err)
+				}
+				if string(buf) != s.want {
+					t.Fatalf("第%d步 重组 = %q, 应为 %q", i, buf, s.want)
+				}
+			}
+			if len(frags.pending) != tt.pending || frags.size != tt.size {
+				t.Errorf("剩余分片组 = %d 长度 = %d, 应为 %d %d", len(frags.pending), frags.size, tt.pending, tt.size)
+			}
+		})
+	}
+}
+
+func TestFragmentsCopyChunk(t *testing.T) {
+	var frags fragments
+	chunk := []byte("ab")
+	frags.add(1, 0, 2, chunk, 16, time.Second)
+	//接收缓冲被复用
+	copy(chunk, "xx")
+	buf, err := frags.add(1, 1, 2, []byte("c"), 16, time.Second)
+	if err != nil || string(buf) != "abc" {
+		t.Errorf("重组 = %q err = %v", buf, err)
+	}
+}
+
+type (
+	rawMessage struct {
+		data []byte
+	}
+	rawCodec struct{}
+)
+
+func (rawCodec) Marshal(msg interface{}) ([]byte, error) {
+	return msg.(*rawMessage).data, nil
+}
+func (rawCodec) Unmarshal(data []byte, msg interface{}) error {
+	msg.(*rawMessage).data = bytes.Clone(data)
+	return nil
+}
+
+const rawCmd uint32 = 90101
+
+var rawMessages = make(chan []byte, 1)
+
+func init() {
+	protoreg.BindCodec(rawCmd, rawCodec{})
+	protoreg.Register(rawCmd, func(ctx context.Context, session types.ISession, req *rawMessage) {
+		rawMessages <- req.data
+	})
+}
+
+func TestFragmentRoundTrip(t *testing.T) {
+	const frameMax = 256
+	//C_S_C包的类型和cmd
+	const head = 1 + 4
+	chunkLen := frameMax - fragmentOverhead
+	tests := []struct {
+		name   string
+		header gox.FrameHeader
+		setup  func(conf *gox.AppConf)
+		length int
+		frames int
+	}{
+		{"小于单包", gox.FrameHeaderUint16, nil, frameMax - 1, 1},
+		{"等于单包", gox.FrameHeaderUint16, nil, frameMax, 1},
+		{"超过单包1字节", gox.FrameHeaderUint16, nil, frameMax + 1, 2},
+		{"刚好两个分片", gox.FrameHeaderUint16, nil, chunkLen * 2, 2},
+		{"两个分片多1字节", gox.FrameHeaderUint16, nil, chunkLen*2 + 1, 3},
+		{"uint32包头按读取上限分片", gox.FrameHeaderUint32, func(conf *gox.AppConf) {
+			conf.Network.SendMsgMaxLen = 0
+			conf.Network.ReadMsgMaxLen = frameMax
+		}, frameMax + 1, 2},
+		{"varint包头按读取上限分片", gox.FrameHeaderVarint, func(conf *gox.AppConf) {
+			conf.Network.SendMsgMaxLen = 0
+			conf.Network.ReadMsgMaxLen = frameMax
+		}, chunkLen * 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := func(conf *gox.AppConf) {
+				conf.Network.FrameHeader = tt.header
+				conf.Network.SendMsgMaxLen = frameMax
+				if tt.setup != nil {
+					tt.setup(conf)
+				}
+			}
+			sender, sendCh := newTestSession(t, TagConnector, setup)
+			receiver, _ := newTestSession(t, TagAccept, setup)
+			payload := make([]byte, tt.length-head)
+			for i := range payload {
+				payload[i] = byte(i)
+			}
+			if !sender.Send(rawCmd, payload) {
+				t.Fatal("发送失败")
+			}
+			bodys := sendCh.take(t, sender)
+			if len(bodys) != tt.frames {
+				t.Fatalf("发送了 %d 个包, 应为 %d", len(bodys), tt.frames)
+			}
+			for i, body := range bodys {
+				if len(body) > frameMax {
+					t.Fatalf("第%d个包长度[%d]超出[%d]", i, len(body), frameMax)
+				}
+				//除最后一个外，分片包都是满的
+				if tt.frames > 1 && i < tt.frames-1 && len(body) != frameMax {
+					t.Errorf("第%d个分片长度[%d], 应为[%d]", i, len(body), frameMax)
+				}
+				receiver.parseMsg(body)
+			}
+			select {
+			case data := <-rawMessages:
+				if !bytes.Equal(data, payload) {
+					t.Errorf("重组后的内容不一致 len = %d", len(data))
+				}
+			default:
+				t.Fatal("没有收到消息")
+			}
+		})
+	}
+}
+
+func TestFragmentMaxLen(t *testing.T) {
+	setup := func(conf *gox.AppConf) {
+		conf.Network.SendMsgMaxLen = 256
+		conf.Network.FragmentMaxLen = 1024
+	}
+	sender, sendCh := newTestSession(t, TagConnector, setup)
+	if !sender.Send(rawCmd, make([]byte, 1024-5)) {
+		t.Fatal("等于分片上限应该可以发送")
+	}
+	sendCh.take(t, sender)
+	if sender.Send(rawCmd, make([]byte, 1024-4)) {
+		t.Error("超出分片上限不应该发送")
+	}
+	if frames := sendCh.take(t, sender); len(frames) != 0 {
+		t.Errorf("发送了 %d 个包", len(frames))
+	}
+}
+
+func TestFragmentsMaxPending(t *testing.T) {
+	var frags fragments
+	for id := uint32(1); id <= fragmentMaxPending; id++ {
+		if _, err := frags.add(id, 0, 2, []byte("a"), 1<<20, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := frags.add(fragmentMaxPending+1, 0, 2, []byte("a"), 1<<20, time.Minute); err == nil {
+		t.Fatal("分片组数量超出上限应返回错误")
+	}
+	//已有的分片组继续重组
+	if buf, err := frags.add(1, 1, 2, []byte("b"), 1<<20, time.Minute); err != nil || string(buf) != "ab" {
+		t.Fatalf("重组 = %q err = %v", buf, err)
+	}
+	if _, err := frags.add(fragmentMaxPending+1, 0, 2, []byte("a"), 1<<20, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,8 +1,8 @@
 package kcp
 
 import (
+	"net"
 	"sync"
-	"time"
 
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/service"
@@ -26,6 +26,7 @@ func (channel *KChannel) init(conn *kcp.UDPSession) {
 	// conn.SetMtu(512);
 	channel.conn = conn
 	channel.Init(channel.write, channel.Conn().RemoteAddr().String(), channel.Conn().LocalAddr().String())
+	channel.SetWriteBuffers(channel.writeBuffers)
 }
 
 // Conn 获取通信体
@@ -48,12 +49,9 @@ func (channel *KChannel) run() {
 }
 func (channel *KChannel) recvAsync() {
 	defer channel.Wg.Done()
-	readTimeout := channel.ReadTimeout()
-	if readTimeout > 0 {
-		if err := channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
-			logger.Info().Str("Addr", channel.RemoteAddr()).Err(err).Msg("kcp 接受数据超时")
-			channel.Stop()
-		}
+	if err := channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil {
+		logger.Info().Str("Addr", channel.RemoteAddr()).Err(err).Msg("kcp 接受数据超时")
+		channel.Stop()
 	}
 	for channel.Conn() != nil && channel.IsRun {
 		if stop, err := channel.Read(channel.Conn()); stop {
@@ -62,8 +60,8 @@ func (channel *KChannel) recvAsync() {
 			break
 		}
 
-		if channel.IsRun && readTimeout > 0 {
-			if err := channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		if channel.IsRun {
+			if err := channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil {
 				logger.Info().Str("Addr", channel.RemoteAddr()).Err(err).Msg("kcp 接受数据超时")
 				channel.Stop()
 			}
@@ -78,6 +76,14 @@ func (channel *KChannel) write(buf []byte) {
 	}
 }
 
+// writeBuffers 一次写入多个包
+func (channel *KChannel) writeBuffers(bufs net.Buffers) {
+	_, err := channel.Conn().WriteBuffers(bufs)
+	if err != nil {
+		logger.Info().Str("Addr", channel.RemoteAddr()).Err(err).Msg("kcp 信道写入失败")
+	}
+}
+
 // Stop 停止信道
 func (channel *KChannel) Stop() {
 	if !channel.IsRun {
@@ -4,7 +4,6 @@ import (
 	"net"
 	"time"
 
-	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/service"
 	"github.com/xhaoh94/gox/engine/types"
@@ -43,7 +42,7 @@ func (service *KService) accept() {
 	service.AcceptWg.Add(1)
 	for {
 		conn, err := service.listen.AcceptKCP()
-		if !service.IsRun {
+		if !service.IsRun || service.IsStopAccept {
 			break
 		}
 		if err != nil {
@@ -54,6 +53,10 @@ func (service *KService) accept() {
 			logger.Fatal().Err(err).Msg("kcp 监听客户端连接失败")
 			break
 		}
+		if err := service.Admit(conn.RemoteAddr().String()); err != nil {
+			conn.Close()
+			continue
+		}
 		logger.Info().Str("Addr", conn.RemoteAddr().String()).Msg("kcp 连接成功")
 		go service.connection(conn)
 	}
@@ -70,25 +73,36 @@ func (service *KService) addChannel(conn *kcp.UDPSession) *KChannel {
 
 // connectChannel 链接新信道
 func (service *KService) connectChannel(addr string) types.IChannel {
+	netConf := service.App().Conf().Network
 	var connCount int
 	for {
 		conn, err := kcp.DialWithOptions(addr, nil, 0, 0)
 		if err == nil {
 			return service.addChannel(conn)
 		}
-		if connCount > gox.Config.Network.ReConnectMax {
+		if connCount > netConf.ReConnectMax {
 			logger.Info().Str("Addr", conn.RemoteAddr().String()).Err(err).Msg("kcp 创建通信信道失败")
 			return nil
 		}
-		if !service.IsRun || gox.Config.Network.ReConnectInterval == 0 {
+		if !service.IsRun || netConf.ReConnectInterval == 0 {
 			return nil
 		}
-		time.Sleep(gox.Config.Network.ReConnectInterval)
+		time.Sleep(netConf.ReConnectInterval)
 		connCount++
 		continue
 	}
 }
 
+// StopAccept 停止接收新连接
+func (service *KService) StopAccept() {
+	if !service.IsRun || service.IsStopAccept {
+		return
+	}
+	service.IsStopAccept = true
+	service.listen.Close()
+	logger.Info().Str("Addr", service.GetAddr()).Msg("kcp 停止接收新连接")
+}
+
 // Stop 停止服务
 func (service *KService) Stop() {
 	if !service.IsRun {
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// 心跳和空闲检查，按服务的keepalive配置，tcp、kcp、websocket相同
+// initiator 配置的一端按interval发送心跳，对端原样回应
+// 收到任何包(包括websocket的ping、pong)都会刷新空闲时间，超过idle没有收到时断开，原因为idle
+// 断线保留中的Session不发送也不检查
+
+// startKeepalive 开发者模式下不启动
+func (session *Session) startKeepalive() {
+	session.touch()
+	if session.app.Conf().Development {
+		return
+	}
+	conf := session.service.Conf().Keepalive
+	interval := conf.GetInterval(session.app.Conf().Network.Heartbeat)
+	send := interval > 0 && conf.Initiator.Sends(session.IsConnector())
+	idle := conf.GetIdle()
+	if !send && idle <= 0 {
+		return
+	}
+	tick := interval
+	if !send || (idle > 0 && idle/4 < tick) {
+		tick = idle / 4
+	}
+	go session.keepalive(tick, max(1, int(interval/tick)), send, idle)
+}
+
+// keepalive 每sendEvery次检查发送一次心跳
+func (session *Session) keepalive(tick time.Duration, sendEvery int, send bool, idle time.Duration) {
+	defer app.Recover()
+	id, ctx := session.id, session.ctx
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for ticks := 1; ; ticks++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		//回收时先取消ctx，不读取会被重置的id
+		if ctx.Err() != nil {
+			return
+		}
+		if session.getChannel() == nil { //断线保留中
+			continue
+		}
+		if idle > 0 && session.idleTime() >= idle {
+			logger.Info().Uint32("ID", id).Str("Addr", session.RemoteAddr()).Dur("Idle", idle).Msg("Session 空闲超时")
+			session.stopWith(types.CloseIdle)
+			return
+		}
+		if send && ticks%sendEvery == 0 {
+			session.sendProbe()
+		}
+	}
+}
+
+// touch 收到包时刷新空闲时间
+func (session *Session) touch() {
+	session.lastRecv.Store(int64(time.Since(clockStart)))
+}
+
+// idleTime 距离最后收到包的时间
+func (session *Session) idleTime() time.Duration {
+	return time.Since(clockStart) - time.Duration(session.lastRecv.Load())
+}
+
+// setCloseReason 只记录第一个原因
+func (session *Session) setCloseReason(reason types.CloseReason) {
+	session.closeReason.CompareAndSwap(nil, &reason)
+}
+
+// CloseReason 断开的原因，没有记录时为remote
+func (session *Session) CloseReason() types.CloseReason {
+	if reason := session.closeReason.Load(); reason != nil {
+		return *reason
+	}
+	return types.CloseRemote
+}
+
+// stopWith 记录原因后关闭
+func (session *Session) stopWith(reason types.CloseReason) {
+	session.setCloseReason(reason)
+	session.stop()
+}
+
+// Touch 信道收到控制帧(例如websocket的ping、pong)时刷新空闲时间
+func (channel *Channel) Touch() {
+	if session := channel.Session; session != nil {
+		session.touch()
+	}
+}
+
+// ReadFailed 读取失败，读超时记录为idle
+func (channel *Channel) ReadFailed(err error) {
+	var netErr net.Error
+	if session := channel.Session; session != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		session.setCloseReason(types.CloseIdle)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func TestKeepaliveIdle(t *testing.T) {
+	tests := []struct {
+		name string
+		//是否持续收到包
+		active bool
+		closed bool
+	}{
+		{"没有收到包", false, true},
+		{"持续收到包", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//开发者模式下不检查空闲
+			service := newTestService(t, func(conf *gox.AppConf) {
+				conf.Development = false
+				conf.Network.Outside.Keepalive = gox.KeepaliveConf{Initiator: gox.KeepaliveNone, Idle: 1}
+			})
+			ch := &testChannel{addr: "127.0.0.1:20001", stopped: make(chan struct{})}
+			service.OnAccept(ch)
+			session := ch.session.(*Session)
+
+			done := make(chan struct{})
+			fed := make(chan struct{})
+			go func() {
+				defer close(fed)
+				if !tt.active {
+					return
+				}
+				frame := binary.LittleEndian.AppendUint16(nil, 1)
+				frame = append(frame, H_B_S)
+				ticker := time.NewTicker(200 * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-done:
+						return
+					case <-ticker.C:
+						session.parseReader(bytes.NewReader(frame))
+					}
+				}
+			}()
+
+			select {
+			case <-ch.stopped:
+				close(done)
+				<-fed
+				if !tt.closed {
+					t.Fatalf("持续收到包时断开了 %v", session.CloseReason())
+				}
+				if reason := session.CloseReason(); reason != types.CloseIdle {
+					t.Errorf("断开原因 = %v, 应为 %v", reason, types.CloseIdle)
+				}
+			case <-time.After(1600 * time.Millisecond):
+				close(done)
+				<-fed
+				if tt.closed {
+					t.Fatal("超过idle没有收到包时应该断开")
+				}
+				session.stop()
+			}
+			//和真实信道一样在读取协程中回收
+			session.onStop()
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// ipLimiterIdle IP的令牌桶超过这个时间没有使用时清除
+const ipLimiterIdle = time.Minute
+
+type (
+	//bucket 令牌桶，不加锁
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+	//sessionLimits Session的限流状态，只在接收协程中使用
+	sessionLimits struct {
+		msg      bucket
+		bytes    bucket
+		cmds     map[uint32]*bucket
+		lastWarn time.Time
+	}
+	//ipLimiter 每个IP的新连接限流
+	ipLimiter struct {
+		lock      sync.Mutex
+		buckets   map[string]*bucket
+		lastPurge time.Time
+	}
+	//limitStats 超出限制的次数
+	limitStats struct {
+		msg   atomic.Uint64
+		bytes atomic.Uint64
+		cmd   atomic.Uint64
+		conn  atomic.Uint64
+		admit atomic.Uint64
+	}
+)
+
+// allow 取出n个令牌，n超过桶容量时需要桶是满的
+func (b *bucket) allow(n float64, rate int, burst int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	capacity := float64(burst)
+	if burst <= 0 {
+		capacity = float64(rate)
+	}
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*float64(rate))
+	}
+	b.last = now
+	if b.tokens < min(n, capacity) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+func (limits *sessionLimits) reset() {
+	limits.msg = bucket{}
+	limits.bytes = bucket{}
+	limits.cmds = nil
+	limits.lastWarn = time.Time{}
+}
+
+func (limiter *ipLimiter) allow(ip string, rate int, burst int, now time.Time) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if limiter.buckets == nil {
+		limiter.buckets = make(map[string]*bucket)
+	}
+	if now.Sub(limiter.lastPurge) >= ipLimiterIdle {
+		limiter.lastPurge = now
+		for k, b := range limiter.buckets {
+			if now.Sub(b.last) >= ipLimiterIdle {
+				delete(limiter.buckets, k)
+			}
+		}
+	}
+	b, ok := limiter.buckets[ip]
+	if !ok {
+		b = &bucket{}
+		limiter.buckets[ip] = b
+	}
+	return b.allow(1, rate, burst, now)
+}
+
+// allowConn 检查IP的新连接限流
+func (service *Service) allowConn(ip string) bool {
+	limit := service.Conf().Limit
+	if limit.ConnRate <= 0 {
+		return true
+	}
+	if service.connLimiter.allow(ip, limit.ConnRate, limit.ConnBurst, time.Now()) {
+		return true
+	}
+	service.limited.conn.Add(1)
+	if limit.GetAction() == gox.LimitWarn {
+		logger.Warn().Str("IP", ip).Int("Rate", limit.ConnRate).Msg("新连接超出限制")
+		return true
+	}
+	return false
+}
+
+// LimitStats 超出限制的次数
+func (service *Service) LimitStats() types.LimitStats {
+	return types.LimitStats{
+		Msg:   service.limited.msg.Load(),
+		Bytes: service.limited.bytes.Load(),
+		Cmd:   service.limited.cmd.Load(),
+		Conn:  service.limited.conn.Load(),
+		Admit: service.limited.admit.Load(),
+	}
+}
+
+// limitFrame 检查消息数和字节数限流，返回是否处理这个包，需要断开时返回错误
+func (session *Session) limitFrame(n int) (bool, error) {
+	limit := session.service.Conf().Limit
+	if limit.MsgRate <= 0 && limit.ByteRate <= 0 {
+		return true, nil
+	}
+	now := time.Now()
+	limits := &session.limits
+	if !limits.msg.allow(1, limit.MsgRate, limit.MsgBurst, now) {
+		return session.onLimit(limit.GetAction(), &session.service.limited.msg, "消息数超出限制")
+	}
+	if !limits.bytes.allow(float64(n), limit.ByteRate, limit.ByteBurst, now) {
+		return session.onLimit(limit.GetAction(), &session.service.limited.bytes, "字节数超出限制")
+	}
+	return true, nil
+}
+
+// limitCmd 检查CMD绑定的限流
+func (session *Session) limitCmd(cmd uint32) (bool, error) {
+	rate, burst, ok := protoreg.GetLimit(cmd)
+	if !ok || rate <= 0 {
+		return true, nil
+	}
+	limits := &session.limits
+	if limits.cmds == nil {
+		limits.cmds = make(map[uint32]*bucket)
+	}
+	b, ok := limits.cmds[cmd]
+	if !ok {
+		b = &bucket{}
+		limits.cmds[cmd] = b
+	}
+	if b.allow(1, rate, burst, time.Now()) {
+		return true, nil
+	}
+	return session.onLimit(session.service.Conf().Limit.GetAction(), &session.service.limited.cmd, fmt.Sprintf("CMD[%d]超出限制", cmd))
+}
+
+// onLimit 超出限制时计数，按处理方式返回是否继续处理
+func (session *Session) onLimit(action gox.LimitAction, counter *atomic.Uint64, reason string) (bool, error) {
+	counter.Add(1)
+	switch action {
+	case gox.LimitWarn:
+		//每个Session每秒最多输出一次
+		if now := time.Now(); now.Sub(session.limits.lastWarn) >= time.Second {
+			session.limits.lastWarn = now
+			logger.Warn().Uint32("ID", session.id).Str("Addr", session.RemoteAddr()).Msg(reason)
+		}
+		return true, nil
+	case gox.LimitDisconnect:
+		return false, fmt.Errorf("%s，断开连接", reason)
+	default:
+		return false, nil
+	}
+}
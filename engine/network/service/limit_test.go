@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+)
+
+func TestBucket(t *testing.T) {
+	type step struct {
+		//距离上一步经过的时间
+		elapsed time.Duration
+		n       float64
+		want    bool
+	}
+	tests := []struct {
+		name  string
+		rate  int
+		burst int
+		steps []step
+	}{
+		{"rate为0不限制", 0, 0, []step{{0, 1000, true}, {0, 1000, true}}},
+		{"默认容量等于rate", 2, 0, []step{{0, 1, true}, {0, 1, true}, {0, 1, false}}},
+		{"burst允许突发", 1, 3, []step{{0, 1, true}, {0, 1, true}, {0, 1, true}, {0, 1, false}}},
+		{"按rate补充", 10, 0, []step{{0, 10, true}, {0, 1, false}, {500 * time.Millisecond, 5, true}, {0, 1, false}}},
+		{"补充不超过容量", 10, 5, []step{{0, 5, true}, {10 * time.Second, 5, true}, {0, 1, false}}},
+		{"超过容量时需要桶是满的", 4, 0, []step{{0, 1, true}, {0, 10, false}, {250 * time.Millisecond, 10, true}}},
+		{"超过容量后等待补足", 4, 0, []step{{0, 10, true}, {time.Second, 1, false}, {500 * time.Millisecond, 4, false}, {time.Second, 4, true}}},
+		{"不足时不扣除", 2, 0, []step{{0, 1, true}, {0, 2, false}, {0, 1, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{}
+			now := time.Unix(1000, 0)
+			for i, s := range tt.steps {
+				now = now.Add(s.elapsed)
+				if got := b.allow(s.n, tt.rate, tt.burst, now); got != s.want {
+					t.Fatalf("第%d步 allow(%v) = %v, 应为 %v", i, s.n, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIPLimiter(t *testing.T) {
+	limiter := &ipLimiter{}
+	now := time.Unix(1000, 0)
+	if !limiter.allow("1.1.1.1", 1, 0, now) || limiter.allow("1.1.1.1", 1, 0, now) {
+		t.Fatal("同一个IP每秒只允许1个连接")
+	}
+	if !limiter.allow("2.2.2.2", 1, 0, now) {
+		t.Fatal("不同IP分别限流")
+	}
+	//长时间没有使用的IP被清除
+	now = now.Add(ipLimiterIdle)
+	limiter.allow("3.3.3.3", 1, 0, now)
+	if _, ok := limiter.buckets["1.1.1.1"]; ok {
+		t.Error("空闲的IP没有清除")
+	}
+}
+
+func TestLimitAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		action gox.LimitAction
+		//超出限制后是否处理这个包
+		handle     bool
+		disconnect bool
+	}{
+		{"默认丢弃", "", false, false},
+		{"丢弃", gox.LimitDrop, false, false},
+		{"警告后继续处理", gox.LimitWarn, true, false},
+		{"断开", gox.LimitDisconnect, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, _ := newTestSession(t, TagAccept, func(conf *gox.AppConf) {
+				conf.Network.Outside.Limit = gox.LimitConf{MsgRate: 1, ByteRate: 100, Action: tt.action}
+			})
+			if ok, err := session.limitFrame(10); !ok || err != nil {
+				t.Fatalf("没有超出时 = %v %v", ok, err)
+			}
+			//消息数超出
+			ok, err := session.limitFrame(10)
+			if ok != tt.handle || (err != nil) != tt.disconnect {
+				t.Fatalf("消息数超出时 = %v %v", ok, err)
+			}
+			//字节数超出
+			session.limits.msg = bucket{}
+			ok, err = session.limitFrame(200)
+			if ok != tt.handle || (err != nil) != tt.disconnect {
+				t.Fatalf("字节数超出时 = %v %v", ok, err)
+			}
+			stats := session.service.LimitStats()
+			if stats.Msg != 1 || stats.Bytes != 1 {
+				t.Errorf("超出次数 = %+v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"crypto/x509"
+
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// peerIdentity 证书的身份
+func peerIdentity(cert *x509.Certificate) types.PeerIdentity {
+	if cert == nil {
+		return types.PeerIdentity{}
+	}
+	return types.PeerIdentity{CommonName: cert.Subject.CommonName, DNSNames: cert.DNSNames}
+}
+
+// PeerIdentity TLS对端证书的身份，没有开启TLS或对端没有证书时为空
+func (session *Session) PeerIdentity() types.PeerIdentity {
+	if peer, ok := session.getChannel().(interface{ PeerCertificate() *x509.Certificate }); ok {
+		return peerIdentity(peer.PeerCertificate())
+	}
+	return types.PeerIdentity{}
+}
+
+// SetPeerVerifier 设置主动连接时校验对端证书身份的方法，返回错误时不建立连接
+func (service *Service) SetPeerVerifier(fn func(addr string, identity types.PeerIdentity) error) {
+	service.peerVerifier = fn
+}
+
+// VerifyPeer 校验主动连接的对端证书身份，没有设置时不校验
+func (service *Service) VerifyPeer(addr string, cert *x509.Certificate) error {
+	if service.peerVerifier == nil {
+		return nil
+	}
+	return service.peerVerifier(addr, peerIdentity(cert))
+}
@@ -0,0 +1,523 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// 断线恢复，network.outside.resume.grace 大于0时开启，只对接收的连接生效
+// 连接开始时服务端发送 [RESUME_TOKEN][令牌 16字节]
+// 服务端发出的消息包(单向、RPC请求、RPC回应)包装为 [SEQ][序号 uint32][原包]，保留到客户端回复 [ACK][序号 uint32]
+// 断线后Session保留grace秒，期间发送的消息包只放入重发队列，超时后才触发Session断开的回调和事件
+// 客户端重连后第一个包发送 [RESUME][令牌][最后收到的序号 uint32]
+// 成功时回应 [RESUME][1][SessionID uint32] 并重发之后的包，新连接交给原来的Session，客户端继续使用原来的令牌
+// 失败时回应 [RESUME][0]，这个连接作为新的Session使用
+// 客户端发出的包不保留，断线期间没有送达的需要客户端自己处理
+// 主动连接的Session作为客户端，收到SEQ后合并回复ACK，断线后保留令牌，重连同一地址时发送RESUME
+
+const (
+	//令牌长度
+	resumeTokenLen = 16
+	//SEQ包增加的长度
+	seqOverhead = 5
+	//连接者每收到多少个包马上确认
+	resumeAckCount = 32
+	//连接者确认的最长延迟
+	resumeAckDelay = 100 * time.Millisecond
+)
+
+type (
+	//resumeFrame 等待确认的包
+	resumeFrame struct {
+		seq  uint32
+		data []byte
+	}
+	//resumeState 可恢复Session的状态
+	resumeState struct {
+		lock  sync.Mutex
+		token string
+		//最后发出的序号
+		seq uint32
+		//重发队列满时丢弃的最大序号，确认的序号小于它时不能恢复
+		lost   uint32
+		frames []resumeFrame
+		//断线保留中
+		parked bool
+		//进入保留状态或回收时关闭，接管后重新创建
+		parkedSignal chan struct{}
+		parks        uint32
+		timer        *time.Timer
+		//断线前的地址
+		addr string
+	}
+	//resumeTicket 连接者断线后保留的令牌和最后收到的序号
+	resumeTicket struct {
+		token string
+		seq   uint32
+	}
+	//resumeClient 连接者一方的断线恢复状态
+	resumeClient struct {
+		lock sync.Mutex
+		//服务端发来的令牌
+		token string
+		//最后收到和已确认的序号
+		seq   uint32
+		acked uint32
+		timer *time.Timer
+		//等待恢复的回应，期间收到的新令牌先保留
+		resuming *resumeTicket
+		fresh    string
+		released bool
+	}
+)
+
+// push 放入重发队列，队列满时丢弃最早的包
+func (state *resumeState) push(frame resumeFrame, size int) {
+	if len(state.frames) >= size {
+		state.lost = state.frames[0].seq
+		n := copy(state.frames, state.frames[1:])
+		state.frames[n] = resumeFrame{}
+		state.frames = state.frames[:n]
+	}
+	state.frames = append(state.frames, frame)
+}
+
+// ack 移除已确认的包
+func (state *resumeState) ack(seq uint32) {
+	n := 0
+	for n < len(state.frames) && state.frames[n].seq <= seq {
+		n++
+	}
+	if n > 0 {
+		m := copy(state.frames, state.frames[n:])
+		clear(state.frames[m:])
+		state.frames = state.frames[:m]
+	}
+}
+
+// wakeParked 唤醒等待进入保留状态的协程
+func (state *resumeState) wakeParked() {
+	select {
+	case <-state.parkedSignal:
+	default:
+		close(state.parkedSignal)
+	}
+}
+
+// initResume 开启断线恢复时生成令牌并发给客户端
+func (session *Session) initResume() {
+	if session.IsConnector() {
+		session.initResumeClient()
+		return
+	}
+	if session.service.Conf().Resume.GetGrace() <= 0 {
+		return
+	}
+	token := make([]byte, resumeTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		logger.Error().Err(err).Msg("Session 生成恢复令牌失败")
+		return
+	}
+	state := &resumeState{token: string(token), parkedSignal: make(chan struct{})}
+	session.resume = state
+	session.service.addResume(state.token, session)
+	go session.sendToken(session.id, token)
+}
+
+// sendToken 开启加密时握手完成后才发送
+func (session *Session) sendToken(id uint32, token []byte) {
+	defer app.Recover()
+	if session.id != id {
+		return
+	}
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(RESUME_TOKEN)
+	pkt.AppendBytes(token)
+	session.sendPacket(pkt)
+}
+
+// sendMessage 发送消息包，可恢复的Session加上序号并保留到确认，断线保留中只放入重发队列
+func (session *Session) sendMessage(pkt *ByteArray) {
+	session.stats.msgsOut.Add(1)
+	state := session.resume
+	if state == nil {
+		session.sendPacket(pkt)
+		return
+	}
+	frame := session.newPacket()
+	defer frame.Release()
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.seq++
+	frame.AppendByte(SEQ)
+	frame.AppendUint32(state.seq)
+	frame.AppendBytes(pkt.data)
+	state.push(resumeFrame{seq: state.seq, data: bytes.Clone(frame.data)}, session.service.Conf().Resume.GetBuffer())
+	if !state.parked {
+		session.sendPacket(frame)
+	}
+}
+
+// onAck 客户端确认收到的序号
+func (session *Session) onAck(seq uint32) {
+	if state := session.resume; state != nil {
+		state.lock.Lock()
+		state.ack(seq)
+		state.lock.Unlock()
+	}
+}
+
+// onResume 客户端用令牌恢复断线前的Session，成功后这个临时Session已回收，不触发断开的事件
+func (session *Session) onResume(pkt *ByteArray) {
+	if session.IsConnector() {
+		session.onResumeReply(pkt)
+		return
+	}
+	if session.resume == nil || pkt.RemainLength() < resumeTokenLen+4 {
+		return
+	}
+	token := string(pkt.ReadBytes(resumeTokenLen))
+	ack := pkt.ReadUint32()
+	if !session.service.resume(session, token, ack) {
+		logger.Info().Uint32("ID", session.id).Str("Addr", session.RemoteAddr()).Msg("Session 恢复失败，使用新的Session")
+		session.replyResume(false)
+	}
+}
+
+func (session *Session) replyResume(ok bool) {
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(RESUME)
+	if ok {
+		pkt.AppendByte(1)
+		pkt.AppendUint32(session.id)
+	} else {
+		pkt.AppendByte(0)
+	}
+	session.sendPacket(pkt)
+}
+
+// park 信道断开时保留Session，不能保留时返回false
+func (session *Session) park() bool {
+	state, service := session.resume, session.service
+	if state == nil || session.closing.Load() || !service.IsRun || service.IsStopAccept {
+		return false
+	}
+	grace := service.Conf().Resume.GetGrace()
+	if grace <= 0 {
+		return false
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.addr = session.RemoteAddr()
+	state.parked = true
+	state.wakeParked()
+	state.parks++
+	parks := state.parks
+	state.timer = time.AfterFunc(grace, func() { session.expire(state, parks) })
+	session.closeReason.Store(nil)
+	//保留加密状态，恢复时替换为新连接的
+	session.link.Store(&sessionLink{secure: session.getSecure()})
+	session.frags.reset()
+	logger.Debug().Uint32("ID", session.id).Str("Addr", state.addr).Dur("Grace", grace).Msg("Session 断线保留")
+	return true
+}
+
+// expire 保留超时后回收，parks为0时不检查是第几次保留
+func (session *Session) expire(state *resumeState, parks uint32) {
+	state.lock.Lock()
+	if !state.parked || (parks != 0 && state.parks != parks) {
+		state.lock.Unlock()
+		return
+	}
+	state.parked = false
+	state.lock.Unlock()
+	session.setCloseReason(types.CloseExpired)
+	logger.Debug().Uint32("ID", session.id).Msg("Session 断线保留超时")
+	session.release()
+}
+
+// waitParked 旧连接还没有断开时先关闭，等待进入保留状态
+func (session *Session) waitParked(state *resumeState) bool {
+	state.lock.Lock()
+	parked, signal, channel := state.parked, state.parkedSignal, session.getChannel()
+	state.lock.Unlock()
+	if parked {
+		return true
+	}
+	if channel == nil || session.resume != state {
+		return false
+	}
+	channel.Stop()
+	timer := time.NewTimer(session.handshakeTimeout())
+	defer timer.Stop()
+	select {
+	case <-signal:
+	case <-timer.C:
+		return false
+	}
+	//没有保留而是回收时也会唤醒
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.parked
+}
+
+// takeOver 接管临时Session的连接，重发确认序号之后的包，返回断线前的地址
+func (session *Session) takeOver(temp *Session, ack uint32) (string, bool) {
+	state := session.resume
+	if state == nil || !session.waitParked(state) {
+		return "", false
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if !state.parked || session.resume != state {
+		return "", false
+	}
+	if ack < state.lost || ack > state.seq {
+		//需要的包已经丢弃，不能恢复
+		go session.expire(state, 0)
+		return "", false
+	}
+	state.timer.Stop()
+	state.parked = false
+	state.parkedSignal = make(chan struct{})
+	state.ack(ack)
+	link := temp.link.Load()
+	channel := link.channel
+	session.link.Store(&sessionLink{channel: channel, secure: link.secure})
+	session.received.Store(true)
+	session.touch()
+	channel.SetSession(session)
+	session.replyResume(true)
+	for _, frame := range state.frames {
+		pkt := session.newPacket()
+		pkt.AppendBytes(frame.data)
+		session.sendPacket(pkt)
+		pkt.Release()
+	}
+	return state.addr, true
+}
+
+// addResume 登记令牌
+func (service *Service) addResume(token string, session *Session) {
+	service.resumeMutex.Lock()
+	service.resumes[token] = session
+	service.resumeMutex.Unlock()
+}
+
+// delResume 注销令牌
+func (service *Service) delResume(token string, session *Session) {
+	service.resumeMutex.Lock()
+	if service.resumes[token] == session {
+		delete(service.resumes, token)
+	}
+	service.resumeMutex.Unlock()
+}
+
+// resume 令牌对应的Session接管临时Session的连接，临时Session回收
+func (service *Service) resume(temp *Session, token string, ack uint32) bool {
+	service.resumeMutex.Lock()
+	target := service.resumes[token]
+	service.resumeMutex.Unlock()
+	if target == nil || target == temp {
+		return false
+	}
+	oldAddr, ok := target.takeOver(temp, ack)
+	if !ok {
+		return false
+	}
+	addr, tempID := temp.RemoteAddr(), temp.ID()
+	logger.Info().Uint32("ID", target.ID()).Uint32("TempID", tempID).Str("Addr", addr).Str("OldAddr", oldAddr).Msg("Session 断线恢复")
+	temp.detach()
+	service.addrMutex.Lock()
+	if service.addrToSession[oldAddr] == target {
+		delete(service.addrToSession, oldAddr)
+	}
+	service.addrToSession[addr] = target
+	service.addrMutex.Unlock()
+	//连接数改为按新地址计算
+	service.ReleaseAdmit(oldAddr)
+	service.reserveAdmit(addr)
+	evt := service.sessionEvent(target)
+	evt.TempID = tempID
+	service.App().Event.Run(gox.EventSessionResumed, evt)
+	return true
+}
+
+// initResumeClient 连接者保留了这个地址的令牌时先请求恢复
+func (session *Session) initResumeClient() {
+	client := &resumeClient{}
+	if ticket, ok := session.service.takeTicket(session.RemoteAddr()); ok {
+		client.resuming = &ticket
+		go session.sendResume(session.id, ticket)
+	}
+	session.resumeClient = client
+}
+
+// sendResume 开启加密时握手完成后才发送
+func (session *Session) sendResume(id uint32, ticket resumeTicket) {
+	defer app.Recover()
+	if session.id != id {
+		return
+	}
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(RESUME)
+	pkt.AppendBytes([]byte(ticket.token))
+	pkt.AppendUint32(ticket.seq)
+	session.sendPacket(pkt)
+}
+
+// onResumeToken 连接者收到服务端的令牌
+func (session *Session) onResumeToken(token []byte) {
+	client := session.resumeClient
+	if client == nil || len(token) != resumeTokenLen {
+		return
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if client.resuming != nil {
+		client.fresh = string(token)
+	} else if client.token == "" {
+		client.token = string(token)
+	}
+}
+
+// onResumeReply 恢复成功时继续使用原来的令牌和序号，失败时使用新的令牌
+func (session *Session) onResumeReply(pkt *ByteArray) {
+	client := session.resumeClient
+	if client == nil || pkt.RemainLength() < 1 {
+		return
+	}
+	ok := pkt.ReadOneByte() == 1
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	ticket := client.resuming
+	if ticket == nil {
+		return
+	}
+	client.resuming = nil
+	if ok {
+		client.token = ticket.token
+		client.seq, client.acked = ticket.seq, ticket.seq
+		logger.Info().Uint32("ID", session.id).Str("Addr", session.RemoteAddr()).Msg("Session 断线恢复")
+	} else {
+		client.token = client.fresh
+		logger.Info().Uint32("ID", session.id).Str("Addr", session.RemoteAddr()).Msg("Session 恢复失败，使用新的Session")
+		session.scheduleAck(client)
+	}
+	client.fresh = ""
+}
+
+// onSeq 连接者收到SEQ包，恢复后重复的包返回false
+func (session *Session) onSeq(seq uint32) bool {
+	client := session.resumeClient
+	if client == nil {
+		return true
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	//等待回应期间收到的是临时Session的包，不能确认
+	if client.resuming != nil {
+		client.seq = seq
+		return true
+	}
+	if seq <= client.seq {
+		return false
+	}
+	client.seq = seq
+	session.scheduleAck(client)
+	return true
+}
+
+// scheduleAck 合并确认，需要持有client.lock
+func (session *Session) scheduleAck(client *resumeClient) {
+	if client.seq == client.acked {
+		return
+	}
+	if client.seq-client.acked >= resumeAckCount {
+		session.flushAck(client)
+		return
+	}
+	if client.timer == nil {
+		client.timer = time.AfterFunc(resumeAckDelay, func() {
+			client.lock.Lock()
+			defer client.lock.Unlock()
+			client.timer = nil
+			if !client.released && client.resuming == nil {
+				session.flushAck(client)
+			}
+		})
+	}
+}
+
+// flushAck 发送确认，需要持有client.lock
+func (session *Session) flushAck(client *resumeClient) {
+	if client.timer != nil {
+		client.timer.Stop()
+		client.timer = nil
+	}
+	if client.seq == client.acked {
+		return
+	}
+	client.acked = client.seq
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(ACK)
+	pkt.AppendUint32(client.seq)
+	session.sendPacket(pkt)
+}
+
+// saveTicket 连接者断线时保留令牌，主动关闭的不保留
+func (session *Session) saveTicket() {
+	client, service := session.resumeClient, session.service
+	if client == nil || session.closing.Load() || !service.IsRun {
+		return
+	}
+	client.lock.Lock()
+	ticket := resumeTicket{token: client.token, seq: client.seq}
+	if client.resuming != nil {
+		//没有收到回应，下次继续用原来的令牌
+		ticket = *client.resuming
+	}
+	client.lock.Unlock()
+	if ticket.token == "" {
+		return
+	}
+	service.resumeMutex.Lock()
+	service.tickets[session.RemoteAddr()] = ticket
+	service.resumeMutex.Unlock()
+}
+
+// releaseResumeClient 停止确认的定时器
+func (session *Session) releaseResumeClient() {
+	if client := session.resumeClient; client != nil {
+		client.lock.Lock()
+		client.released = true
+		if client.timer != nil {
+			client.timer.Stop()
+			client.timer = nil
+		}
+		client.lock.Unlock()
+		session.resumeClient = nil
+	}
+}
+
+// takeTicket 取出连接这个地址时保留的令牌
+func (service *Service) takeTicket(addr string) (resumeTicket, bool) {
+	service.resumeMutex.Lock()
+	defer service.resumeMutex.Unlock()
+	ticket, ok := service.tickets[addr]
+	if ok {
+		delete(service.tickets, addr)
+	}
+	return ticket, ok
+}
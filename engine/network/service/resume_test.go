@@ -0,0 +1,443 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func withResume(conf *gox.AppConf) {
+	conf.Network.Outside.Resume = gox.ResumeConf{Grace: 5, Buffer: 4}
+}
+
+// waitFrame 等待发出指定类型的包
+func waitFrame(t *testing.T, ch *testChannel, session *Session, typ byte) []byte {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, body := range ch.take(t, session) {
+			if body[0] == typ {
+				return body
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("没有发出类型为 0x%02X 的包", typ)
+	return nil
+}
+
+// seqs 发出的SEQ包的序号
+func seqs(bodys [][]byte) []uint32 {
+	var list []uint32
+	for _, body := range bodys {
+		if body[0] == SEQ {
+			list = append(list, binary.LittleEndian.Uint32(body[1:5]))
+		}
+	}
+	return list
+}
+
+func resumePacket(token []byte, ack uint32) []byte {
+	buf := append([]byte{RESUME}, token...)
+	return binary.LittleEndian.AppendUint32(buf, ack)
+}
+
+func TestResumeTakeOver(t *testing.T) {
+	service := newTestService(t, withResume)
+	var (
+		lock   sync.Mutex
+		closed []uint32
+	)
+	resumed := make(chan gox.SessionEvent, 1)
+	service.App().Event.On(gox.EventSessionClosed, func(evt gox.SessionEvent) {
+		lock.Lock()
+		closed = append(closed, evt.ID)
+		lock.Unlock()
+	})
+	service.App().Event.On(gox.EventSessionResumed, func(evt gox.SessionEvent) {
+		resumed <- evt
+	})
+
+	oldCh := &testChannel{addr: "127.0.0.1:20001"}
+	service.OnAccept(oldCh)
+	target := oldCh.session.(*Session)
+	token := waitFrame(t, oldCh, target, RESUME_TOKEN)[1:]
+	target.Send(rawCmd, []byte("m1"))
+	target.Send(rawCmd, []byte("m2"))
+	if got := seqs(oldCh.take(t, target)); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("发出的序号 = %v", got)
+	}
+
+	//断线后发送的包只放入重发队列
+	target.onStop()
+	target.Send(rawCmd, []byte("m3"))
+	if frames := oldCh.take(t, target); len(frames) != 0 {
+		t.Fatalf("断线保留中发出了 %d 个包", len(frames))
+	}
+
+	newCh := &testChannel{addr: "127.0.0.1:20002"}
+	service.OnAccept(newCh)
+	temp := newCh.session.(*Session)
+	tempID := temp.ID()
+	waitFrame(t, newCh, temp, RESUME_TOKEN)
+	temp.parseMsg(resumePacket(token, 1))
+
+	bodys := newCh.take(t, target)
+	if len(bodys) == 0 || bodys[0][0] != RESUME || bodys[0][1] != 1 || binary.LittleEndian.Uint32(bodys[0][2:]) != target.ID() {
+		t.Fatalf("恢复回应 = %v", bodys)
+	}
+	if got := seqs(bodys); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("重发的序号 = %v, 应为 [2 3]", got)
+	}
+	if newCh.session != target {
+		t.Error("新连接没有交给原来的Session")
+	}
+	if service.GetSessionById(tempID) != nil {
+		t.Error("临时Session没有移除")
+	}
+	service.addrMutex.RLock()
+	if service.addrToSession[newCh.addr] != target {
+		t.Error("新地址没有指向原来的Session")
+	}
+	if _, ok := service.addrToSession[oldCh.addr]; ok {
+		t.Error("旧地址没有移除")
+	}
+	service.addrMutex.RUnlock()
+
+	select {
+	case evt := <-resumed:
+		if evt.ID != target.ID() || evt.TempID != tempID || evt.RemoteAddr != newCh.addr {
+			t.Errorf("恢复事件 = %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("没有收到恢复事件")
+	}
+	//事件按顺序派发，临时Session的断开事件会在恢复事件之前
+	lock.Lock()
+	defer lock.Unlock()
+	if len(closed) != 0 {
+		t.Errorf("触发了断开事件 %v", closed)
+	}
+}
+
+// TestResumeTakeOverSend 恢复的同时发送，用 -race 检查信道和加密状态的替换
+func TestResumeTakeOverSend(t *testing.T) {
+	service := newTestService(t, func(conf *gox.AppConf) {
+		conf.Network.Outside.Resume = gox.ResumeConf{Grace: 5, Buffer: 1024}
+	})
+	oldCh := &testChannel{addr: "127.0.0.1:20001"}
+	service.OnAccept(oldCh)
+	target := oldCh.session.(*Session)
+	token := waitFrame(t, oldCh, target, RESUME_TOKEN)[1:]
+	target.onStop()
+
+	newCh := &testChannel{addr: "127.0.0.1:20002"}
+	service.OnAccept(newCh)
+	temp := newCh.session.(*Session)
+	waitFrame(t, newCh, temp, RESUME_TOKEN)
+
+	const (
+		senders = 4
+		count   = 100
+	)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < count; j++ {
+				target.Send(rawCmd, []byte("m"))
+				target.RemoteAddr()
+				target.PeerIdentity()
+			}
+		}()
+	}
+	close(start)
+	temp.parseMsg(resumePacket(token, 0))
+	wg.Wait()
+
+	//断线保留中的包重发，之后的包直接发出，序号连续不重复
+	got := seqs(newCh.take(t, target))
+	if len(got) != senders*count {
+		t.Fatalf("新连接收到 %d 个包, 应为 %d", len(got), senders*count)
+	}
+	for i, seq := range got {
+		if seq != uint32(i+1) {
+			t.Fatalf("第%d个包的序号 = %d", i, seq)
+		}
+	}
+	if frames := oldCh.take(t, target); len(frames) != 0 {
+		t.Errorf("旧连接发出了 %d 个包", len(frames))
+	}
+}
+
+func TestResumeStatePush(t *testing.T) {
+	tests := []struct {
+		name   string
+		pushes uint32
+		ack    uint32
+		seqs   []uint32
+		lost   uint32
+	}{
+		{"没有满", 3, 0, []uint32{1, 2, 3}, 0},
+		{"满了丢弃最早的", 6, 0, []uint32{3, 4, 5, 6}, 2},
+		{"确认一部分", 3, 2, []uint32{3}, 0},
+		{"全部确认", 3, 3, nil, 0},
+		{"确认已丢弃的", 6, 1, []uint32{3, 4, 5, 6}, 2},
+		{"确认后不再丢弃", 6, 4, []uint32{5, 6}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &resumeState{}
+			for seq := uint32(1); seq <= tt.pushes; seq++ {
+				state.push(resumeFrame{seq: seq}, 4)
+			}
+			state.ack(tt.ack)
+			var got []uint32
+			for _, frame := range state.frames {
+				got = append(got, frame.seq)
+			}
+			if len(got) != len(tt.seqs) {
+				t.Fatalf("队列 = %v, 应为 %v", got, tt.seqs)
+			}
+			for i := range got {
+				if got[i] != tt.seqs[i] {
+					t.Fatalf("队列 = %v, 应为 %v", got, tt.seqs)
+				}
+			}
+			if state.lost != tt.lost {
+				t.Errorf("lost = %d, 应为 %d", state.lost, tt.lost)
+			}
+		})
+	}
+}
+
+func TestResumeAck(t *testing.T) {
+	service := newTestService(t, withResume)
+	ch := &testChannel{}
+	service.OnAccept(ch)
+	session := ch.session.(*Session)
+	for range 3 {
+		session.Send(rawCmd, []byte("m"))
+	}
+	session.parseMsg(binary.LittleEndian.AppendUint32([]byte{ACK}, 2))
+	state := session.resume
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if len(state.frames) != 1 || state.frames[0].seq != 3 {
+		t.Errorf("确认后重发队列 = %v", state.frames)
+	}
+}
+
+func TestResumeLost(t *testing.T) {
+	service := newTestService(t, withResume)
+	closed := make(chan gox.SessionEvent, 1)
+	service.App().Event.On(gox.EventSessionClosed, func(evt gox.SessionEvent) {
+		closed <- evt
+	})
+
+	oldCh := &testChannel{addr: "127.0.0.1:20001"}
+	service.OnAccept(oldCh)
+	target := oldCh.session.(*Session)
+	targetID := target.ID()
+	token := waitFrame(t, oldCh, target, RESUME_TOKEN)[1:]
+	//超出重发队列，序号1、2已丢弃
+	for range 6 {
+		target.Send(rawCmd, []byte("m"))
+	}
+	target.onStop()
+
+	newCh := &testChannel{addr: "127.0.0.1:20002"}
+	service.OnAccept(newCh)
+	temp := newCh.session.(*Session)
+	waitFrame(t, newCh, temp, RESUME_TOKEN)
+	temp.parseMsg(resumePacket(token, 1))
+	if body := waitFrame(t, newCh, temp, RESUME); len(body) != 2 || body[1] != 0 {
+		t.Fatalf("恢复回应 = %v, 应为失败", body)
+	}
+	if newCh.session != temp {
+		t.Error("恢复失败后新连接应继续使用临时Session")
+	}
+
+	//不能恢复的Session马上回收，不等保留超时
+	select {
+	case evt := <-closed:
+		if evt.ID != targetID || evt.Reason != types.CloseExpired {
+			t.Errorf("断开事件 = %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("没有回收不能恢复的Session")
+	}
+	if service.GetSessionById(targetID) != nil {
+		t.Error("不能恢复的Session没有移除")
+	}
+}
+
+func TestResumeBeforeDisconnect(t *testing.T) {
+	service := newTestService(t, withResume)
+	//旧连接还没有发现断线，恢复时先关闭旧连接
+	oldCh := &testChannel{addr: "127.0.0.1:20001", notifyStop: true}
+	service.OnAccept(oldCh)
+	target := oldCh.session.(*Session)
+	token := waitFrame(t, oldCh, target, RESUME_TOKEN)[1:]
+	target.Send(rawCmd, []byte("m1"))
+
+	newCh := &testChannel{addr: "127.0.0.1:20002"}
+	service.OnAccept(newCh)
+	temp := newCh.session.(*Session)
+	waitFrame(t, newCh, temp, RESUME_TOKEN)
+	start := time.Now()
+	temp.parseMsg(resumePacket(token, 0))
+	if elapsed := time.Since(start); elapsed > target.handshakeTimeout()/2 {
+		t.Errorf("等待旧连接断开用了 %v", elapsed)
+	}
+	bodys := newCh.take(t, target)
+	if len(bodys) == 0 || bodys[0][0] != RESUME || bodys[0][1] != 1 {
+		t.Fatalf("恢复回应 = %v", bodys)
+	}
+	if got := seqs(bodys); len(got) != 1 || got[0] != 1 {
+		t.Errorf("重发的序号 = %v, 应为 [1]", got)
+	}
+	if newCh.session != target {
+		t.Error("新连接没有交给原来的Session")
+	}
+}
+
+// seqPacket 服务端发出的SEQ包，包着一个心跳，连接者处理后回复H_B_R
+func seqPacket(seq uint32) []byte {
+	buf := binary.LittleEndian.AppendUint32([]byte{SEQ}, seq)
+	return append(buf, H_B_S)
+}
+
+// count 统计指定类型的包，返回最后一个
+func count(bodys [][]byte, typ byte) (int, []byte) {
+	n, last := 0, []byte(nil)
+	for _, body := range bodys {
+		if body[0] == typ {
+			n, last = n+1, body
+		}
+	}
+	return n, last
+}
+
+// newTestConnector 主动连接的Session使用chs中的testChannel
+func newTestConnector(t *testing.T, chs ...*testChannel) *Service {
+	service := newTestService(t, nil)
+	service.ConnectChannelFunc = func(addr string) types.IChannel {
+		ch := chs[0]
+		chs = chs[1:]
+		return ch
+	}
+	return service
+}
+
+func TestResumeClientAck(t *testing.T) {
+	ch := &testChannel{}
+	service := newTestConnector(t, ch)
+	session := service.GetSessionByAddr(ch.RemoteAddr()).(*Session)
+
+	//没有达到数量时延迟合并确认
+	for seq := uint32(1); seq < resumeAckCount; seq++ {
+		session.parseMsg(seqPacket(seq))
+	}
+	if n, _ := count(ch.take(t, session), ACK); n != 0 {
+		t.Fatalf("没有达到数量时马上确认了 %d 次", n)
+	}
+	time.Sleep(resumeAckDelay * 2)
+	if n, body := count(ch.take(t, session), ACK); n != 1 || binary.LittleEndian.Uint32(body[1:]) != resumeAckCount-1 {
+		t.Fatalf("延迟确认 %d 次, 最后的包 %v", n, body)
+	}
+
+	//达到数量时马上确认
+	for seq := uint32(resumeAckCount); seq < resumeAckCount*2; seq++ {
+		session.parseMsg(seqPacket(seq))
+	}
+	bodys := ch.take(t, session)
+	if n, body := count(bodys, ACK); n != 1 || binary.LittleEndian.Uint32(body[1:]) != resumeAckCount*2-1 {
+		t.Fatalf("确认 %d 次, 最后的包 %v", n, body)
+	}
+	if n, _ := count(bodys, H_B_R); n != resumeAckCount {
+		t.Errorf("处理了 %d 个包, 应为 %d", n, resumeAckCount)
+	}
+
+	//重复的包丢弃
+	session.parseMsg(seqPacket(resumeAckCount))
+	if n, _ := count(ch.take(t, session), H_B_R); n != 0 {
+		t.Error("处理了重复的包")
+	}
+}
+
+func TestResumeClientReconnect(t *testing.T) {
+	token := bytes.Repeat([]byte{1}, resumeTokenLen)
+	fresh := bytes.Repeat([]byte{2}, resumeTokenLen)
+	tests := []struct {
+		name string
+		ok   bool
+		//恢复后使用的令牌
+		token []byte
+		//恢复后第一个不重复的序号
+		next uint32
+	}{
+		{"恢复成功", true, token, 4},
+		{"恢复失败", false, fresh, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldCh, newCh := &testChannel{}, &testChannel{}
+			service := newTestConnector(t, oldCh, newCh)
+			session := service.GetSessionByAddr(oldCh.RemoteAddr()).(*Session)
+			session.parseMsg(append([]byte{RESUME_TOKEN}, token...))
+			for seq := uint32(1); seq <= 3; seq++ {
+				session.parseMsg(seqPacket(seq))
+			}
+			session.onStop()
+
+			session = service.GetSessionByAddr(newCh.RemoteAddr()).(*Session)
+			body := waitFrame(t, newCh, session, RESUME)
+			if !bytes.Equal(body[1:1+resumeTokenLen], token) || binary.LittleEndian.Uint32(body[1+resumeTokenLen:]) != 3 {
+				t.Fatalf("恢复请求 = %v", body)
+			}
+			//等待回应期间收到新连接的令牌和临时Session的包
+			session.parseMsg(append([]byte{RESUME_TOKEN}, fresh...))
+			session.parseMsg(seqPacket(1))
+			if tt.ok {
+				session.parseMsg(binary.LittleEndian.AppendUint32([]byte{RESUME, 1}, 9))
+			} else {
+				session.parseMsg([]byte{RESUME, 0})
+			}
+			newCh.take(t, session)
+
+			session.parseMsg(seqPacket(tt.next - 1))
+			session.parseMsg(seqPacket(tt.next))
+			if n, _ := count(newCh.take(t, session), H_B_R); n != 1 {
+				t.Errorf("处理了 %d 个包, 应为 1", n)
+			}
+			client := session.resumeClient
+			client.lock.Lock()
+			defer client.lock.Unlock()
+			if client.token != string(tt.token) {
+				t.Errorf("令牌 = %v, 应为 %v", []byte(client.token), tt.token)
+			}
+		})
+	}
+}
+
+func TestResumeClientClose(t *testing.T) {
+	ch := &testChannel{}
+	service := newTestConnector(t, ch)
+	session := service.GetSessionByAddr(ch.RemoteAddr()).(*Session)
+	session.parseMsg(append([]byte{RESUME_TOKEN}, make([]byte, resumeTokenLen)...))
+	//主动关闭的不保留令牌
+	session.Close()
+	session.onStop()
+	if _, ok := service.takeTicket(ch.RemoteAddr()); ok {
+		t.Error("主动关闭后保留了令牌")
+	}
+}
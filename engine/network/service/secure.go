@@ -0,0 +1,171 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// |-----------------------------------------------------|
+// 开启加密的服务在连接建立后先握手，连接者先发送，接收者回应
+// type   0x07
+// key    X25519公钥
+// random 随机数，和双方公钥一起派生密钥
+// |-----------------------------------------------------|
+// [header]  [ type ]  [ key  ]  [random]
+// [header]  [ byte ]  [32byte]  [16byte]
+// |-----------------------------------------------------|
+// 握手完成后每个包体都用AES-GCM加密，seq从1开始递增，接收端只接受下一个seq
+// [header]  [ seq  ]  [ciphertext+tag]
+// [header]  [uint64]  [   [n]byte    ]
+// |-----------------------------------------------------|
+// 只做密钥交换不验证对端身份，需要防中间人时使用TLS
+
+const (
+	handshakeRandomLen = 16
+	//加密后增加的长度 seq+tag
+	secureOverhead = 8 + 16
+)
+
+type (
+	//secure 会话加密状态
+	secure struct {
+		//发送锁，保证seq和写入顺序一致
+		lock     sync.Mutex
+		priv     *ecdh.PrivateKey
+		random   []byte
+		sendAEAD cipher.AEAD
+		recvAEAD cipher.AEAD
+		sendSeq  uint64
+		recvSeq  uint64
+		ready    chan struct{}
+	}
+)
+
+func newSecure() (*secure, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	random := make([]byte, handshakeRandomLen)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &secure{priv: priv, random: random, ready: make(chan struct{})}, nil
+}
+
+// hello 握手包内容
+func (sec *secure) hello() []byte {
+	return append(sec.priv.PublicKey().Bytes(), sec.random...)
+}
+
+// isReady 是否已完成握手
+func (sec *secure) isReady() bool {
+	select {
+	case <-sec.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait 等待握手完成
+func (sec *secure) wait(timeout time.Duration) bool {
+	select {
+	case <-sec.ready:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// establish 通过对端的握手包派生两个方向的密钥
+func (sec *secure) establish(peerHello []byte, isConnector bool) error {
+	if len(peerHello) != 32+handshakeRandomLen {
+		return errors.New("握手包长度错误")
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(peerHello[:32])
+	if err != nil {
+		return err
+	}
+	shared, err := sec.priv.ECDH(peerKey)
+	if err != nil {
+		return err
+	}
+	//salt按 连接者hello+接收者hello 排列，两端一致
+	local := sec.hello()
+	salt := append(append([]byte(nil), peerHello...), local...)
+	if isConnector {
+		salt = append(append([]byte(nil), local...), peerHello...)
+	}
+	prk := hmacSum(salt, shared)
+	c2s, err := newAEAD(hmacSum(prk, []byte("gox c2s\x01")))
+	if err != nil {
+		return err
+	}
+	s2c, err := newAEAD(hmacSum(prk, []byte("gox s2c\x01")))
+	if err != nil {
+		return err
+	}
+	if isConnector {
+		sec.sendAEAD, sec.recvAEAD = c2s, s2c
+	} else {
+		sec.sendAEAD, sec.recvAEAD = s2c, c2s
+	}
+	sec.priv = nil
+	close(sec.ready)
+	return nil
+}
+
+// seal 加密包体，需要持有lock
+func (sec *secure) seal(body []byte) []byte {
+	sec.sendSeq++
+	out := make([]byte, 8, 8+len(body)+sec.sendAEAD.Overhead())
+	binary.BigEndian.PutUint64(out, sec.sendSeq)
+	return sec.sendAEAD.Seal(out, nonce(sec.sendSeq), body, out[:8])
+}
+
+// open 解密包体，seq不是下一个时视为重放
+func (sec *secure) open(buf []byte) ([]byte, error) {
+	if len(buf) < secureOverhead {
+		return nil, errors.New("加密包长度错误")
+	}
+	seq := binary.BigEndian.Uint64(buf[:8])
+	if seq != sec.recvSeq+1 {
+		return nil, fmt.Errorf("加密包序号错误 seq:%d 需要:%d", seq, sec.recvSeq+1)
+	}
+	body, err := sec.recvAEAD.Open(nil, nonce(seq), buf[8:], buf[:8])
+	if err != nil {
+		return nil, err
+	}
+	sec.recvSeq = seq
+	return body, nil
+}
+
+func nonce(seq uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func hmacSum(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// newSecurePair 创建两端并完成握手
+func newSecurePair(t *testing.T) (*secure, *secure) {
+	t.Helper()
+	connector, err := newSecure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accept, err := newSecure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectorHello, acceptHello := connector.hello(), accept.hello()
+	if err := accept.establish(connectorHello, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.establish(acceptHello, true); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.isReady() || !accept.isReady() {
+		t.Fatal("握手后没有就绪")
+	}
+	return connector, accept
+}
+
+func TestSecureRoundTrip(t *testing.T) {
+	connector, accept := newSecurePair(t)
+	for i, body := range [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{0xAB}, 4096)} {
+		sealed := connector.seal(body)
+		if len(sealed) != len(body)+secureOverhead {
+			t.Fatalf("加密后长度 = %d, 应为 %d", len(sealed), len(body)+secureOverhead)
+		}
+		if len(body) > 0 && bytes.Contains(sealed, body) {
+			t.Fatal("加密后包含明文")
+		}
+		opened, err := accept.open(sealed)
+		if err != nil {
+			t.Fatalf("第%d个包解密失败 %v", i, err)
+		}
+		if !bytes.Equal(opened, body) {
+			t.Fatalf("第%d个包解密后不一致", i)
+		}
+	}
+	//两个方向的密钥不同，自己加密的包自己解不开
+	reply := accept.seal([]byte("reply"))
+	if _, err := accept.open(reply); err == nil {
+		t.Fatal("同一端能解密自己发送的包")
+	}
+	if opened, err := connector.open(reply); err != nil || string(opened) != "reply" {
+		t.Fatalf("回应解密失败 %q %v", opened, err)
+	}
+}
+
+func TestSecureReject(t *testing.T) {
+	tests := []struct {
+		name string
+		//返回需要被拒绝的包
+		frame func(connector *secure, accept *secure) []byte
+	}{
+		{"重放", func(connector *secure, accept *secure) []byte {
+			sealed := connector.seal([]byte("a"))
+			if _, err := accept.open(sealed); err != nil {
+				t.Fatal(err)
+			}
+			return sealed
+		}},
+		{"跳过序号", func(connector *secure, accept *secure) []byte {
+			connector.seal([]byte("a"))
+			return connector.seal([]byte("b"))
+		}},
+		{"修改密文", func(connector *secure, accept *secure) []byte {
+			sealed := connector.seal([]byte("hello"))
+			sealed[8] ^= 0x01
+			return sealed
+		}},
+		{"修改tag", func(connector *secure, accept *secure) []byte {
+			sealed := connector.seal([]byte("hello"))
+			sealed[len(sealed)-1] ^= 0x01
+			return sealed
+		}},
+		{"修改序号", func(connector *secure, accept *secure) []byte {
+			sealed := connector.seal([]byte("hello"))
+			sealed[0] ^= 0x80
+			return sealed
+		}},
+		{"长度不足", func(connector *secure, accept *secure) []byte {
+			return connector.seal(nil)[:secureOverhead-1]
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector, accept := newSecurePair(t)
+			if _, err := accept.open(tt.frame(connector, accept)); err == nil {
+				t.Fatal("应该拒绝")
+			}
+		})
+	}
+}
+
+func TestSecureEstablishInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		hello []byte
+	}{
+		{"长度不足", make([]byte, 32+handshakeRandomLen-1)},
+		{"长度过长", make([]byte, 32+handshakeRandomLen+1)},
+		{"低阶公钥", make([]byte, 32+handshakeRandomLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sec, err := newSecure()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sec.establish(tt.hello, true); err == nil {
+				t.Fatal("应该握手失败")
+			}
+			if sec.isReady() {
+				t.Fatal("握手失败后不应就绪")
+			}
+		})
+	}
+}
+
+// feed 把信道已发送的包交给对端读取，返回最后一次读取的结果
+func feed(t *testing.T, from *testChannel, to *Session) (bool, error) {
+	t.Helper()
+	from.lock.Lock()
+	frames := from.frames
+	from.frames = nil
+	from.lock.Unlock()
+	if len(frames) == 0 {
+		t.Fatal("没有发送数据")
+	}
+	var (
+		closed bool
+		err    error
+	)
+	for _, frame := range frames {
+		if closed, err = to.parseReader(bytes.NewReader(frame)); closed {
+			break
+		}
+	}
+	return closed, err
+}
+
+func TestSessionHandshake(t *testing.T) {
+	withEncrypt := func(conf *gox.AppConf) {
+		conf.Network.Outside.Encrypt = true
+	}
+	tests := []struct {
+		name string
+		//修改握手后发送的包，返回是否应该被拒绝
+		modify func(frame []byte) bool
+	}{
+		{"正常", func(frame []byte) bool { return false }},
+		{"修改密文", func(frame []byte) bool {
+			frame[len(frame)-1] ^= 0x01
+			return true
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector, connectorCh := newTestSession(t, TagConnector, withEncrypt)
+			accept, acceptCh := newTestSession(t, TagAccept, withEncrypt)
+			connector.start()
+			accept.start()
+			if closed, err := feed(t, connectorCh, accept); closed {
+				t.Fatal(err)
+			}
+			if closed, err := feed(t, acceptCh, connector); closed {
+				t.Fatal(err)
+			}
+			if !connector.getSecure().isReady() || !accept.getSecure().isReady() {
+				t.Fatal("握手没有完成")
+			}
+
+			payload := []byte("encrypted payload")
+			if !connector.Send(rawCmd, payload) {
+				t.Fatal("发送失败")
+			}
+			connectorCh.lock.Lock()
+			frame := connectorCh.frames[0]
+			connectorCh.lock.Unlock()
+			if bytes.Contains(frame, payload) {
+				t.Fatal("发送的包包含明文")
+			}
+			reject := tt.modify(frame)
+			closed, _ := feed(t, connectorCh, accept)
+			if closed != reject {
+				t.Fatalf("断开 = %v, 应为 %v", closed, reject)
+			}
+			if reject {
+				if reason := accept.CloseReason(); reason != types.CloseProtocol {
+					t.Errorf("断开原因 = %v", reason)
+				}
+				return
+			}
+			select {
+			case data := <-rawMessages:
+				if !bytes.Equal(data, payload) {
+					t.Errorf("解密后的内容不一致 %q", data)
+				}
+			default:
+				t.Fatal("没有收到消息")
+			}
+			//重放同一个包
+			connectorCh.lock.Lock()
+			connectorCh.frames = [][]byte{frame}
+			connectorCh.lock.Unlock()
+			if closed, _ := feed(t, connectorCh, accept); !closed {
+				t.Fatal("重放的包应该断开")
+			}
+		})
+	}
+}
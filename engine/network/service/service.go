@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/types"
 )
@@ -11,18 +14,46 @@ import (
 type (
 	//Service 服务器
 	Service struct {
+		app                *gox.App
 		codec              types.ICodec
 		ConnectChannelFunc func(addr string) types.IChannel
 		AcceptWg           sync.WaitGroup
 		IsRun              bool
+		//已停止接收新连接
+		IsStopAccept bool
 
 		addr           string
+		interior       bool
 		idToSession    map[uint32]*Session //Accept Map
 		idMutex        sync.RWMutex
 		addrToSession  map[string]*Session //Connect Map
 		addrMutex      sync.RWMutex
+		userToSession  map[uint64]*Session //BindUser Map
+		userMutex      sync.RWMutex
 		sessionWg      sync.WaitGroup
-		delSessionFunc func(uint32)
+		delSessionLock sync.RWMutex
+		delSessionFns  []func(uint32)
+		//处理中的消息数量
+		handling int32
+		//服务的协议拦截器
+		interceptors    []types.ProtoInterceptor
+		interceptorLock sync.RWMutex
+		//每个IP的新连接限流
+		connLimiter ipLimiter
+		//超出限制的次数
+		limited limitStats
+		//接收连接的计数和检查
+		admission admission
+		//断线恢复的令牌
+		resumes     map[string]*Session
+		resumeMutex sync.Mutex
+		//连接者断线后保留的令牌，重连同一地址时恢复
+		tickets map[string]resumeTicket
+		//pool方式的处理协程池
+		pool     *workerPool
+		poolLock sync.Mutex
+		//主动连接时校验对端证书身份
+		peerVerifier func(string, types.PeerIdentity) error
 	}
 )
 
@@ -38,7 +69,34 @@ func (service *Service) Init(addr string, codec types.ICodec) {
 	service.addr = addr
 	service.idToSession = make(map[uint32]*Session)
 	service.addrToSession = make(map[string]*Session)
+	service.userToSession = make(map[uint64]*Session)
+	service.resumes = make(map[string]*Session)
+	service.tickets = make(map[string]resumeTicket)
 }
+
+// SetApp 设置所属的App，需要在Init之前调用
+func (service *Service) SetApp(app *gox.App) {
+	service.app = app
+}
+
+// App 所属的App，没有设置时为默认App
+func (service *Service) App() *gox.App {
+	if service.app == nil {
+		return gox.Default
+	}
+	return service.app
+}
+
+// SetInterior 标记为内部服务，使用network.interior配置
+func (service *Service) SetInterior(interior bool) {
+	service.interior = interior
+}
+
+// Conf 服务的网络配置
+func (service *Service) Conf() gox.ServiceConf {
+	return service.App().Conf().Network.ServiceConf(service.interior)
+}
+
 func (service *Service) Codec() types.ICodec {
 	return service.codec
 }
@@ -59,6 +117,7 @@ func (service *Service) OnAccept(channel types.IChannel) {
 		service.addrToSession[session.RemoteAddr()] = session
 		service.addrMutex.Unlock()
 		session.start()
+		service.App().Event.Run(gox.EventSessionAccepted, service.sessionEvent(session))
 	}
 }
 
@@ -73,6 +132,32 @@ func (service *Service) GetSessionById(sid uint32) types.ISession {
 	return nil
 }
 
+// GetSessionByUser 通过绑定的用户标识获取Session
+func (service *Service) GetSessionByUser(uid uint64) types.ISession {
+	defer service.userMutex.RUnlock()
+	service.userMutex.RLock()
+	if session, ok := service.userToSession[uid]; ok {
+		return session
+	}
+	return nil
+}
+
+// bindUser 绑定用户标识，已绑定到其他Session时改为绑定到此Session
+func (service *Service) bindUser(session *Session, uid uint64) {
+	defer service.userMutex.Unlock()
+	service.userMutex.Lock()
+	if old := session.userID.Load(); old != 0 && service.userToSession[old] == session {
+		delete(service.userToSession, old)
+	}
+	if uid != 0 {
+		if other, ok := service.userToSession[uid]; ok && other != session {
+			other.userID.Store(0)
+		}
+		service.userToSession[uid] = session
+	}
+	session.userID.Store(uid)
+}
+
 // 通过addr地址获取Session
 func (service *Service) GetSessionByAddr(addr string) types.ISession {
 
@@ -96,33 +181,117 @@ func (service *Service) GetSessionByAddr(addr string) types.ISession {
 	service.addrToSession[addr] = session
 	service.addrMutex.Unlock()
 	session.start()
+	if !session.waitSecure() {
+		logger.Error().Str("Addr", addr).Msg("Session 握手超时")
+		session.setCloseReason(types.CloseHandshake)
+		session.Close()
+		return nil
+	}
 	return session
 }
 
+// Sessions 获取所有Session
+func (service *Service) Sessions() []types.ISession {
+	defer service.idMutex.RUnlock()
+	service.idMutex.RLock()
+	list := make([]types.ISession, 0, len(service.idToSession))
+	for _, session := range service.idToSession {
+		list = append(list, session)
+	}
+	return list
+}
+
 // Stop 停止服务
 func (service *Service) Stop() {
-	service.delSessionFunc = nil
+	service.delSessionLock.Lock()
+	service.delSessionFns = nil
+	service.delSessionLock.Unlock()
 	service.idMutex.Lock()
 	for k := range service.idToSession {
-		service.idToSession[k].stop()
+		service.idToSession[k].stopWith(types.CloseShutdown)
 	}
 	service.idMutex.Unlock()
 	service.sessionWg.Wait()
+	service.stopWorkerPool()
+}
+
+// Wait 等待处理中的消息完成，超时返回false
+func (service *Service) Wait(ctx context.Context) bool {
+	for atomic.LoadInt32(&service.handling) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
 }
 
+// Use 添加服务的协议拦截器，在全局拦截器之后、CMD拦截器之前执行
+func (service *Service) Use(interceptors ...types.ProtoInterceptor) {
+	service.interceptorLock.Lock()
+	service.interceptors = append(service.interceptors, interceptors...)
+	service.interceptorLock.Unlock()
+}
+
+func (service *Service) getInterceptors() []types.ProtoInterceptor {
+	defer service.interceptorLock.RUnlock()
+	service.interceptorLock.RLock()
+	return service.interceptors
+}
+
+// LinstenByDelSession 监听Session断开，可以添加多个回调
 func (service *Service) LinstenByDelSession(callback func(uint32)) {
-	service.delSessionFunc = callback
+	service.delSessionLock.Lock()
+	service.delSessionFns = append(service.delSessionFns, callback)
+	service.delSessionLock.Unlock()
 }
 
-func (service *Service) delSession(session types.ISession) {
-	if service.delSessionByID(session.ID()) && service.delSessionByAddr(session.RemoteAddr()) {
-		if service.delSessionFunc != nil {
-			go service.delSessionFunc(session.ID())
+func (service *Service) delSession(session *Session) {
+	if service.removeSession(session) {
+		service.delSessionLock.RLock()
+		fns := service.delSessionFns
+		service.delSessionLock.RUnlock()
+		for _, fn := range fns {
+			go fn(session.ID())
 		}
+		evt := service.sessionEvent(session)
+		evt.Reason = session.CloseReason()
+		service.App().Event.Run(gox.EventSessionClosed, evt)
+		service.sessionWg.Done()
+	}
+}
+
+// detachSession 移除Session，不触发断开的回调和事件
+func (service *Service) detachSession(session *Session) {
+	if service.removeSession(session) {
 		service.sessionWg.Done()
 	}
 }
 
+// removeSession 从服务中移除Session，已经移除时返回false
+func (service *Service) removeSession(session *Session) bool {
+	if !service.delSessionByID(session.ID()) || !service.delSessionByAddr(session.RemoteAddr()) {
+		return false
+	}
+	service.delSessionByUser(session)
+	if session.GetTag() == TagAccept {
+		service.ReleaseAdmit(session.RemoteAddr())
+	}
+	return true
+}
+
+// sessionEvent Session会被回收，事件只带信息
+func (service *Service) sessionEvent(session *Session) gox.SessionEvent {
+	return gox.SessionEvent{
+		ID:         session.ID(),
+		RemoteAddr: session.RemoteAddr(),
+		Tag:        session.GetTagName(),
+		Interior:   service.interior,
+		UserID:     session.UserID(),
+	}
+}
+
 func (service *Service) delSessionByID(id uint32) bool {
 	defer service.idMutex.Unlock()
 	service.idMutex.Lock()
@@ -143,6 +312,14 @@ func (service *Service) delSessionByAddr(addr string) bool {
 	return false
 }
 
+func (service *Service) delSessionByUser(session *Session) {
+	defer service.userMutex.Unlock()
+	service.userMutex.Lock()
+	if uid := session.userID.Load(); uid != 0 && service.userToSession[uid] == session {
+		delete(service.userToSession, uid)
+	}
+}
+
 func (service *Service) onConnect(addr string) *Session {
 	channel := service.ConnectChannelFunc(addr)
 	if channel != nil {
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/codec"
+	"github.com/xhaoh94/gox/engine/network/compress"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	//testChannel 记录发送的数据，不连接网络
+	testChannel struct {
+		lock    sync.Mutex
+		frames  [][]byte
+		session types.ISession
+		//对端地址，为空时使用127.0.0.1:20000
+		addr string
+		//Stop后像真实的信道一样通知Session断开
+		notifyStop bool
+		//不为nil时Stop后关闭
+		stopped chan struct{}
+	}
+)
+
+func (ch *testChannel) Start() {}
+func (ch *testChannel) Stop() {
+	if ch.stopped != nil {
+		close(ch.stopped)
+	}
+	if ch.notifyStop {
+		go ch.session.(*Session).onStop()
+	}
+}
+func (ch *testChannel) Send(data []byte) {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	ch.frames = append(ch.frames, bytes.Clone(data))
+}
+func (ch *testChannel) Flush(time.Duration) bool     { return true }
+func (ch *testChannel) QueueStats() types.QueueStats { return types.QueueStats{} }
+func (ch *testChannel) RemoteAddr() string {
+	if ch.addr == "" {
+		return "127.0.0.1:20000"
+	}
+	return ch.addr
+}
+func (ch *testChannel) LocalAddr() string                 { return "127.0.0.1:10000" }
+func (ch *testChannel) SetSession(session types.ISession) { ch.session = session }
+
+// take 取出已发送的包，去掉包头
+func (ch *testChannel) take(t *testing.T, session *Session) [][]byte {
+	t.Helper()
+	ch.lock.Lock()
+	frames := ch.frames
+	ch.frames = nil
+	ch.lock.Unlock()
+	header := session.service.Conf().FrameHeader
+	bodys := make([][]byte, 0, len(frames))
+	for _, frame := range frames {
+		r := bytes.NewReader(frame)
+		msglen, err := readFrameLen(r, header, session.endian())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(msglen) != r.Len() {
+			t.Fatalf("包头长度[%d]和包体长度[%d]不一致", msglen, r.Len())
+		}
+		bodys = append(bodys, frame[len(frame)-r.Len():])
+	}
+	return bodys
+}
+
+// newTestService 创建不监听的服务，setup可以修改配置
+func newTestService(t *testing.T, setup func(conf *gox.AppConf)) *Service {
+	t.Helper()
+	conf := gox.AppConf{AppID: 1, AppType: "test", InteriorAddr: "127.0.0.1:10000", Development: true, Network: gox.NetworkConf{Endian: binary.LittleEndian}}
+	if setup != nil {
+		setup(&conf)
+	}
+	app := gox.NewApp()
+	if err := app.InitConf(conf); err != nil {
+		t.Fatal(err)
+	}
+	service := &Service{}
+	service.SetApp(app)
+	service.Init("127.0.0.1:10000", codec.MsgPack)
+	service.IsRun = true
+	return service
+}
+
+// newTestSession 创建使用testChannel的Session，setup可以修改配置
+func newTestSession(t *testing.T, tag Tag, setup func(conf *gox.AppConf)) (*Session, *testChannel) {
+	t.Helper()
+	service := newTestService(t, setup)
+	ch := &testChannel{}
+	session := &Session{}
+	session.init(1, service, ch, tag)
+	return session, ch
+}
+
+// gzipCmd 绑定gzip压缩，阈值512
+const gzipCmd uint32 = 90102
+
+func init() {
+	protoreg.BindCodec(gzipCmd, rawCodec{})
+	protoreg.BindCompress(gzipCmd, compress.Gzip, 512)
+	protoreg.Register(gzipCmd, func(ctx context.Context, session types.ISession, req *rawMessage) {
+		rawMessages <- req.data
+	})
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	random := make([]byte, 256)
+	rand.Read(random)
+	tests := []struct {
+		name      string
+		cmd       uint32
+		threshold int
+		payload   []byte
+		//包类型带有压缩标记
+		compressed bool
+	}{
+		{"小于阈值不压缩", rawCmd, 256, make([]byte, 255), false},
+		{"达到阈值压缩", rawCmd, 256, make([]byte, 256), true},
+		{"压缩后没有变小不压缩", rawCmd, 128, random, false},
+		{"阈值为0不压缩", rawCmd, 0, make([]byte, 1024), false},
+		{"CMD绑定的阈值优先", gzipCmd, 0, make([]byte, 512), true},
+		{"CMD绑定的阈值以下不压缩", gzipCmd, 128, make([]byte, 511), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := func(conf *gox.AppConf) {
+				conf.Network.CompressThreshold = tt.threshold
+			}
+			sender, sendCh := newTestSession(t, TagConnector, setup)
+			receiver, _ := newTestSession(t, TagAccept, setup)
+			if !sender.Send(tt.cmd, tt.payload) {
+				t.Fatal("发送失败")
+			}
+			bodys := sendCh.take(t, sender)
+			if len(bodys) != 1 {
+				t.Fatalf("发送了 %d 个包", len(bodys))
+			}
+			body := bodys[0]
+			if compressed := body[0]&FLAG_COMPRESS != 0; compressed != tt.compressed {
+				t.Fatalf("压缩标记 = %v, 应为 %v", compressed, tt.compressed)
+			}
+			if body[0]&^FLAG_COMPRESS != C_S_C {
+				t.Errorf("包类型 = 0x%02X", body[0])
+			}
+			if bodyLen := len(body) - 5; tt.compressed == (bodyLen == len(tt.payload)) {
+				t.Errorf("消息体长度 = %d, 原长度 %d", bodyLen, len(tt.payload))
+			}
+			receiver.parseMsg(body)
+			select {
+			case data := <-rawMessages:
+				if !bytes.Equal(data, tt.payload) {
+					t.Errorf("解压后的内容不一致 len = %d", len(data))
+				}
+			default:
+				t.Fatal("没有收到消息")
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xhaoh94/gox"
@@ -15,7 +17,7 @@ import (
 	"github.com/xhaoh94/gox/examples/uxgame/game"
 
 	"github.com/xhaoh94/gox/engine/helper/cmdhelper"
-	"github.com/xhaoh94/gox/engine/helper/codechelper"
+	"github.com/xhaoh94/gox/engine/network/compress"
 	"github.com/xhaoh94/gox/engine/network/protoreg"
 	"github.com/xhaoh94/gox/engine/network/rpc"
 	"github.com/xhaoh94/gox/engine/types"
@@ -26,10 +28,47 @@ type (
 	Session struct {
 		SessionTag
 		id            uint32
+		app           *gox.App
 		service       *Service
-		channel       types.IChannel
 		ctx           context.Context
 		ctxCancelFunc context.CancelFunc
+		fragOps       uint32
+		frags         fragments
+		//信道和加密状态，断线保留和恢复时整体替换，发送时只读取一次
+		link atomic.Pointer[sessionLink]
+		//派发到其他协程的消息处理持有读锁，release持有写锁
+		taskLock sync.RWMutex
+		//session方式的处理队列，不关闭，处理协程在ctx取消后退出
+		serialLock sync.Mutex
+		serial     chan func()
+		//属性
+		attrLock sync.RWMutex
+		attrs    map[string]any
+		//绑定的用户标识
+		userID atomic.Uint64
+		//限流状态
+		limits sessionLimits
+		//已收到完整的包
+		received atomic.Bool
+		//断线恢复状态，没有开启时为nil
+		resume *resumeState
+		//连接者一方的断线恢复状态
+		resumeClient *resumeClient
+		//服务端主动关闭，不保留
+		closing atomic.Bool
+		//连接质量和流量统计
+		stats sessionStats
+		//最后收到包的时间
+		lastRecv atomic.Int64
+		//断开的原因
+		closeReason atomic.Pointer[types.CloseReason]
+		//处理中的RPC请求
+		calls callCancels
+	}
+	//sessionLink 信道和它的加密状态
+	sessionLink struct {
+		channel types.IChannel
+		secure  *secure
 	}
 )
 
@@ -39,6 +78,21 @@ const (
 	C_S_C        byte = 0x03
 	RPC_REQUIRE  byte = 0x04
 	RPC_RESPONSE byte = 0x05
+	FRAGMENT     byte = 0x06
+	HANDSHAKE    byte = 0x07
+	RESUME_TOKEN byte = 0x08
+	RESUME       byte = 0x09
+	SEQ          byte = 0x0A
+	ACK          byte = 0x0B
+	//带截止时间的RPC请求，见call.go
+	RPC_REQUIRE_DEADLINE byte = 0x0C
+	RPC_CANCEL           byte = 0x0D
+
+	//包类型的标记位，消息体已压缩
+	FLAG_COMPRESS byte = 0x80
+
+	//关闭连接时等待发送队列写完的最长时间
+	closeFlushTimeout = time.Second
 )
 
 // 获取id
@@ -46,64 +100,238 @@ func (session *Session) ID() uint32 {
 	return session.id
 }
 
-// 链接地址
+// 链接地址，断线保留中为断线前的地址
 func (session *Session) RemoteAddr() string {
-	return session.channel.RemoteAddr()
+	if channel := session.getChannel(); channel != nil {
+		return channel.RemoteAddr()
+	}
+	if state := session.resume; state != nil {
+		return state.addr
+	}
+	return ""
 }
 
 // 本地地址
 func (session *Session) LocalAddr() string {
-	return session.channel.LocalAddr()
+	if channel := session.getChannel(); channel != nil {
+		return channel.LocalAddr()
+	}
+	return ""
 }
 
 // 初始化
 func (session *Session) init(id uint32, service *Service, channel types.IChannel, t Tag) {
+	session.taskLock.Lock()
 	session.id = id
-	session.channel = channel
+	session.taskLock.Unlock()
+	session.link.Store(&sessionLink{channel: channel})
 	session.tag = t
 	session.service = service
-	session.ctx, session.ctxCancelFunc = context.WithCancel(gox.Ctx)
-	session.channel.SetSession(session)
+	session.app = service.App()
+	session.ctx, session.ctxCancelFunc = context.WithCancel(session.app.Ctx)
+	channel.SetSession(session)
+}
+
+// getChannel 当前的信道，断线保留中为nil
+func (session *Session) getChannel() types.IChannel {
+	if link := session.link.Load(); link != nil {
+		return link.channel
+	}
+	return nil
+}
+
+// getSecure 加密状态，没有开启加密时为nil
+func (session *Session) getSecure() *secure {
+	if link := session.link.Load(); link != nil {
+		return link.secure
+	}
+	return nil
 }
 
 // 启动
 func (session *Session) start() {
-	session.channel.Start()
-	if session.IsConnector() && !gox.Config.Development { //如果是连接者 启动心跳发送
-		go session.onHeartbeat()
+	channel := session.getChannel()
+	if session.service.Conf().Encrypt {
+		sec, err := newSecure()
+		if err != nil {
+			logger.Error().Err(err).Msg("Session 创建加密状态失败")
+			session.setCloseReason(types.CloseHandshake)
+			channel.Start()
+			channel.Stop()
+			return
+		}
+		session.link.Store(&sessionLink{channel: channel, secure: sec})
+	}
+	channel.Start()
+	session.initResume()
+	if session.getSecure() != nil {
+		if session.IsConnector() { //连接者先发起握手
+			session.sendHello()
+		} else {
+			session.closeIfNotReady(session.handshakeTimeout())
+		}
+	}
+	session.startKeepalive()
+	if timeout := session.service.Conf().Admit.GetFirstFrameTimeout(); timeout > 0 && !session.IsConnector() {
+		session.closeIfNoFrame(timeout)
+	}
+}
+
+// waitSecure 等待握手完成，没有开启加密时直接返回
+func (session *Session) waitSecure() bool {
+	sec := session.getSecure()
+	return sec == nil || sec.wait(session.handshakeTimeout())
+}
+
+func (session *Session) handshakeTimeout() time.Duration {
+	if timeout := session.app.Conf().Network.ConnectTimeout; timeout > 0 {
+		return timeout
 	}
+	return 3 * time.Second
 }
 
-// 关闭
+// closeIfNotReady 超时没有完成握手时断开
+func (session *Session) closeIfNotReady(timeout time.Duration) {
+	id, sec := session.id, session.getSecure()
+	time.AfterFunc(timeout, func() {
+		if session.id == id && !sec.isReady() {
+			logger.Warn().Uint32("ID", id).Msg("Session 握手超时")
+			session.setCloseReason(types.CloseHandshake)
+			session.Close()
+		}
+	})
+}
+
+// sendHello 发送握手包，不加密
+func (session *Session) sendHello() {
+	link := session.link.Load()
+	if link == nil || link.secure == nil {
+		return
+	}
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(HANDSHAKE)
+	pkt.AppendBytes(link.secure.hello())
+	session.sendData(link.channel, pkt.Data())
+}
+
+// onHandshake 处理握手包，接收者回应后两端都派生密钥
+func (session *Session) onHandshake(buf []byte) (bool, error) {
+	if len(buf) == 0 || buf[0] != HANDSHAKE {
+		session.setCloseReason(types.CloseHandshake)
+		return true, errors.New("Session 没有完成握手")
+	}
+	sec := session.getSecure()
+	if session.IsConnector() {
+		if err := sec.establish(buf[1:], true); err != nil {
+			session.setCloseReason(types.CloseHandshake)
+			return true, err
+		}
+		return false, nil
+	}
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+	session.sendHello()
+	if err := sec.establish(buf[1:], false); err != nil {
+		session.setCloseReason(types.CloseHandshake)
+		return true, err
+	}
+	return false, nil
+}
+
+// 关闭，断线保留中的直接回收
 func (session *Session) stop() {
 	if !session.isAct() {
 		return
 	}
-	session.channel.Stop()
+	session.closing.Store(true)
+	if channel := session.getChannel(); channel != nil {
+		channel.Stop()
+	} else if state := session.resume; state != nil {
+		go session.expire(state, 0)
+	}
 }
 
-// 关闭连接
+// 关闭连接，先等待发送队列写完
 func (session *Session) Close() {
+	if !session.isAct() {
+		return
+	}
+	session.setCloseReason(types.CloseLocal)
+	if channel := session.getChannel(); channel != nil {
+		channel.Flush(closeFlushTimeout)
+	}
 	session.stop()
 }
 
+// QueueStats 发送队列状态
+func (session *Session) QueueStats() types.QueueStats {
+	channel := session.getChannel()
+	if !session.isAct() || channel == nil {
+		return types.QueueStats{}
+	}
+	return channel.QueueStats()
+}
+
+// Set 设置属性，Session回收时自动清除
+func (session *Session) Set(key string, value any) {
+	defer session.attrLock.Unlock()
+	session.attrLock.Lock()
+	if session.attrs == nil {
+		session.attrs = make(map[string]any)
+	}
+	session.attrs[key] = value
+}
+
+// Get 获取属性
+func (session *Session) Get(key string) (any, bool) {
+	defer session.attrLock.RUnlock()
+	session.attrLock.RLock()
+	value, ok := session.attrs[key]
+	return value, ok
+}
+
+// Delete 删除属性
+func (session *Session) Delete(key string) {
+	defer session.attrLock.Unlock()
+	session.attrLock.Lock()
+	delete(session.attrs, key)
+}
+
+// BindUser 绑定用户标识，同一个服务内通过GetSessionByUser查找，0为解除绑定
+func (session *Session) BindUser(uid uint64) {
+	if !session.isAct() {
+		return
+	}
+	session.service.bindUser(session, uid)
+}
+
+// UserID 绑定的用户标识，没有绑定时为0
+func (session *Session) UserID() uint64 {
+	return session.userID.Load()
+}
+
 // 发送
 func (session *Session) Send(cmd uint32, require any) bool {
 	if !session.isAct() {
 		return false
 	}
-	pkt := NewByteArray(session.endian())
+	pkt := session.newPacket()
 	defer pkt.Release()
 	pkt.AppendByte(C_S_C)
 	pkt.AppendUint32(cmd)
-	if err := pkt.AppendMessage(require, session.Codec(cmd)); err != nil {
+	if err := session.appendMessage(pkt, cmd, require); err != nil {
 		return false
 	}
-	session.sendData(pkt.Data())
+	if err := session.checkPacket(pkt); err != nil {
+		logger.Error().Uint32("CMD", cmd).Err(err).Msg("Session Send: 发送失败")
+		return false
+	}
+	session.sendMessage(pkt)
 	return true
 }
 
-// 呼叫
+// 呼叫，按network.rpc_timeout等待回应
 func (session *Session) Call(require any, response any) error {
 	cmd := cmdhelper.ToCmd(require, response, 0)
 	return session.CallByCmd(cmd, require, response)
@@ -113,24 +341,9 @@ func (session *Session) CallByCmd(cmd uint32, require any, response any) error {
 	if !session.isAct() {
 		return errors.New("session not active")
 	}
-	if cmd == 0 {
-		return errors.New("cmd == 0 ")
-	}
-
-	pkt := NewByteArray(session.endian())
-	defer pkt.Release()
-	pkt.AppendByte(RPC_REQUIRE)
-	pkt.AppendUint32(cmd)
-	rpcID := rpc.AssignID()
-	pkt.AppendUint32(rpcID)
-	if err := pkt.AppendMessage(require, session.Codec(cmd)); err != nil {
-		return err
-	}
-	rpx := rpc.NewRpx(session.ctx, rpcID, response)
-	session.rpc().Put(rpx)
-	session.sendData(pkt.Data())
-	err := rpx.Await()
-	return err
+	ctx, cancel := rpc.WithDefaultTimeout(context.Background(), session.app.Conf().Network.GetRpcTimeout())
+	defer cancel()
+	return session.CallByCmdCtx(ctx, cmd, require, response)
 }
 
 // 回应
@@ -140,20 +353,98 @@ func (session *Session) reply(cmd uint32, response any, rpcid uint32) bool {
 	if !session.isAct() {
 		return false
 	}
-	pkt := NewByteArray(session.endian())
+	pkt := session.newPacket()
 	defer pkt.Release()
 	pkt.AppendByte(RPC_RESPONSE)
 	pkt.AppendUint32(cmd)
 	pkt.AppendUint32(rpcid)
-	if err := pkt.AppendMessage(response, session.Codec(cmd)); err != nil {
+	if err := session.appendMessage(pkt, cmd, response); err != nil {
 		return false
 	}
-	session.sendData(pkt.Data())
+	if err := session.checkPacket(pkt); err != nil {
+		logger.Error().Uint32("CMD", cmd).Err(err).Msg("Session Reply: 回应失败")
+		return false
+	}
+	session.sendMessage(pkt)
 	return true
 }
 
-func (session *Session) sendData(buf []byte) {
-	if !session.isAct() {
+// newPacket 创建使用服务包头格式的包
+func (session *Session) newPacket() *ByteArray {
+	pkt := NewByteArray(session.endian())
+	pkt.SetFrameHeader(session.service.Conf().FrameHeader)
+	return pkt
+}
+
+// checkPacket 检查包体长度，不能超出分片重组的上限
+func (session *Session) checkPacket(pkt *ByteArray) error {
+	conf := &session.app.Conf().Network
+	length := int(pkt.Length())
+	if session.resume != nil {
+		length += seqOverhead
+	}
+	if maxLen := conf.GetFragmentMaxLen(); length > maxLen {
+		return fmt.Errorf("包体长度[%d]超出分片上限[%d]", length, maxLen)
+	}
+	return nil
+}
+
+// frameMaxLen 单个包体的最大长度，需要扣除加密增加的长度
+func (session *Session) frameMaxLen(header gox.FrameHeader) int {
+	frameMax := session.app.Conf().Network.GetFrameMaxLen(header)
+	if session.getSecure() != nil {
+		frameMax -= secureOverhead
+	}
+	return frameMax
+}
+
+// sendPacket 加上包头发送，超过单包长度时拆成分片包
+func (session *Session) sendPacket(pkt *ByteArray) {
+	if !session.waitSecure() {
+		logger.Warn().Uint32("ID", session.id).Msg("Session 没有完成握手，丢弃发送")
+		return
+	}
+	frameMax := session.frameMaxLen(pkt.header)
+	if int(pkt.Length()) <= frameMax {
+		session.writeFrame(pkt)
+		return
+	}
+	data := pkt.data
+	chunkLen := frameMax - fragmentOverhead
+	count := (len(data) + chunkLen - 1) / chunkLen
+	id := atomic.AddUint32(&session.fragOps, 1)
+	for i := 0; i < count && session.isAct(); i++ {
+		end := min((i+1)*chunkLen, len(data))
+		frag := session.newPacket()
+		frag.AppendByte(FRAGMENT)
+		frag.AppendUint32(id)
+		frag.AppendUint32(uint32(i))
+		frag.AppendUint32(uint32(count))
+		frag.AppendBytes(data[i*chunkLen : end])
+		session.writeFrame(frag)
+		frag.Release()
+	}
+}
+
+// writeFrame 握手完成后加密包体，加上包头写入信道，信道和加密状态使用同一次读取的
+func (session *Session) writeFrame(pkt *ByteArray) {
+	link := session.link.Load()
+	if link == nil || link.channel == nil { //断线保留中
+		return
+	}
+	sec := link.secure
+	if sec == nil {
+		session.sendData(link.channel, pkt.Data())
+		return
+	}
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+	pkt.data = sec.seal(pkt.data)
+	session.sendData(link.channel, pkt.Data())
+}
+
+func (session *Session) sendData(channel types.IChannel, buf []byte) {
+	if !session.isAct() || channel == nil {
 		return
 	}
 
@@ -166,58 +457,44 @@ func (session *Session) sendData(buf []byte) {
 	// }
 	// str += "]"
 	// logger.Debug().Msg(str)
-	session.channel.Send(buf)
+	session.stats.bytesOut.Add(uint64(len(buf)))
+	channel.Send(buf)
 }
 
 func (s *Session) isAct() bool {
 	return s.id != 0
 }
 
-// 心跳
-func (session *Session) onHeartbeat() {
-	defer app.Recover()
-	id := session.id
-	for session.id != 0 && session.id == id {
-		select {
-		case <-session.ctx.Done():
-			goto end
-		case <-time.After(gox.Config.Network.Heartbeat):
-			session.sendHeartbeat(H_B_S, 0) //发送空的心跳包
-		}
-	}
-end:
-}
-func (session *Session) sendHeartbeat(t byte, l uint32) {
+// replyHeartbeat 原样回应心跳的内容
+func (session *Session) replyHeartbeat(payload []byte) {
 	defer app.Recover()
 	if !session.isAct() {
 		return
 	}
-	pkt := NewByteArray(session.endian())
+	pkt := session.newPacket()
 	defer pkt.Release()
-	pkt.AppendByte(t)
-	if l > 0 {
-		logger.Debug().Int64("time", time.Now().UnixMilli()).Msg("H_B_S")
-		pkt.AppendInt64(time.Now().UnixMilli())
-	}
-	session.sendData(pkt.Data())
+	pkt.AppendByte(H_B_R)
+	pkt.AppendBytes(payload)
+	session.sendPacket(pkt)
 }
 
 func (session *Session) parseReader(r io.Reader) (bool, error) {
 	if !session.isAct() {
 		return true, errors.New("Session已关闭")
 	}
-	header := make([]byte, 2)
-	_, err := io.ReadFull(r, header)
+	header := session.service.Conf().FrameHeader
+	msglen, err := readFrameLen(r, header, session.endian())
 	if err != nil {
 		return true, err
 	}
-	msglen := codechelper.BytesTo[uint16](header, session.endian())
 	if msglen == 0 {
+		session.setCloseReason(types.CloseProtocol)
 		return true, errors.New("读取到网络空包")
 	}
 
-	readMaxLen := gox.Config.Network.ReadMsgMaxLen
-	if readMaxLen > 0 && int(msglen) > readMaxLen {
+	readMaxLen := session.app.Conf().Network.GetReadMsgMaxLen(header)
+	if readMaxLen > 0 && int64(msglen) > int64(readMaxLen) {
+		session.setCloseReason(types.CloseProtocol)
 		return true, errors.New("网络包体超出界限")
 	}
 
@@ -226,6 +503,8 @@ func (session *Session) parseReader(r io.Reader) (bool, error) {
 	if err != nil {
 		return true, err
 	}
+	session.touch()
+	session.stats.bytesIn.Add(frameLen(header, msglen))
 
 	// str := "["
 	// for i, v := range header {
@@ -241,39 +520,95 @@ func (session *Session) parseReader(r io.Reader) (bool, error) {
 	// str += "]"
 	// logger.Debug().Msg(str)
 
-	session.parseMsg(buf)
+	if sec := session.getSecure(); sec != nil {
+		if !sec.isReady() {
+			return session.onHandshake(buf)
+		}
+		if buf, err = sec.open(buf); err != nil {
+			session.setCloseReason(types.CloseProtocol)
+			return true, err
+		}
+	}
+	//先解密再限流，丢弃的包不影响加密序号
+	if ok, err := session.limitFrame(int(msglen)); !ok {
+		if err != nil {
+			session.setCloseReason(types.CloseLimit)
+		}
+		return err != nil, err
+	}
+	//解密并解析成功后才算收到有效的包
+	if session.parseMsg(buf) {
+		session.received.Store(true)
+	}
 	return false, nil
 }
 
-// parseMsg 解析包
-func (session *Session) parseMsg(buf []byte) {
+// parseMsg 解析包，返回是否是有效的包，未知的类型和解析失败时返回false
+func (session *Session) parseMsg(buf []byte) bool {
 	defer app.Recover()
 	if !session.isAct() {
-		return
+		return false
 	}
 
 	pkt := NewByteArray(session.endian())
 	pkt.AppendBytes(buf)
 	defer pkt.Release()
-	switch pkt.ReadOneByte() {
+	t := pkt.ReadOneByte()
+	compressed := t&FLAG_COMPRESS != 0
+	switch t &^ FLAG_COMPRESS {
+	case FRAGMENT:
+		id := pkt.ReadUint32()
+		index := pkt.ReadUint32()
+		count := pkt.ReadUint32()
+		conf := &session.app.Conf().Network
+		buf, err := session.frags.add(id, index, count, pkt.RemainData(), conf.GetFragmentMaxLen(), conf.GetFragmentTimeout())
+		if err != nil {
+			logger.Warn().Uint32("ID", session.id).Err(err).Msg("Session 分片重组失败")
+			return false
+		}
+		if buf != nil {
+			return session.parseMsg(buf)
+		}
+		return true
 	case H_B_S:
-		session.sendHeartbeat(H_B_R, pkt.RemainLength())
-		return
+		session.replyHeartbeat(pkt.RemainData())
+		return true
+	case H_B_R:
+		session.onProbe(pkt)
+		return true
+	case SEQ: //连接者确认后解出原包
+		if session.onSeq(pkt.ReadUint32()) {
+			return session.parseMsg(pkt.RemainData())
+		}
+		return true
+	case RESUME_TOKEN:
+		session.onResumeToken(pkt.RemainData())
+		return true
+	case ACK:
+		session.onAck(pkt.ReadUint32())
+		return true
+	case RESUME:
+		session.onResume(pkt)
+		return true
 	case C_S_C:
+		session.stats.msgsIn.Add(1)
 		cmd := pkt.ReadUint32()
+		if !session.allowCmd(cmd) {
+			return true
+		}
 		msgLen := pkt.RemainLength()
 		if msgLen == 0 {
-			session.emitMessage(cmd, nil, 0)
-			return
+			session.emitMessage(cmd, nil, 0, 0)
+			return true
 		}
 		require := protoreg.GetRequireByCmd(cmd)
 		if require == nil {
 			logger.Error().Uint32("CMD", cmd).Msg("没有找到注册此协议的结构体")
-			return
+			return false
 		}
-		if err := pkt.ReadMessage(require, session.Codec(cmd)); err != nil {
+		if err := session.readMessage(pkt, cmd, require, compressed); err != nil {
 			logger.Error().Uint32("CMD", cmd).Err(err).Msg("解析网络包体失败")
-			return
+			return false
 		}
 		if cc, ok := require.(*game.Interior_Relay); ok {
 			if cc.CMD == pb.CMD_Bcst_UnitIntoView || cc.CMD == pb.CMD_Bcst_UnitMove {
@@ -281,55 +616,132 @@ func (session *Session) parseMsg(buf []byte) {
 			}
 			// logger.Debug().Uint32("CMD", cc.CMD)
 		}
-		session.emitMessage(cmd, require, 0)
-		return
-	case RPC_REQUIRE:
+		session.emitMessage(cmd, require, 0, 0)
+		return true
+	case RPC_REQUIRE, RPC_REQUIRE_DEADLINE:
+		session.stats.msgsIn.Add(1)
 		cmd := pkt.ReadUint32()
 		rpcID := pkt.ReadUint32()
+		var timeout time.Duration
+		if t&^FLAG_COMPRESS == RPC_REQUIRE_DEADLINE {
+			timeout = time.Duration(max(pkt.ReadUint32(), 1)) * time.Millisecond
+		}
+		if !session.allowCmd(cmd) {
+			return true
+		}
 		msgLen := pkt.RemainLength()
 		// xlog.Debug("rpcs:cmd:%d,rpcID:%d,msgLen:%d", cmd, rpcID, msgLen)
 		if msgLen == 0 {
-			session.emitMessage(cmd, nil, rpcID)
-			return
+			session.emitMessage(cmd, nil, rpcID, timeout)
+			return true
 		}
 		require := protoreg.GetRequireByCmd(cmd)
 		if require == nil {
 			logger.Error().Uint32("CMD", cmd).Msg("没有找到注册此协议的结构体")
 			session.reply(cmd, nil, rpcID)
-			return
+			return false
 		}
-		if err := pkt.ReadMessage(require, session.Codec(cmd)); err != nil {
+		if err := session.readMessage(pkt, cmd, require, compressed); err != nil {
 			logger.Error().Uint32("CMD", cmd).Err(err).Msg("解析网络包体失败")
 			session.reply(cmd, nil, rpcID)
-			return
+			return false
 		}
-		session.emitMessage(cmd, require, rpcID)
-		return
+		session.emitMessage(cmd, require, rpcID, timeout)
+		return true
+	case RPC_CANCEL:
+		session.calls.cancel(pkt.ReadUint32())
+		return true
 	case RPC_RESPONSE:
+		session.stats.msgsIn.Add(1)
 		cmd := pkt.ReadUint32()
 		rpcID := pkt.ReadUint32()
 		rpx := session.rpc().Get(rpcID)
 		if rpx != nil {
-			response := rpx.GetResponse()
-			if response == nil {
-				rpx.Run(nil)
-				return
-			}
-			msgLen := pkt.RemainLength()
-			if msgLen == 0 {
-				rpx.Run(errors.New("response len == 0"))
-				return
-			}
-			if err := pkt.ReadMessage(response, session.Codec(cmd)); err != nil {
-				logger.Error().Err(err).Msg("解析网络包体失败")
-				rpx.Run(err)
-				return
-			}
-			rpx.Run(nil)
+			//等待已经结束时不再写入response
+			rpx.Resolve(rpcID, func(response any) error {
+				if response == nil {
+					return nil
+				}
+				if pkt.RemainLength() == 0 {
+					return errors.New("response len == 0")
+				}
+				if err := session.readMessage(pkt, cmd, response, compressed); err != nil {
+					logger.Error().Err(err).Msg("解析网络包体失败")
+					return err
+				}
+				return nil
+			})
 		}
-		return
+		return true
 	}
+	return false
 }
+
+// allowCmd 检查CMD限流，需要断开时关闭连接
+func (session *Session) allowCmd(cmd uint32) bool {
+	ok, err := session.limitCmd(cmd)
+	if err != nil {
+		logger.Warn().Uint32("ID", session.id).Str("Addr", session.RemoteAddr()).Err(err).Msg("Session 超出限流")
+		session.stopWith(types.CloseLimit)
+	}
+	return ok
+}
+
+// appendMessage 编码消息体，超过压缩阈值时压缩并在包类型上标记
+func (session *Session) appendMessage(pkt *ByteArray, cmd uint32, msg any) error {
+	if msg == nil {
+		return nil
+	}
+	data, ok := msg.([]byte)
+	if !ok {
+		var err error
+		if data, err = session.Codec(cmd).Marshal(msg); err != nil {
+			return err
+		}
+	}
+	if compressor, threshold := session.compressor(cmd); threshold > 0 && len(data) >= threshold {
+		zipped, err := compressor.Compress(data)
+		if err != nil {
+			logger.Warn().Uint32("CMD", cmd).Err(err).Msg("Session 压缩失败，不压缩发送")
+		} else if len(zipped) < len(data) {
+			pkt.data[0] |= FLAG_COMPRESS
+			data = zipped
+		}
+	}
+	pkt.AppendBytes(data)
+	return nil
+}
+
+// readMessage 解码消息体，压缩过的先解压
+func (session *Session) readMessage(pkt *ByteArray, cmd uint32, msg any, compressed bool) error {
+	if !compressed {
+		return pkt.ReadMessage(msg, session.Codec(cmd))
+	}
+	compressor, _ := session.compressor(cmd)
+	data, err := compressor.Decompress(pkt.RemainData(), session.app.Conf().Network.GetFragmentMaxLen())
+	if err != nil {
+		return err
+	}
+	return session.Codec(cmd).Unmarshal(data, msg)
+}
+
+// compressor CMD绑定的压缩方式优先，否则使用配置
+func (session *Session) compressor(cmd uint32) (types.ICompressor, int) {
+	conf := &session.app.Conf().Network
+	compressor, ok := compress.Get(conf.Compress)
+	if !ok {
+		compressor = compress.Flate
+	}
+	threshold := conf.CompressThreshold
+	if bind, bindThreshold, ok := protoreg.GetCompress(cmd); ok {
+		if bind != nil {
+			compressor = bind
+		}
+		threshold = bindThreshold
+	}
+	return compressor, threshold
+}
+
 func (session *Session) Codec(cmd uint32) types.ICodec {
 	temCodec := protoreg.GetCodec(cmd)
 	if temCodec != nil {
@@ -339,19 +751,41 @@ func (session *Session) Codec(cmd uint32) types.ICodec {
 }
 
 func (session *Session) rpc() *rpc.RPC {
-	return gox.NetWork.Rpc().(*rpc.RPC)
+	return session.app.NetWork.Rpc().(*rpc.RPC)
 }
 func (session *Session) endian() binary.ByteOrder {
-	return gox.Config.Network.Endian
+	return session.app.Conf().Network.Endian
 }
 
-func (session *Session) emitMessage(cmd uint32, require any, rpcID uint32) {
-	if response, err := protoreg.Call(cmd, session.ctx, session, require); err == nil {
-		if rpcID > 0 {
-			session.reply(cmd, response, rpcID)
+// emitMessage 派发消息，RPC请求的回调使用带截止时间和取消的ctx
+func (session *Session) emitMessage(cmd uint32, require any, rpcID uint32, timeout time.Duration) {
+	ctx, done := session.ctx, func() {}
+	if rpcID > 0 {
+		ctx, done = session.callContext(rpcID, timeout)
+	}
+	session.dispatch(cmd, func() {
+		defer done()
+		if rpcID > 0 && ctx.Err() != nil { //等待处理期间调用方已经放弃
+			logger.Debug().Uint32("CMD", cmd).Uint32("RPCID", rpcID).Msg("Session EmitMessage: 请求已超时或取消，不再处理")
+			return
+		}
+		if response, err := protoreg.CallWith(cmd, ctx, session, require, session.service.getInterceptors()...); err == nil {
+			if rpcID > 0 {
+				session.reply(cmd, response, rpcID)
+			}
+		} else {
+			logger.Warn().Uint32("CMD", cmd).Err(err).Msg("Session EmitMessage: 发送消息失败")
+			if rpcID > 0 { //回应空包，请求方不用等到超时
+				session.reply(cmd, nil, rpcID)
+			}
 		}
-	} else {
-		logger.Warn().Err(err).Msg("Session EmitMessage: 发送消息失败")
+	})
+}
+
+// onStop 信道停止，可恢复的Session断线后保留，否则回收
+func (session *Session) onStop() {
+	if !session.park() {
+		session.release()
 	}
 }
 
@@ -360,13 +794,54 @@ func (session *Session) release() {
 	logger.Debug().Uint32("ID", session.id).
 		Str("Remote", session.RemoteAddr()).Str("Local", session.LocalAddr()).
 		Str("Tag", session.GetTagName()).Msg("Session 断开")
+	session.saveTicket()
 	session.service.delSession(session)
+	session.reset()
+}
+
+// detach 断线恢复后回收临时Session，连接已经交给原来的Session，不触发断开的回调和事件
+func (session *Session) detach() {
+	session.service.detachSession(session)
+	session.reset()
+}
+
+// reset 清理状态后放回对象池
+func (session *Session) reset() {
 	session.ctxCancelFunc()
+	//等待执行中的消息处理，没有执行的不再执行
+	session.taskLock.Lock()
+	session.serialLock.Lock()
+	session.serial = nil
+	session.serialLock.Unlock()
 	session.ctx = nil
 	session.ctxCancelFunc = nil
 	session.tag = 0
 	session.id = 0
-	session.channel = nil
+	session.frags.reset()
+	session.attrLock.Lock()
+	session.attrs = nil
+	session.attrLock.Unlock()
+	session.userID.Store(0)
+	session.limits.reset()
+	session.received.Store(false)
+	if state := session.resume; state != nil {
+		session.service.delResume(state.token, session)
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		state.lock.Lock()
+		state.wakeParked()
+		state.lock.Unlock()
+		session.resume = nil
+	}
+	session.releaseResumeClient()
+	session.closing.Store(false)
+	session.stats.reset()
+	session.closeReason.Store(nil)
+	session.calls.reset()
+	session.link.Store(nil)
 	session.service = nil
+	session.app = nil
+	session.taskLock.Unlock()
 	sessionPool.Put(session)
 }
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+func TestSessionAttrs(t *testing.T) {
+	session, _ := newTestSession(t, TagAccept, nil)
+	if _, ok := session.Get("role"); ok {
+		t.Fatal("没有设置时不应该有属性")
+	}
+	session.Set("role", 100)
+	session.Set("name", "gox")
+	session.Set("role", 200)
+	if value, ok := session.Get("role"); !ok || value != 200 {
+		t.Errorf("role = %v %v, 应为 200", value, ok)
+	}
+	session.Delete("role")
+	if _, ok := session.Get("role"); ok {
+		t.Error("删除后仍然存在")
+	}
+	session.Delete("none")
+	if value, ok := session.Get("name"); !ok || value != "gox" {
+		t.Errorf("name = %v %v", value, ok)
+	}
+	session.reset()
+	if _, ok := session.Get("name"); ok {
+		t.Error("回收后属性没有清除")
+	}
+}
+
+// acceptSession 通过服务接收一个连接，Close后像真实的信道一样回收
+func acceptSession(service *Service, addr string) *Session {
+	ch := &testChannel{addr: addr, notifyStop: true}
+	service.OnAccept(ch)
+	return ch.session.(*Session)
+}
+
+func TestSessionBindUser(t *testing.T) {
+	service := newTestService(t, nil)
+	closed := make(chan uint32, 2)
+	service.App().Event.On(gox.EventSessionClosed, func(evt gox.SessionEvent) {
+		closed <- evt.ID
+	})
+	first := acceptSession(service, "127.0.0.1:20001")
+	second := acceptSession(service, "127.0.0.1:20002")
+
+	first.BindUser(1)
+	if got := service.GetSessionByUser(1); got != first {
+		t.Fatalf("用户1 = %v", got)
+	}
+	if first.UserID() != 1 {
+		t.Errorf("UserID = %d", first.UserID())
+	}
+
+	//改为绑定其他用户，旧的绑定解除
+	first.BindUser(2)
+	if got := service.GetSessionByUser(1); got != nil {
+		t.Errorf("改绑后用户1 = %v", got)
+	}
+	if got := service.GetSessionByUser(2); got != first {
+		t.Errorf("用户2 = %v", got)
+	}
+
+	//同一个用户绑定到新的Session，旧的Session解除绑定
+	second.BindUser(2)
+	if got := service.GetSessionByUser(2); got != second {
+		t.Errorf("重新绑定后用户2 = %v", got)
+	}
+	if first.UserID() != 0 {
+		t.Errorf("被顶替的Session UserID = %d", first.UserID())
+	}
+
+	//被顶替的Session关闭时不影响新的绑定
+	first.Close()
+	waitClosed(t, closed)
+	if got := service.GetSessionByUser(2); got != second {
+		t.Errorf("旧Session关闭后用户2 = %v", got)
+	}
+
+	//0为解除绑定
+	second.BindUser(0)
+	if got := service.GetSessionByUser(2); got != nil {
+		t.Errorf("解除绑定后用户2 = %v", got)
+	}
+	second.BindUser(3)
+	second.Close()
+	waitClosed(t, closed)
+	if got := service.GetSessionByUser(3); got != nil {
+		t.Errorf("关闭后用户3 = %v", got)
+	}
+}
+
+func waitClosed(t *testing.T, closed chan uint32) {
+	t.Helper()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Session没有关闭")
+	}
+}
+
+func TestFirstFrameTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		closed bool
+	}{
+		{"未知类型的包", []byte{0x7F, 1, 2, 3}, true},
+		{"未注册的CMD", append(binary.LittleEndian.AppendUint32([]byte{C_S_C}, 1), 0xFF), true},
+		{"包体不完整", []byte{RPC_REQUIRE, 1}, true},
+		{"有效的包", []byte{H_B_S}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, func(conf *gox.AppConf) {
+				conf.Network.Outside.Admit.FirstFrameTimeout = 1
+			})
+			ch := &testChannel{addr: "127.0.0.1:20001", stopped: make(chan struct{})}
+			service.OnAccept(ch)
+			session := ch.session.(*Session)
+			frame := binary.LittleEndian.AppendUint16(nil, uint16(len(tt.body)))
+			if done, err := session.parseReader(bytes.NewReader(append(frame, tt.body...))); done {
+				t.Fatal(err)
+			}
+			select {
+			case <-ch.stopped:
+				if !tt.closed {
+					t.Fatalf("收到有效的包后断开了 %v", session.CloseReason())
+				}
+				if reason := session.CloseReason(); reason != types.CloseIdle {
+					t.Errorf("断开原因 = %v, 应为 %v", reason, types.CloseIdle)
+				}
+				//和真实信道一样在读取协程中回收
+				session.onStop()
+			case <-time.After(1200 * time.Millisecond):
+				if tt.closed {
+					t.Fatal("没有收到有效的包时应该断开")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+// 心跳探测 [H_B_S][序号 uint32][发送时间 int64]，对端原样回应 [H_B_R][序号][发送时间]
+// 按服务的keepalive.initiator发送，见keepalive.go
+// RTT按RFC 6298平滑(1/8)，抖动按RFC 3550计算(1/16)
+// 丢失率按最近64个心跳中没有回应的比例估计，最新的一个还在等待中不计算，收到第一个回应之前为0
+
+const (
+	//心跳探测的内容长度
+	probeLen = 12
+	//丢失率统计的心跳数量
+	probeWindow = 64
+)
+
+// clockStart 心跳的发送时间使用单调时钟
+var clockStart = time.Now()
+
+type (
+	//sessionStats Session的连接质量和流量统计
+	sessionStats struct {
+		bytesIn  atomic.Uint64
+		bytesOut atomic.Uint64
+		msgsIn   atomic.Uint64
+		msgsOut  atomic.Uint64
+
+		lock    sync.Mutex
+		srtt    time.Duration
+		jitter  time.Duration
+		lastRTT time.Duration
+		samples uint64
+		//最后发出的心跳序号
+		probeSeq uint32
+		//最近的心跳是否收到回应，bit0为最新的
+		window uint64
+	}
+)
+
+func (stats *sessionStats) reset() {
+	stats.bytesIn.Store(0)
+	stats.bytesOut.Store(0)
+	stats.msgsIn.Store(0)
+	stats.msgsOut.Store(0)
+	stats.lock.Lock()
+	stats.srtt, stats.jitter, stats.lastRTT = 0, 0, 0
+	stats.samples = 0
+	stats.probeSeq = 0
+	stats.window = 0
+	stats.lock.Unlock()
+}
+
+// addSample 加入一次RTT
+func (stats *sessionStats) addSample(rtt time.Duration) {
+	if stats.samples == 0 {
+		stats.srtt = rtt
+	} else {
+		stats.srtt += (rtt - stats.srtt) / 8
+		d := rtt - stats.lastRTT
+		if d < 0 {
+			d = -d
+		}
+		stats.jitter += (d - stats.jitter) / 16
+	}
+	stats.lastRTT = rtt
+	stats.samples++
+}
+
+// loss 最近的心跳中没有回应的比例
+func (stats *sessionStats) loss() float64 {
+	if stats.samples == 0 || stats.probeSeq <= 1 {
+		return 0
+	}
+	n := min(stats.probeSeq-1, probeWindow-1)
+	mask := (uint64(1)<<n - 1) << 1
+	lost := int(n) - bits.OnesCount64(stats.window&mask)
+	return float64(lost) / float64(n)
+}
+
+// Stats 连接质量和流量统计
+func (session *Session) Stats() types.SessionStats {
+	stats := &session.stats
+	stats.lock.Lock()
+	result := types.SessionStats{
+		RTT:     stats.srtt,
+		Jitter:  stats.jitter,
+		Loss:    stats.loss(),
+		Samples: stats.samples,
+	}
+	stats.lock.Unlock()
+	result.BytesIn = stats.bytesIn.Load()
+	result.BytesOut = stats.bytesOut.Load()
+	result.MsgsIn = stats.msgsIn.Load()
+	result.MsgsOut = stats.msgsOut.Load()
+	return result
+}
+
+// sendProbe 发送带序号和时间的心跳，断线保留中不发送
+func (session *Session) sendProbe() {
+	defer app.Recover()
+	if !session.isAct() || session.getChannel() == nil {
+		return
+	}
+	stats := &session.stats
+	stats.lock.Lock()
+	stats.probeSeq++
+	stats.window <<= 1
+	seq := stats.probeSeq
+	stats.lock.Unlock()
+	pkt := session.newPacket()
+	defer pkt.Release()
+	pkt.AppendByte(H_B_S)
+	pkt.AppendUint32(seq)
+	pkt.AppendInt64(int64(time.Since(clockStart)))
+	session.sendPacket(pkt)
+}
+
+// onProbe 收到心跳回应，不是这个进程发出的或重复的回应忽略
+func (session *Session) onProbe(pkt *ByteArray) {
+	if pkt.RemainLength() != probeLen {
+		return
+	}
+	seq := pkt.ReadUint32()
+	rtt := time.Since(clockStart) - time.Duration(pkt.ReadInt64())
+	stats := &session.stats
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	age := stats.probeSeq - seq
+	if seq == 0 || age >= probeWindow || rtt < 0 || stats.window&(1<<age) != 0 {
+		return
+	}
+	stats.window |= 1 << age
+	stats.addSample(rtt)
+}
+
+// frameLen 包头加包体的长度
+func frameLen(header gox.FrameHeader, msglen uint32) uint64 {
+	switch header {
+	case gox.FrameHeaderUint32:
+		return uint64(msglen) + 4
+	case gox.FrameHeaderVarint:
+		return uint64(msglen) + uint64(len(binary.AppendUvarint(nil, uint64(msglen))))
+	default:
+		return uint64(msglen) + 2
+	}
+}
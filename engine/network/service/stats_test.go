@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+)
+
+func TestStatsSample(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		rtts   []time.Duration
+		srtt   time.Duration
+		jitter time.Duration
+	}{
+		{"第一个样本", []time.Duration{100 * ms}, 100 * ms, 0},
+		{"RTT不变", []time.Duration{50 * ms, 50 * ms, 50 * ms}, 50 * ms, 0},
+		{"RTT变大", []time.Duration{100 * ms, 180 * ms}, 110 * ms, 5 * ms},
+		//srtt 110 + (100-110)/8，jitter 5 + (80-5)/16
+		{"RTT变小", []time.Duration{100 * ms, 180 * ms, 100 * ms}, 108750 * time.Microsecond, 9687500 * time.Nanosecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats sessionStats
+			for _, rtt := range tt.rtts {
+				stats.addSample(rtt)
+			}
+			if stats.srtt != tt.srtt {
+				t.Errorf("srtt = %v, 应为 %v", stats.srtt, tt.srtt)
+			}
+			if stats.jitter != tt.jitter {
+				t.Errorf("jitter = %v, 应为 %v", stats.jitter, tt.jitter)
+			}
+			if stats.samples != uint64(len(tt.rtts)) {
+				t.Errorf("samples = %d, 应为 %d", stats.samples, len(tt.rtts))
+			}
+		})
+	}
+}
+
+func TestStatsLoss(t *testing.T) {
+	tests := []struct {
+		name    string
+		sends   int
+		replies []uint32
+		loss    float64
+		samples uint64
+	}{
+		{"没有回应", 3, nil, 0, 0},
+		{"全部回应", 4, []uint32{1, 2, 3, 4}, 0, 4},
+		{"丢失一个", 5, []uint32{1, 2, 4, 5}, 0.25, 4},
+		{"最新的还在等待", 5, []uint32{1, 2, 3, 4}, 0, 4},
+		{"重复的回应只计算一次", 3, []uint32{1, 1, 2, 3}, 0, 3},
+		{"乱序回应", 3, []uint32{2, 1, 3}, 0, 3},
+		{"不是发出的序号", 2, []uint32{0, 3, 1, 2}, 0, 2},
+		{"超出窗口的丢失不计算", 70, seqRange(7, 70), 0, 64},
+		//超出窗口的回应忽略
+		{"窗口内丢失", 70, append(seqRange(1, 9), seqRange(11, 70)...), 1.0 / 63, 63},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, ch := newTestSession(t, TagConnector, nil)
+			bodys := make(map[uint32][]byte)
+			for i := 0; i < tt.sends; i++ {
+				session.sendProbe()
+			}
+			for _, body := range ch.take(t, session) {
+				if body[0] != H_B_S || len(body) != 1+probeLen {
+					t.Fatalf("心跳包 = %v", body)
+				}
+				seq := uint32(len(bodys) + 1)
+				bodys[seq] = body[1:]
+			}
+			if len(bodys) != tt.sends {
+				t.Fatalf("发出了 %d 个心跳, 应为 %d", len(bodys), tt.sends)
+			}
+			for _, seq := range tt.replies {
+				payload, ok := bodys[seq]
+				if !ok {
+					//对端回应了不是这里发出的序号
+					payload = append(binary.LittleEndian.AppendUint32(nil, seq), bodys[1][4:]...)
+				}
+				session.parseMsg(append([]byte{H_B_R}, payload...))
+			}
+			stats := session.Stats()
+			if stats.Loss != tt.loss {
+				t.Errorf("Loss = %v, 应为 %v", stats.Loss, tt.loss)
+			}
+			if stats.Samples != tt.samples {
+				t.Errorf("Samples = %d, 应为 %d", stats.Samples, tt.samples)
+			}
+		})
+	}
+}
+
+// seqRange from到to的序号
+func seqRange(from, to uint32) []uint32 {
+	list := make([]uint32, 0, to-from+1)
+	for seq := from; seq <= to; seq++ {
+		list = append(list, seq)
+	}
+	return list
+}
+
+func TestAcceptProbe(t *testing.T) {
+	service := newTestService(t, func(conf *gox.AppConf) {
+		conf.Development = false
+		conf.Network.Heartbeat = 20 * time.Millisecond
+	})
+	ch := &testChannel{addr: "127.0.0.1:20001"}
+	service.OnAccept(ch)
+	session := ch.session.(*Session)
+	defer func() {
+		session.stop()
+		session.onStop()
+	}()
+
+	//外部服务的接收端默认也发送心跳，收到回应后统计RTT
+	body := waitFrame(t, ch, session, H_B_S)
+	session.parseMsg(append([]byte{H_B_R}, body[1:]...))
+	if stats := session.Stats(); stats.Samples == 0 {
+		t.Fatalf("接收端没有统计RTT %+v", stats)
+	}
+}
@@ -1,9 +1,10 @@
 package tcp
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"sync"
-	"time"
 
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/service"
@@ -23,6 +24,7 @@ type (
 func (channel *TChannel) init(conn *net.Conn) {
 	channel.conn = conn
 	channel.Init(channel.write, channel.Conn().RemoteAddr().String(), channel.Conn().LocalAddr().String())
+	channel.SetWriteBuffers(channel.writeBuffers)
 }
 
 // Conn 获取通信体
@@ -32,6 +34,21 @@ func (channel *TChannel) Conn() net.Conn {
 	return *channel.conn
 }
 
+// PeerCertificate TLS对端的证书，没有开启TLS或对端没有证书时为nil
+func (channel *TChannel) PeerCertificate() *x509.Certificate {
+	channel.connGuard.RLock()
+	defer channel.connGuard.RUnlock()
+	if channel.conn == nil {
+		return nil
+	}
+	if tlsConn, ok := (*channel.conn).(*tls.Conn); ok {
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			return certs[0]
+		}
+	}
+	return nil
+}
+
 // Start 开启异步接收数据
 func (channel *TChannel) Start() {
 	channel.Wg.Add(1)
@@ -45,12 +62,9 @@ func (channel *TChannel) run() {
 }
 func (channel *TChannel) recvAsync() {
 	defer channel.Wg.Done()
-	readTimeout := channel.ReadTimeout()
-	if readTimeout > 0 {
-		if err := channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
-			logger.Error().Str("Addr", channel.RemoteAddr()).Err(err).Msg("tcp 接受数据超时")
-			channel.Stop()
-		}
+	if err := channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil {
+		logger.Error().Str("Addr", channel.RemoteAddr()).Err(err).Msg("tcp 接受数据超时")
+		channel.Stop()
 	}
 	for channel.Conn() != nil && channel.IsRun {
 		if stop, err := channel.Read(channel.Conn()); stop {
@@ -58,8 +72,8 @@ func (channel *TChannel) recvAsync() {
 			channel.Stop()
 			break
 		}
-		if channel.IsRun && readTimeout > 0 {
-			if err := channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		if channel.IsRun {
+			if err := channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil {
 				logger.Error().Str("Addr", channel.RemoteAddr()).Err(err).Msg("tcp 接受数据超时")
 				channel.Stop()
 			}
@@ -74,6 +88,14 @@ func (channel *TChannel) write(buf []byte) {
 	}
 }
 
+// writeBuffers 一次写入多个包
+func (channel *TChannel) writeBuffers(bufs net.Buffers) {
+	_, err := bufs.WriteTo(channel.Conn())
+	if err != nil {
+		logger.Error().Str("Addr", channel.RemoteAddr()).Err(err).Msg("tcp 信道写入失败")
+	}
+}
+
 // Stop 停止信道
 func (channel *TChannel) Stop() {
 	if !channel.IsRun {
@@ -1,10 +1,11 @@
 package tcp
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"time"
 
-	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/service"
 	"github.com/xhaoh94/gox/engine/types"
@@ -32,8 +33,18 @@ func (service *TService) Start() {
 			service.Stop()
 			return
 		}
+		if tlsConf := service.Conf().Tls; tlsConf.Enabled() {
+			serverConf, err := tlsConf.ServerConfig()
+			if err != nil {
+				logger.Fatal().Err(err).Str("Addr", service.GetAddr()).Msg("tcp 启动失败")
+				service.listen.Close()
+				service.listen = nil
+				return
+			}
+			service.listen = tls.NewListener(service.listen, serverConf)
+		}
 	}
-	logger.Info().Str("Addr", service.GetAddr()).Msg("tcp 等待客户端连接...")
+	logger.Info().Str("Addr", service.GetAddr()).Bool("Tls", service.Conf().Tls.Enabled()).Msg("tcp 等待客户端连接...")
 	go service.accept()
 }
 func (service *TService) accept() {
@@ -42,7 +53,7 @@ func (service *TService) accept() {
 	service.AcceptWg.Add(1)
 	for {
 		conn, err := service.listen.Accept()
-		if !service.IsRun {
+		if !service.IsRun || service.IsStopAccept {
 			break
 		}
 		if err != nil {
@@ -53,11 +64,21 @@ func (service *TService) accept() {
 			logger.Fatal().Err(err).Msg("tcp 监听客户端连接失败")
 			break
 		}
+		if err := service.Admit(conn.RemoteAddr().String()); err != nil {
+			conn.Close()
+			continue
+		}
 		logger.Info().Str("Addr", conn.RemoteAddr().String()).Msg("tcp 连接成功")
 		go service.connection(&conn)
 	}
 }
 func (service *TService) connection(conn *net.Conn) {
+	if err := service.handshake(*conn); err != nil {
+		logger.Warn().Str("Addr", (*conn).RemoteAddr().String()).Err(err).Msg("tcp TLS握手失败")
+		service.ReleaseAdmit((*conn).RemoteAddr().String())
+		(*conn).Close()
+		return
+	}
 	tchannel := service.addChannel(conn)
 	service.OnAccept(tchannel)
 }
@@ -69,25 +90,90 @@ func (service *TService) addChannel(conn *net.Conn) *TChannel {
 
 // connectChannel 链接新信道
 func (service *TService) connectChannel(addr string) types.IChannel {
+	netConf := service.App().Conf().Network
+	var clientConf *tls.Config
+	if tlsConf := service.Conf().Tls; tlsConf.Enabled() {
+		var err error
+		if clientConf, err = tlsConf.ClientConfig(); err != nil {
+			logger.Error().Str("Addr", addr).Err(err).Msg("tcp 创建通信信道失败")
+			return nil
+		}
+	}
 	var connCount int
 	for {
-		conn, err := net.DialTimeout("tcp", addr, gox.Config.Network.ConnectTimeout)
+		conn, err := service.dial(addr, netConf.ConnectTimeout, clientConf)
 		if err == nil {
+			if err = service.verifyPeer(addr, conn); err != nil {
+				logger.Error().Str("Addr", addr).Err(err).Msg("tcp 对端身份校验失败")
+				conn.Close()
+				return nil
+			}
 			return service.addChannel(&conn)
 		}
-		if connCount > gox.Config.Network.ReConnectMax {
+		if connCount > netConf.ReConnectMax {
 			logger.Error().Str("Addr", addr).Err(err).Msg("tcp 创建通信信道失败")
 			return nil
 		}
-		if !service.IsRun || gox.Config.Network.ReConnectInterval == 0 {
+		if !service.IsRun || netConf.ReConnectInterval == 0 {
 			return nil
 		}
-		time.Sleep(gox.Config.Network.ReConnectInterval)
+		time.Sleep(netConf.ReConnectInterval)
 		connCount++
 		continue
 	}
 }
 
+// dial 建立连接，开启TLS时同时完成握手
+func (service *TService) dial(addr string, timeout time.Duration, clientConf *tls.Config) (net.Conn, error) {
+	if clientConf == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, clientConf)
+}
+
+// handshake 接收的连接开启TLS时先完成握手，之后可以获取对端证书
+func (service *TService) handshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	timeout := service.App().Conf().Network.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	return tlsConn.SetDeadline(time.Time{})
+}
+
+// verifyPeer 主动连接时校验对端证书的身份
+func (service *TService) verifyPeer(addr string, conn net.Conn) error {
+	var cert *x509.Certificate
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			cert = certs[0]
+		}
+	}
+	return service.VerifyPeer(addr, cert)
+}
+
+// SupportTls tcp服务支持TLS
+func (service *TService) SupportTls() bool {
+	return true
+}
+
+// StopAccept 停止接收新连接
+func (service *TService) StopAccept() {
+	if !service.IsRun || service.IsStopAccept {
+		return
+	}
+	service.IsStopAccept = true
+	service.listen.Close()
+	logger.Info().Str("Addr", service.GetAddr()).Msg("tcp 停止接收新连接")
+}
+
 // Stop 停止服务
 func (service *TService) Stop() {
 	if !service.IsRun {
@@ -1,10 +1,10 @@
 package ws
 
 import (
+	"net"
 	"sync"
 	"time"
 
-	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/service"
 
@@ -25,6 +25,27 @@ type (
 func (channel *WChannel) init(conn *websocket.Conn) {
 	channel.conn = conn
 	channel.Init(channel.write, channel.Conn().RemoteAddr().String(), channel.Conn().LocalAddr().String())
+	conn.SetPingHandler(channel.onPing)
+	conn.SetPongHandler(channel.onPong)
+}
+
+// onPing 回应pong，刷新空闲时间和读超时
+func (channel *WChannel) onPing(data string) error {
+	channel.onPong(data)
+	err := channel.Conn().WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	if err == websocket.ErrCloseSent {
+		return nil
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return nil
+	}
+	return err
+}
+
+// onPong 刷新空闲时间和读超时
+func (channel *WChannel) onPong(string) error {
+	channel.Touch()
+	return channel.Conn().SetReadDeadline(channel.ReadDeadline())
 }
 
 // Conn 获取通信体
@@ -47,18 +68,16 @@ func (channel *WChannel) run() {
 }
 func (channel *WChannel) recvAsync() {
 	defer channel.Wg.Done()
-	readTimeout := channel.ReadTimeout()
-	if readTimeout > 0 {
-		if err := channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil { // timeout
-			logger.Info().Str("RemoteAddr", channel.RemoteAddr()).Err(err).Msg("websocket 接受数据超时")
-			channel.Stop() //超时断开链接
-		}
+	if err := channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil { // timeout
+		logger.Info().Str("RemoteAddr", channel.RemoteAddr()).Err(err).Msg("websocket 接受数据超时")
+		channel.Stop() //超时断开链接
 	}
 	var stop bool = false
 	for channel.Conn() != nil && channel.IsRun {
 		_, r, err := channel.Conn().NextReader()
 		if err != nil {
 			logger.Info().Str("RemoteAddr", channel.RemoteAddr()).Err(err).Send()
+			channel.ReadFailed(err)
 			channel.Stop()
 			break
 		}
@@ -68,8 +87,8 @@ func (channel *WChannel) recvAsync() {
 			channel.Stop()
 			break
 		}
-		if channel.IsRun && readTimeout > 0 {
-			if err = channel.Conn().SetReadDeadline(time.Now().Add(readTimeout)); err != nil { // timeout
+		if channel.IsRun {
+			if err = channel.Conn().SetReadDeadline(channel.ReadDeadline()); err != nil { // timeout
 				logger.Info().Str("RemoteAddr", channel.RemoteAddr()).Err(err).Msg("websocket 接受数据超时")
 				channel.Stop() //超时断开链接
 			}
@@ -78,7 +97,7 @@ func (channel *WChannel) recvAsync() {
 }
 
 func (channel *WChannel) write(buf []byte) {
-	err := channel.Conn().WriteMessage(gox.Config.WebSocket.WebSocketMessageType, buf)
+	err := channel.Conn().WriteMessage(channel.App().Conf().WebSocket.WebSocketMessageType, buf)
 	if err != nil {
 		logger.Info().Str("RemoteAddr", channel.RemoteAddr()).Err(err).Msg("websocket 信道写入失败")
 	}
@@ -6,7 +6,6 @@ import (
 	"net/url"
 	"time"
 
-	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/types"
 
@@ -32,9 +31,10 @@ func (service *WService) Init(addr string, codec types.ICodec) {
 
 // Start 启动
 func (service *WService) Start() {
-	service.patten = gox.Config.WebSocket.WebSocketPattern
-	service.scheme = gox.Config.WebSocket.WebSocketScheme
-	service.path = gox.Config.WebSocket.WebSocketPath
+	wsConf := service.App().Conf().WebSocket
+	service.patten = wsConf.WebSocketPattern
+	service.scheme = wsConf.WebSocketScheme
+	service.path = wsConf.WebSocketPath
 	logger.Debug().Str("patten", service.patten).
 		Str("scheme", service.scheme).
 		Str("path", service.path).Msg("websocket")
@@ -56,8 +56,9 @@ func (service *WService) accept() {
 	if ln, err := net.Listen("tcp", service.GetAddr()); err != nil {
 		logger.Fatal().Err(err).Msg("websocket 启动失败")
 	} else {
-		cf := gox.Config.WebSocket.CertFile
-		kf := gox.Config.WebSocket.KeyFile
+		wsConf := service.App().Conf().WebSocket
+		cf := wsConf.CertFile
+		kf := wsConf.KeyFile
 		if cf != "" && kf != "" {
 			err = service.sv.ServeTLS(ln, cf, kf)
 		} else {
@@ -82,8 +83,13 @@ func (service *WService) accept() {
 	// }
 }
 func (service *WService) wsPage(w http.ResponseWriter, r *http.Request) {
+	if err := service.Admit(r.RemoteAddr); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	conn, err := service.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		service.ReleaseAdmit(r.RemoteAddr)
 		logger.Error().Err(err).Msg("websocket wsPage")
 		return
 	}
@@ -103,6 +109,7 @@ func (service *WService) addChannel(conn *websocket.Conn) *WChannel {
 
 // connectChannel 链接新信道
 func (service *WService) connectChannel(addr string) types.IChannel {
+	netConf := service.App().Conf().Network
 	var connCount int
 	for {
 		u := url.URL{Scheme: service.scheme, Host: addr, Path: service.path}
@@ -116,20 +123,30 @@ func (service *WService) connectChannel(addr string) types.IChannel {
 		if err == nil {
 			return service.addChannel(conn)
 		}
-		if connCount > gox.Config.Network.ReConnectMax {
+		if connCount > netConf.ReConnectMax {
 			logger.Info().Str("RemoteAddr", conn.RemoteAddr().String()).Err(err).Msg("websocket 创建通信信道失败")
 			return nil
 		}
-		if !service.IsRun || gox.Config.Network.ReConnectInterval == 0 {
+		if !service.IsRun || netConf.ReConnectInterval == 0 {
 			return nil
 		}
-		time.Sleep(gox.Config.Network.ReConnectInterval)
+		time.Sleep(netConf.ReConnectInterval)
 		connCount++
 		continue
 	}
 
 }
 
+// StopAccept 停止接收新连接，已升级的websocket连接不受影响
+func (service *WService) StopAccept() {
+	if !service.IsRun || service.IsStopAccept {
+		return
+	}
+	service.IsStopAccept = true
+	service.sv.Close()
+	logger.Info().Str("Addr", service.GetAddr()).Msg("websocket 停止接收新连接")
+}
+
 // Stop 停止服务
 func (service *WService) Stop() {
 	if !service.IsRun {
@@ -137,7 +154,7 @@ func (service *WService) Stop() {
 	}
 	service.Service.Stop()
 	service.IsRun = false
-	service.sv.Shutdown(gox.Ctx)
+	service.sv.Shutdown(service.App().Ctx)
 	// 等待线程结束
 	service.AcceptWg.Wait()
 
@@ -3,23 +3,24 @@ package network
 import (
 	"context"
 	"encoding/json"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xhaoh94/gox"
-	"github.com/xhaoh94/gox/engine/etcd"
 	"github.com/xhaoh94/gox/engine/helper/strhelper"
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network/location"
 	"github.com/xhaoh94/gox/engine/types"
-
-	"github.com/coreos/etcd/mvcc/mvccpb"
 )
 
 type (
 	ServiceSystem struct {
-		etcd.EtcdComponent
-		context      context.Context
-		es           *etcd.EtcdConf
+		lock         sync.RWMutex
+		app          *gox.App
+		registry     Registry
+		isOpen       bool
+		registered   atomic.Bool
 		keyToService map[string]ServiceEntity
 		idToService  map[uint]ServiceEntity
 		curService   ServiceEntity
@@ -43,6 +44,8 @@ type (
 		OutsideAddr string
 		//内部服务地址
 		InteriorAddr string
+		//是否正在关闭
+		Draining bool
 	}
 )
 
@@ -62,6 +65,10 @@ func (entity ServiceEntity) IsLocation() bool {
 	return entity.Location
 }
 
+func (entity ServiceEntity) IsDraining() bool {
+	return entity.Draining
+}
+
 func (entity ServiceEntity) GetType() string {
 	return entity.AppType
 }
@@ -69,9 +76,9 @@ func (entity ServiceEntity) GetVersion() string {
 	return entity.Version
 }
 
-func newServiceSystem(ctx context.Context) *ServiceSystem {
+func newServiceSystem(app *gox.App) *ServiceSystem {
 	return &ServiceSystem{
-		context:      ctx,
+		app:          app,
 		keyToService: make(map[string]ServiceEntity),
 		idToService:  make(map[uint]ServiceEntity),
 	}
@@ -99,13 +106,14 @@ func newServiceConfig(val []byte) (ServiceEntity, error) {
 }
 
 func (ss *ServiceSystem) Start() {
-	appConf := gox.Config
-	if len(appConf.Etcd.EtcdList) == 0 {
-		logger.Error().Msg("EtcdList 为空，无法启动服务注册")
-		return
+	appConf := ss.app.Conf()
+	if ss.registry == nil {
+		if len(appConf.Etcd.EtcdList) == 0 {
+			logger.Error().Msg("EtcdList 为空，无法启动服务注册")
+			return
+		}
+		ss.registry = newEtcdRegistry(appConf.Etcd)
 	}
-	ss.EtcdComponent.OnPut = ss.onPut
-	ss.EtcdComponent.OnDel = ss.onDel
 	ss.curService = ServiceEntity{
 		AppID:        appConf.AppID,
 		AppType:      appConf.AppType,
@@ -115,43 +123,71 @@ func (ss *ServiceSystem) Start() {
 		InteriorAddr: appConf.InteriorAddr,
 		RpcAddr:      appConf.RpcAddr,
 	}
-	timeoutCtx, timeoutCancelFunc := context.WithCancel(ss.context)
+	timeoutCtx, timeoutCancelFunc := context.WithCancel(ss.app.Ctx)
 	go ss.checkTimeout(timeoutCtx)
-	var err error
-	ss.es, err = etcd.NewEtcdConf(ss)
+	err := ss.registry.Open()
 	timeoutCancelFunc()
 	if err != nil {
-		logger.Fatal().Err(err).Msg("EtcdList 服务注册失败")
+		logger.Fatal().Err(err).Msg("服务注册失败")
+		return
+	}
+	ss.isOpen = true
+	key := convertKey(ss.curService)
+	value := convertValue(ss.curService)
+	if err := ss.registry.Put(key, value); err != nil {
+		logger.Error().Err(err).Msg("服务注册失败")
+	} else {
+		ss.registered.Store(true)
+	}
+	if err := ss.registry.Watch("services/", ss.onPut, ss.onDel); err != nil {
+		logger.Error().Err(err).Msg("获取服务注册表失败")
+	}
+}
+
+// Drain 在注册表中把本服务标记为关闭中
+func (ss *ServiceSystem) Drain() {
+	if !ss.isOpen {
 		return
 	}
+	ss.registered.Store(false)
+	ss.curService.Draining = true
 	key := convertKey(ss.curService)
 	value := convertValue(ss.curService)
-	ss.es.Put(key, value)
-	ss.es.Get("services/", true)
+	if err := ss.registry.Put(key, value); err != nil {
+		logger.Error().Err(err).Msg("标记服务关闭中失败")
+	}
 }
 func (ss *ServiceSystem) Stop() {
-	// if ss.curService != nil {
-	// 	key := convertKey(ss.curService)
-	// 	ss.es.Del(key)
-	// }
-	if ss.es != nil {
-		ss.es.Close()
+	if !ss.isOpen {
+		return
+	}
+	ss.isOpen = false
+	ss.registered.Store(false)
+	if err := ss.registry.Del(convertKey(ss.curService)); err != nil {
+		logger.Error().Err(err).Msg("服务注销失败")
 	}
+	ss.registry.Close()
+}
+
+// IsRegistered 本服务是否已注册成功且没有下线
+func (ss *ServiceSystem) IsRegistered() bool {
+	return ss.registered.Load()
 }
+
 func (ss *ServiceSystem) checkTimeout(ctx context.Context) {
 	select {
 	case <-ctx.Done():
 		// 被取消，直接返回
 		return
 	case <-time.After(time.Second * 5):
-		logger.Fatal().Msg("请检查你的etcd服务是否有开启")
+		logger.Fatal().Msg("请检查你的服务注册表(etcd)是否有开启")
 	}
 }
 
 // 通过id获取服务配置
 func (ss *ServiceSystem) GetServiceEntityByID(id uint) types.IServiceEntity {
-	defer ss.RUnlock()
-	ss.RLock()
+	defer ss.lock.RUnlock()
+	ss.lock.RLock()
 	if conf, ok := ss.idToService[id]; ok {
 		return conf
 	}
@@ -168,39 +204,56 @@ func (ss *ServiceSystem) checkOpt(entity types.IServiceEntity, opts ...types.Ser
 	return true
 }
 
-// 获取对应类型的所有服务配置
+// 获取对应类型的所有服务配置，关闭中的服务器不再接收新的请求，不包括在内
 func (ss *ServiceSystem) GetServiceEntitys(opts ...types.ServiceOptionFunc) []types.IServiceEntity {
-	defer ss.RUnlock()
-	ss.RLock()
+	return ss.getServiceEntitys(false, opts...)
+}
+
+// 获取对应类型的所有服务配置，包括关闭中的服务器
+func (ss *ServiceSystem) GetAllServiceEntitys(opts ...types.ServiceOptionFunc) []types.IServiceEntity {
+	return ss.getServiceEntitys(true, opts...)
+}
+
+func (ss *ServiceSystem) getServiceEntitys(draining bool, opts ...types.ServiceOptionFunc) []types.IServiceEntity {
+	defer ss.lock.RUnlock()
+	ss.lock.RLock()
 	list := make([]types.IServiceEntity, 0)
 	for _, v := range ss.idToService {
-		if ss.checkOpt(v, opts...) {
+		if (draining || !v.IsDraining()) && ss.checkOpt(v, opts...) {
 			list = append(list, v)
 		}
 	}
 	return list
 }
 
-func (ss *ServiceSystem) onPut(kv *mvccpb.KeyValue) {
-	if kv.Value == nil {
-		return
-	}
-	key := string(kv.Key)
-	service, err := newServiceConfig(kv.Value)
+func (ss *ServiceSystem) onPut(key string, value []byte) {
+	service, err := newServiceConfig(value)
 	if err != nil {
 		logger.Error().Err(err).Msg("解析服务注册配置错误")
 		return
 	}
+	ss.lock.Lock()
 	ss.idToService[service.AppID] = service
 	ss.keyToService[key] = service
+	ss.lock.Unlock()
+	if service.Draining {
+		logger.Info().Uint("AppID", service.AppID).Str("Type", service.AppType).Str("Version", service.Version).Msg("服务关闭中")
+		return
+	}
 	logger.Info().Uint("AppID", service.AppID).Str("Type", service.AppType).Str("Version", service.Version).Msg("服务注册")
+	ss.app.Event.Run(gox.EventServiceDiscovered, types.IServiceEntity(service))
 }
-func (ss *ServiceSystem) onDel(kv *mvccpb.KeyValue) {
-	key := string(kv.Key)
-	if service, ok := ss.keyToService[key]; ok {
+func (ss *ServiceSystem) onDel(key string) {
+	ss.lock.Lock()
+	service, ok := ss.keyToService[key]
+	if ok {
 		delete(ss.keyToService, key)
 		delete(ss.idToService, service.AppID)
-		gox.Location.(*location.LocationSystem).ServiceClose(service.AppID)
+	}
+	ss.lock.Unlock()
+	if ok {
+		ss.app.Location.(*location.LocationSystem).ServiceClose(service.AppID)
 		logger.Info().Uint("AppID", service.AppID).Str("Type", service.AppType).Str("Version", service.Version).Msg("服务注销")
+		ss.app.Event.Run(gox.EventServiceLost, types.IServiceEntity(service))
 	}
 }
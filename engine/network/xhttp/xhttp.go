@@ -1,10 +1,14 @@
 package xhttp
 
 import (
-	"log"
+	"context"
+	"net"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
 )
 
 type HttpServer struct {
@@ -25,30 +29,41 @@ func (hs *HttpServer) AddRoute(route string, fn func(w http.ResponseWriter, r *h
 	hs.lock.Lock()
 	hs.routes[route] = fn
 }
-func (hs *HttpServer) Start() {
 
+// Start 监听地址并在后台处理请求，监听失败时返回错误
+func (hs *HttpServer) Start() error {
 	mux := http.NewServeMux()
+	hs.lock.Lock()
 	for k := range hs.routes {
 		route := hs.routes[k]
 		mux.HandleFunc(k, route)
 	}
-	hs.server = &http.Server{Addr: hs.addr, WriteTimeout: time.Second * 4, Handler: mux}
-
-	log.Printf("启动 xhttp")
-	err := hs.server.ListenAndServe()
+	hs.lock.Unlock()
+	ln, err := net.Listen("tcp", hs.addr)
 	if err != nil {
-		// 正常退出
-		if err == http.ErrServerClosed {
-			log.Fatal("Server closed under request")
-		} else {
-			log.Fatal("Server closed unexpected", err)
-		}
+		return err
 	}
-	log.Fatal("关闭 xhttp")
+	hs.server = &http.Server{Addr: hs.addr, WriteTimeout: time.Second * 4, Handler: mux}
+	logger.Info().Str("Addr", hs.addr).Msg("启动 xhttp")
+	go func() {
+		defer app.Recover()
+		if err := hs.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error().Err(err).Str("Addr", hs.addr).Msg("xhttp 异常关闭")
+		}
+	}()
+	return nil
 }
+
+// Stop 关闭服务，等待处理中的请求完成
 func (hs *HttpServer) Stop() {
-	err := hs.server.Shutdown(nil)
-	if err != nil {
-		log.Printf("shutdown the server err")
+	if hs.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := hs.server.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Str("Addr", hs.addr).Msg("关闭 xhttp 失败")
+		return
 	}
+	logger.Info().Str("Addr", hs.addr).Msg("关闭 xhttp")
 }
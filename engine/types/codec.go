@@ -7,3 +7,12 @@ type (
 		Unmarshal([]byte, interface{}) error
 	}
 )
+
+type (
+	//压缩接口
+	ICompressor interface {
+		Compress([]byte) ([]byte, error)
+		//maxLen 解压后的最大长度，超出时返回错误
+		Decompress(data []byte, maxLen int) ([]byte, error)
+	}
+)
@@ -1,5 +1,7 @@
 package types
 
+import "context"
+
 type (
 	//定位系统
 	ILocationSystem interface {
@@ -17,6 +19,12 @@ type (
 		Send(uint32, interface{})
 		//阻塞等待发送
 		Call(uint32, interface{}, interface{}) error
+		//阻塞等待发送，按ctx的截止时间和取消等待
+		CallCtx(context.Context, uint32, interface{}, interface{}) error
+	}
+	//定位实体可选实现，注册后每帧调用，注销后停止，dt为上一帧实际经过的时间(秒)
+	ILocationUpdate interface {
+		OnUpdate(dt float32)
 	}
 	ILocation interface {
 		//定位ID 每个实体的ID都是唯一的，且不变的
@@ -7,6 +7,8 @@ type (
 	IModule interface {
 		Init(IModule)
 		Start(IModule)
+		//关闭前排空
+		Drain(IModule, context.Context)
 		Destroy(IModule)
 
 		//注册协议或添加子模块写在这里
@@ -16,6 +18,22 @@ type (
 		//模块销毁
 		OnDestroy()
 	}
+	//模块可选实现，关闭前的排空阶段，ctx到期前等待或清理进行中的业务
+	IModuleDrain interface {
+		OnDrain(context.Context)
+	}
+	//模块可选实现，按配置的帧率每帧调用，dt为上一帧实际经过的时间(秒)
+	IModuleUpdate interface {
+		OnUpdate(dt float32)
+	}
+	//模块可选实现，自定义模块名，默认使用结构体名
+	IModuleName interface {
+		ModuleName() string
+	}
+	//模块可选实现，声明依赖的同级模块名，依赖的模块会先初始化、启动，后销毁
+	IModuleDepend interface {
+		Depends() []string
+	}
 
 	ProtoFn[V any] interface {
 		func(context.Context, ISession, V)
@@ -23,4 +41,8 @@ type (
 	ProtoRPCFn[V1 any, V2 any] interface {
 		func(context.Context, ISession, V1) (V2, error)
 	}
+	//ProtoHandler 协议处理，拦截器通过它继续执行后面的拦截器和回调
+	ProtoHandler func(ctx context.Context, session ISession, cmd uint32, require any) (any, error)
+	//ProtoInterceptor 协议拦截器，不调用next时直接返回结果
+	ProtoInterceptor func(ctx context.Context, session ISession, cmd uint32, require any, next ProtoHandler) (any, error)
 )
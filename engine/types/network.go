@@ -1,6 +1,9 @@
 package types
 
 import (
+	"context"
+	"time"
+
 	"google.golang.org/grpc"
 )
 
@@ -9,6 +12,10 @@ type (
 	INetwork interface {
 		Init()
 		Start()
+		//开始关闭：标记下线并停止接收外部连接
+		Drain(context.Context)
+		//等待处理中的消息和rpc完成，并注销定位
+		Wait(context.Context)
 		Destroy()
 		Outside() IService
 		Interior() IService
@@ -22,8 +29,10 @@ type (
 		Rpc() IRPC
 		// 通过id获取服务配置
 		GetServiceEntityByID(uint) IServiceEntity
-		// 获取对应类型的所有服务配置
+		// 获取对应类型的所有服务配置，不包括关闭中的服务器
 		GetServiceEntitys(...ServiceOptionFunc) []IServiceEntity
+		// 获取对应类型的所有服务配置，包括关闭中的服务器
+		GetAllServiceEntitys(...ServiceOptionFunc) []IServiceEntity
 	}
 	//服务器接口
 	IService interface {
@@ -31,10 +40,23 @@ type (
 		Codec() ICodec
 		Start()
 		Stop()
+		//停止接收新连接，已有会话不受影响
+		StopAccept()
+		//等待处理中的消息完成，超时返回false
+		Wait(context.Context) bool
 		GetAddr() string
 		GetSessionByAddr(string) ISession
 		GetSessionById(uint32) ISession
+		//获取所有Session
+		Sessions() []ISession
+		//通过绑定的用户标识获取Session
+		GetSessionByUser(uint64) ISession
+		//监听Session断开，可以添加多个回调
 		LinstenByDelSession(callback func(uint32))
+		//添加服务的协议拦截器，在全局拦截器之后执行
+		Use(...ProtoInterceptor)
+		//添加接收连接的检查，返回错误时拒绝连接，在创建Session之前执行
+		AddAcceptHook(func(remoteAddr string) error)
 	}
 	//会话接口
 	ISession interface {
@@ -48,18 +70,86 @@ type (
 		Call(interface{}, interface{}) error
 		//阻塞等待发送
 		CallByCmd(uint32, interface{}, interface{}) error
+		//阻塞等待发送，按ctx的截止时间和取消等待，截止时间会传给接收方
+		CallCtx(context.Context, interface{}, interface{}) error
+		//阻塞等待发送，按ctx的截止时间和取消等待，截止时间会传给接收方
+		CallByCmdCtx(context.Context, uint32, interface{}, interface{}) error
 		Close()
+		//设置属性，Session回收时自动清除
+		Set(string, any)
+		//获取属性
+		Get(string) (any, bool)
+		//删除属性
+		Delete(string)
+		//绑定用户标识，同一个服务内唯一，0为解除绑定
+		BindUser(uint64)
+		//绑定的用户标识，没有绑定时为0
+		UserID() uint64
+		//连接质量和流量统计
+		Stats() SessionStats
+		//TLS对端证书的身份，没有开启TLS或对端没有证书时为空
+		PeerIdentity() PeerIdentity
 	}
 	//信道接口
 	IChannel interface {
 		Start()
 		Stop()
 		Send(data []byte)
+		//等待发送队列写完，超时返回false
+		Flush(time.Duration) bool
+		//发送队列状态
+		QueueStats() QueueStats
 		RemoteAddr() string
 		LocalAddr() string
 		SetSession(ISession)
 	}
 
+	//QueueStats Session发送队列状态
+	QueueStats struct {
+		//等待写入的包数量
+		Depth int `json:"depth"`
+		//队列长度
+		Capacity int `json:"capacity"`
+		//队列满时丢弃的包数量
+		Dropped uint64 `json:"dropped"`
+	}
+
+	//SessionStats 连接质量和流量统计，RTT在Samples为0时无效
+	SessionStats struct {
+		//心跳往返时间的平滑值
+		RTT time.Duration `json:"rtt"`
+		//RTT的抖动
+		Jitter time.Duration `json:"jitter"`
+		//心跳丢失率估计 0~1
+		Loss float64 `json:"loss"`
+		//收到回应的心跳数量
+		Samples  uint64 `json:"samples"`
+		BytesIn  uint64 `json:"bytes_in"`
+		BytesOut uint64 `json:"bytes_out"`
+		//收发的消息数量(单向、RPC请求、RPC回应)
+		MsgsIn  uint64 `json:"msgs_in"`
+		MsgsOut uint64 `json:"msgs_out"`
+	}
+
+	//PeerIdentity TLS对端证书的身份
+	PeerIdentity struct {
+		CommonName string   `json:"common_name,omitempty"`
+		DNSNames   []string `json:"dns_names,omitempty"`
+	}
+
+	//CloseReason Session断开的原因
+	CloseReason string
+
+	//LimitStats 服务的限流统计，超出限制的次数
+	LimitStats struct {
+		Msg   uint64 `json:"msg"`
+		Bytes uint64 `json:"bytes"`
+		Cmd   uint64 `json:"cmd"`
+		Conn  uint64 `json:"conn"`
+		//准入拒绝的连接
+		Admit uint64 `json:"admit"`
+	}
+
 	//rpc接口
 	IRPC interface {
 		//获取GRpc服务
@@ -72,3 +162,45 @@ type (
 		Await() error
 	}
 )
+
+const (
+	//对端断开或读写失败
+	CloseRemote CloseReason = "remote"
+	//本端调用Close
+	CloseLocal CloseReason = "local"
+	//超过空闲时间没有收到任何包
+	CloseIdle CloseReason = "idle"
+	//握手失败或超时
+	CloseHandshake CloseReason = "handshake"
+	//包格式错误或解密失败
+	CloseProtocol CloseReason = "protocol"
+	//超出限流
+	CloseLimit CloseReason = "limit"
+	//发送队列已满
+	CloseOverflow CloseReason = "overflow"
+	//服务停止
+	CloseShutdown CloseReason = "shutdown"
+	//断线保留超时没有恢复
+	CloseExpired CloseReason = "expired"
+)
+
+// IsZero 没有证书身份
+func (identity PeerIdentity) IsZero() bool {
+	return identity.CommonName == "" && len(identity.DNSNames) == 0
+}
+
+// HasName CN或DNS SAN中是否有这个名字
+func (identity PeerIdentity) HasName(name string) bool {
+	if name == "" {
+		return false
+	}
+	if identity.CommonName == name {
+		return true
+	}
+	for _, dnsName := range identity.DNSNames {
+		if dnsName == name {
+			return true
+		}
+	}
+	return false
+}
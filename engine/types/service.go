@@ -7,6 +7,8 @@ type (
 		GetType() string
 		GetVersion() string
 		IsLocation() bool
+		//是否正在关闭
+		IsDraining() bool
 		//GetRpcAddr 获取rpc地址
 		GetRpcAddr() string
 		//GetOutsideAddr 获取外部通信地址
@@ -41,6 +43,13 @@ func WithExcludeID(id uint) ServiceOptionFunc {
 	}
 }
 
+// 获取未处于关闭中的服务器，GetServiceEntitys默认已排除，GetAllServiceEntitys时使用
+func WithExcludeDraining() ServiceOptionFunc {
+	return func(entity IServiceEntity) bool {
+		return !entity.IsDraining()
+	}
+}
+
 // 获取指定ID外的服务器
 func WithExcludeIDs(ids []uint) ServiceOptionFunc {
 	return func(entity IServiceEntity) bool {
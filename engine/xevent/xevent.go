@@ -17,6 +17,10 @@ type Event struct {
 	bingFnMap map[interface{}]reflect.Value
 	onLock    sync.RWMutex
 	onFnMap   map[interface{}]map[string]reflect.Value
+	//Run派发队列，按派发顺序执行
+	queueLock sync.Mutex
+	queue     []func()
+	running   bool
 }
 
 // New 创建事件实例
@@ -79,29 +83,72 @@ func (evt *Event) Offs(event interface{}) {
 }
 
 // Run 派发事件 不会返回参数
+// 事件异步执行，同一个Event的所有事件在同一个协程中按Run的调用顺序执行，
+// 监听中不要阻塞，否则后续事件都会等待
 func (evt *Event) Run(event interface{}, params ...interface{}) {
 	evt.onLock.RLock()
 	fnMap, ok := evt.onFnMap[event]
-	evt.onLock.RUnlock()
-	if !ok {
+	if !ok || len(fnMap) == 0 {
+		evt.onLock.RUnlock()
 		return
 	}
-	go func() {
-		for key := range fnMap {
-			fn := fnMap[key]
-			numIn := fn.Type().NumIn()
-			in := make([]reflect.Value, numIn)
-			for i := range params {
-				if i >= numIn {
-					break
-				}
-				param := params[i]
-				in[i] = reflect.ValueOf(param)
-			}
-			fn.Call(in)
+	//复制一份，派发过程中可以安全的On/Off
+	fns := make([]reflect.Value, 0, len(fnMap))
+	for _, fn := range fnMap {
+		fns = append(fns, fn)
+	}
+	evt.onLock.RUnlock()
+	evt.push(func() {
+		for _, fn := range fns {
+			runFn(event, fn, params)
 		}
-	}()
+	})
+}
+
+func (evt *Event) push(job func()) {
+	evt.queueLock.Lock()
+	defer evt.queueLock.Unlock()
+	evt.queue = append(evt.queue, job)
+	if !evt.running {
+		evt.running = true
+		go evt.drain()
+	}
+}
 
+// drain 执行队列中的事件，队列为空时退出协程
+func (evt *Event) drain() {
+	for {
+		evt.queueLock.Lock()
+		if len(evt.queue) == 0 {
+			evt.running = false
+			evt.queueLock.Unlock()
+			return
+		}
+		job := evt.queue[0]
+		evt.queue[0] = nil
+		evt.queue = evt.queue[1:]
+		evt.queueLock.Unlock()
+		job()
+	}
+}
+
+func runFn(event interface{}, fn reflect.Value, params []interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error().Interface("Event", event).Interface("Panic", r).Msg("事件回调异常")
+		}
+	}()
+	fnType := fn.Type()
+	numIn := fnType.NumIn()
+	in := make([]reflect.Value, numIn)
+	for i := range in {
+		if i < len(params) && params[i] != nil {
+			in[i] = reflect.ValueOf(params[i])
+		} else {
+			in[i] = reflect.Zero(fnType.In(i))
+		}
+	}
+	fn.Call(in)
 }
 
 func (evt *Event) Has(event interface{}, task interface{}) bool {
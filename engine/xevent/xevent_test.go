@@ -0,0 +1,76 @@
+package xevent
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunOrdered(t *testing.T) {
+	evt := New()
+	const count = 1000
+	var (
+		lock sync.Mutex
+		got  []string
+		done = make(chan struct{})
+	)
+	record := func(name string) func(id int) {
+		return func(id int) {
+			lock.Lock()
+			got = append(got, name)
+			if len(got) == count*2 {
+				close(done)
+			}
+			lock.Unlock()
+		}
+	}
+	evt.On("accepted", record("accepted"))
+	evt.On("closed", record("closed"))
+	for i := 0; i < count; i++ {
+		evt.Run("accepted", i)
+		evt.Run("closed", i)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("事件没有执行完")
+	}
+	for i := 0; i < len(got); i += 2 {
+		if got[i] != "accepted" || got[i+1] != "closed" {
+			t.Fatalf("第 %d 个事件顺序错误: %v", i, got[i:i+2])
+		}
+	}
+}
+
+func TestRunParams(t *testing.T) {
+	evt := New()
+	results := make(chan int, 4)
+	evt.On("evt", func(id int, name string) {
+		if name != "" {
+			results <- id
+		} else {
+			results <- -id
+		}
+	})
+	evt.On("panic", func() {
+		panic("boom")
+	})
+	evt.Run("panic")
+	evt.Run("evt", 1, "a")
+	evt.Run("evt", 2)
+	//监听中可以继续派发事件
+	evt.On("nested", func() {
+		evt.Run("evt", 3, "c")
+	})
+	evt.Run("nested")
+	for _, want := range []int{1, -2, 3} {
+		select {
+		case id := <-results:
+			if id != want {
+				t.Errorf("id = %d, 应为 %d", id, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("没有收到事件 %d", want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gox
+
+import "github.com/xhaoh94/gox/engine/types"
+
+// 框架事件，通过gox.Event.On监听，事件异步派发，按发生顺序依次执行
+const (
+	//配置热更新 参数:ConfigChange
+	EventConfigChange = "gox.config.change"
+	//运维广播命令 参数:string 广播内容，由业务模块发送给客户端
+	EventBroadcast = "gox.command.broadcast"
+
+	//App初始化完成 参数:*App
+	EventAppInit = "gox.app.init"
+	//网络系统启动完成 参数:*App
+	EventNetworkStarted = "gox.network.started"
+	//所有模块启动完成 参数:*App
+	EventModulesStarted = "gox.modules.started"
+	//开始关闭 参数:*App
+	EventShutdown = "gox.shutdown.begin"
+
+	//发现服务(注册或更新) 参数:types.IServiceEntity
+	EventServiceDiscovered = "gox.service.discovered"
+	//服务注销 参数:types.IServiceEntity
+	EventServiceLost = "gox.service.lost"
+
+	//接收到新连接 参数:SessionEvent
+	EventSessionAccepted = "gox.session.accepted"
+	//连接断开 参数:SessionEvent
+	EventSessionClosed = "gox.session.closed"
+	//断线恢复，新连接交给原来的Session，接收新连接的临时Session回收时不触发EventSessionClosed 参数:SessionEvent
+	EventSessionResumed = "gox.session.resumed"
+
+	//本服务器注册定位实体 参数:uint32 LocationID
+	EventLocationRegistered = "gox.location.registered"
+	//本服务器注销定位实体 参数:uint32 LocationID
+	EventLocationUnregistered = "gox.location.unregistered"
+)
+
+type (
+	//ConfigChange 配置热更新事件参数
+	ConfigChange struct {
+		Old AppConf
+		New AppConf
+	}
+	//SessionEvent 连接事件参数，Session会被回收，事件中只保留信息
+	SessionEvent struct {
+		ID         uint32
+		RemoteAddr string
+		//accept:接收的连接 connector:主动发起的连接
+		Tag string
+		//是否是内部服务的连接
+		Interior bool
+		//绑定的用户标识，没有绑定时为0
+		UserID uint64
+		//断开的原因，只在EventSessionClosed中有值
+		Reason types.CloseReason
+		//断线恢复时接收新连接的临时Session，只在EventSessionResumed中有值
+		TempID uint32
+	}
+)
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"log"
 	"time"
@@ -10,10 +9,9 @@ import (
 	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/network"
 	"github.com/xhaoh94/gox/engine/network/codec"
-	"github.com/xhaoh94/gox/engine/network/protoreg"
-	"github.com/xhaoh94/gox/engine/network/service/ws"
+	"github.com/xhaoh94/gox/engine/network/service/tcp"
 	"github.com/xhaoh94/gox/engine/types"
-	"github.com/xhaoh94/gox/examples/netpack"
+	"github.com/xhaoh94/gox/examples/pb"
 )
 
 type (
@@ -25,59 +23,57 @@ type (
 )
 
 func (m *MainModule) OnInit() {
-	protoreg.Register(netpack.CMD_G2C_Login, m.RspToken)
-	protoreg.Register(netpack.CMD_L2C_Login, m.RspLogin)
-	protoreg.Register(netpack.CMD_L2C_Enter, m.RspEnter)
-
 }
 
-// OnStart
+// OnStart 登录后进入场景，服务端的outside开启了encrypt，连接后先握手，Call等握手完成后加密发送
 func (m *MainModule) OnStart() {
-	logger.Debug().Msg("test")
 	time.Sleep(1 * time.Second)
-	// session := gox.NetWork.GetSessionByAddr("127.0.0.1:10002") //向gate服务器请求token
-	// session.Send(netpack.CMD_C2G_Login, &netpack.C2G_Login{User: "xhaoh94", Password: "123456"})
-	// m.session = session
-
-	session := gox.NetWork.GetSessionByAddr("127.0.0.1:20002")
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 1, UnitId: 100})
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 1, UnitId: 200})
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 2, UnitId: 300})
-}
-
-func (m *MainModule) RspToken(ctx context.Context, session types.ISession, rsp *netpack.G2C_Login) {
-	if rsp.Code != 0 { //请求token错误
+	session := gox.NetWork.GetSessionByAddr("127.0.0.1:10002") //向login服务器请求token
+	if session == nil {
+		logger.Error().Msg("连接login服务器失败")
 		return
 	}
-	defer session.Close() //老的session已经没用了，可以关闭掉
-	logger.Debug().Msgf("返回数据:%v", rsp)
-	loginSession := gox.NetWork.GetSessionByAddr(rsp.Addr)                                          //创建session连接login服务器
-	loginSession.Send(netpack.CMD_C2L_Login, &netpack.C2L_Login{User: "xhaoh94", Token: rsp.Token}) //向login服务器请求登录
-	m.session = loginSession                                                                        //保存新的session
-}
-
-func (m *MainModule) RspLogin(ctx context.Context, session types.ISession, rsp *netpack.L2C_Login) {
-	logger.Debug().Msgf("登录结果返回Code:%d", rsp.Code)
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 1, UnitId: 100})
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 1, UnitId: 200})
-	session.Send(netpack.CMD_C2L_Enter, &netpack.C2L_Enter{SceneId: 2, UnitId: 300})
-}
+	loginRsp := &pb.S2C_LoginGame{}
+	if err := session.CallByCmd(pb.CMD_C2S_LoginGame, &pb.C2S_LoginGame{Account: "xhaoh94", Password: "123456"}, loginRsp); err != nil {
+		logger.Error().Err(err).Msg("请求token失败")
+		return
+	}
+	session.Close() //老的session已经没用了，可以关闭掉
+	if loginRsp.Error != pb.ErrCode_Success {
+		logger.Error().Msgf("请求token错误Code:%d", loginRsp.Error)
+		return
+	}
+	logger.Debug().Msgf("返回数据:%v", loginRsp)
 
-func (m *MainModule) RspEnter(ctx context.Context, session types.ISession, rsp *netpack.L2C_Enter) {
-	logger.Debug().Msgf("进入结果返回Code:%d", rsp.Code)
+	gateSession := gox.NetWork.GetSessionByAddr(loginRsp.Addr) //创建session连接gate服务器
+	if gateSession == nil {
+		logger.Error().Msg("连接gate服务器失败")
+		return
+	}
+	enterRsp := &pb.S2C_EnterScene{}
+	req := &pb.C2S_EnterScene{Account: "xhaoh94", Token: loginRsp.Token, Sceneid: 1}
+	if err := gateSession.CallByCmd(pb.CMD_C2S_EnterScene, req, enterRsp); err != nil {
+		logger.Error().Err(err).Msg("进入场景失败")
+		return
+	}
+	logger.Debug().Msgf("进入结果返回Code:%d", enterRsp.Error)
+	m.session = gateSession //保存新的session
 }
 
 // 模拟客户端发数据
 func main() {
 	var appConfPath string
-	flag.StringVar(&appConfPath, "appConf", "app_1.yaml", "启动配置")
+	flag.StringVar(&appConfPath, "appConf", "app_client.yaml", "启动配置")
+	gox.RegisterFlags(flag.CommandLine) //--set key=value 覆盖配置, --print-config 打印配置
 	flag.Parse()
 	if appConfPath == "" {
 		log.Fatalf("需要启动配置文件路径")
 	}
-	gox.Init(appConfPath)
+	if err := gox.Init(appConfPath); err != nil {
+		log.Fatal(err)
+	}
 	network := network.New()
-	network.SetInteriorService(new(ws.WService), codec.Json)
+	network.SetInteriorService(new(tcp.TService), codec.Protobuf) //和uxgame的outside一致
 	gox.SetNetWork(network)
 	gox.SetModule(new(MainModule))
 	gox.Run()
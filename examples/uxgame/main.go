@@ -15,11 +15,14 @@ func main() {
 
 	var appConfPath string
 	flag.StringVar(&appConfPath, "appConf", "app_2.yaml", "启动配置")
+	gox.RegisterFlags(flag.CommandLine) //--set key=value 覆盖配置, --print-config 打印配置
 	flag.Parse()
 	if appConfPath == "" {
 		log.Fatalf("需要启动配置文件路径")
 	}
-	gox.Init(appConfPath)
+	if err := gox.Init(appConfPath); err != nil {
+		log.Fatal(err)
+	}
 	network := network.New()
 	network.SetInteriorService(new(tcp.TService), codec.Protobuf)
 
@@ -18,11 +18,8 @@ type (
 	//GateModule 网关
 	GateModule struct {
 		gox.Module
-		muxToken    sync.RWMutex
-		userToken   map[string]UserToken
-		muxSession  sync.RWMutex
-		roleSession map[uint32]uint32
-		sessionRole map[uint32]uint32
+		muxToken  sync.RWMutex
+		userToken map[string]UserToken
 	}
 	UserToken struct {
 		user  string
@@ -34,24 +31,20 @@ type (
 // OnInit 初始化
 func (m *GateModule) OnInit() {
 	m.userToken = make(map[string]UserToken)
-	m.roleSession = make(map[uint32]uint32)
-	m.sessionRole = make(map[uint32]uint32)
 	pb.RegisterILoginGameServer(gox.NetWork.Rpc().GRpcServer(), m)
 	protoreg.RegisterRpcCmd(pb.CMD_C2S_EnterScene, m.EnterScene)
 	protoreg.Register(pb.CMD_C2S_Move, m.Move)
 
 	protoreg.Register(game.InteriorRelay, m.InteriorRelay)
 
-	gox.NetWork.Outside().LinstenByDelSession(m.OnSessionStop)
+	gox.Event.On(gox.EventSessionClosed, m.OnSessionStop)
 }
-func (m *GateModule) OnSessionStop(sid uint32) {
-	m.muxSession.Lock()
-	if rid, ok := m.sessionRole[sid]; ok {
-		delete(m.sessionRole, sid)
-		delete(m.roleSession, rid)
-		gox.Location.Send(rid, &pb.C2S_LeaveScene{RoleId: rid})
+func (m *GateModule) OnSessionStop(evt gox.SessionEvent) {
+	if evt.Interior || evt.UserID == 0 {
+		return
 	}
-	m.muxSession.Unlock()
+	rid := uint32(evt.UserID)
+	gox.Location.Send(rid, &pb.C2S_LeaveScene{RoleId: rid})
 }
 
 func (m *GateModule) LoginGame(ctx context.Context, req *pb.C2S_LoginGame) (*pb.S2C_LoginGame, error) {
@@ -96,32 +89,23 @@ func (m *GateModule) EnterScene(ctx context.Context, session types.ISession, req
 		if resp.Error == pb.ErrCode_UnKnown {
 			return resp, nil
 		}
-		m.muxSession.Lock()
-		sID := session.ID()
-		m.roleSession[resp.Self.RoleId] = sID
-		m.sessionRole[sID] = resp.Self.RoleId
-		m.muxSession.Unlock()
+		session.BindUser(uint64(resp.Self.RoleId))
 	}
 	return resp, nil
 }
 
 func (m *GateModule) Move(ctx context.Context, session types.ISession, req *pb.C2S_Move) {
-	m.muxSession.RLock()
-	defer m.muxSession.RUnlock()
-	if rid, ok := m.sessionRole[session.ID()]; ok {
+	if rid := uint32(session.UserID()); rid != 0 {
 		logger.Debug().Msgf("玩家移动RID:%d", rid)
 		gox.Location.Send(rid, req)
 	}
 }
 
 func (m *GateModule) InteriorRelay(ctx context.Context, session types.ISession, req *game.Interior_Relay) {
-
-	defer m.muxSession.RUnlock()
-	m.muxSession.RLock()
 	logger.Debug().Msgf("转发消息CMD:%d", req.CMD)
+	outside := gox.NetWork.Outside()
 	for _, roleId := range req.Roles {
-		if sid, ok := m.roleSession[roleId]; ok {
-			_session := gox.NetWork.GetSessionById(sid)
+		if _session := outside.GetSessionByUser(uint64(roleId)); _session != nil {
 			_session.Send(req.CMD, req.Require)
 		}
 	}
@@ -8,7 +8,6 @@ import (
 	"github.com/xhaoh94/gox"
 	"github.com/xhaoh94/gox/engine/common/vec"
 	"github.com/xhaoh94/gox/engine/logger"
-	"github.com/xhaoh94/gox/engine/mgrs/timemgr"
 	"github.com/xhaoh94/gox/engine/network/location"
 	"github.com/xhaoh94/gox/engine/network/protoreg"
 	"github.com/xhaoh94/gox/engine/types"
@@ -43,8 +42,7 @@ func newUnit(entity *pb.Entity, gateSession types.ISession) *Unit {
 		Position:    vec.CreateVector3(entity.Position.X, entity.Position.Y, entity.Position.Z),
 		GateSession: gateSession.ID(),
 	}
-	gox.Location.Register(unit) //添加到Location
-	timemgr.Add(unit.update)
+	gox.Location.Register(unit) //添加到Location，实现了OnUpdate会按帧更新
 	return unit
 }
 
@@ -66,10 +64,11 @@ func (unit *Unit) GetAOIResult() types.IAOIResult[uint32] {
 	return unit.aoiResult
 }
 
-func (unit *Unit) update() {
-	unit.move()
+// OnUpdate 每帧更新
+func (unit *Unit) OnUpdate(dt float32) {
+	unit.move(dt)
 }
-func (unit *Unit) move() {
+func (unit *Unit) move(dt float32) {
 	unit.moveMux.Lock()
 	defer unit.moveMux.Unlock()
 	if !unit.isMove {
@@ -82,7 +81,7 @@ func (unit *Unit) move() {
 		point := unit.points[unit.moveIndex]
 		target := vec.CreateVector3(point.X, point.Y, point.Z)
 		dir := target.Sub(unit.Position)
-		unit.Position = unit.Position.Add(dir.Normalize().MulNumber(timemgr.DeltaTime * 5))
+		unit.Position = unit.Position.Add(dir.Normalize().MulNumber(dt * 5))
 		unit.freshAOI()
 		if dir.SqrMagnitude() <= 0.1 {
 			unit.moveIndex++
@@ -2,114 +2,76 @@ package gox
 
 import (
 	"context"
-	"log"
-	"os"
-	"os/signal"
-	"syscall"
 
-	"github.com/xhaoh94/gox/engine/app"
-	"github.com/xhaoh94/gox/engine/logger"
-	"github.com/xhaoh94/gox/engine/mgrs/timemgr"
+	"github.com/xhaoh94/gox/engine/command"
 	"github.com/xhaoh94/gox/engine/types"
 	"github.com/xhaoh94/gox/engine/xevent"
-
-	yaml "gopkg.in/yaml.v3"
 )
 
+// 包级变量是默认App的包装，只有一个节点的进程直接使用
 var (
-	__init      bool
-	__start     bool
-	Ctx         context.Context
-	ctxCancelFn context.CancelFunc
-	Config      AppConf
-	Event       types.IEvent
+	Config AppConf
+	//默认App
+	Default = &App{Config: &Config, Event: xevent.New(), Commands: command.New()}
 
+	Ctx context.Context
+	//事件，Init之前就可以监听
+	Event = Default.Event
 	//网络服务
 	NetWork types.INetwork
 	// 定位系统
-	Location   types.ILocationSystem
-	mainModule types.IModule
+	Location types.ILocationSystem
+	//运维命令，模块在OnInit中注册
+	Commands = Default.Commands
 )
 
-func Init(appConfPath string) {
-	if __init {
-		log.Printf("gox: 重复初始化")
-		return
-	}
-	__init = true
-	Ctx, ctxCancelFn = context.WithCancel(context.Background())
-	Event = xevent.New()
-	Config = loadConf(appConfPath)
-	if Config.AppID == 0 {
-		log.Printf("gox: AppID 必须大于0")
-		return
-	}
-	logger.Init(Config.LogConfPath, Config.Development)
-}
-
-func loadConf(appConfPath string) AppConf {
-	AppCfg := AppConf{}
-	bytes, err := os.ReadFile(appConfPath)
-	if err != nil {
-		log.Fatalf("LoadAppConfig err:[%v] path:[%s]", err, appConfPath)
-		return AppCfg
-	}
-	err = yaml.Unmarshal(bytes, &AppCfg)
-	if err != nil {
-		log.Fatalf("LoadAppConfig err:[%v] path:[%s]", err, appConfPath)
-		return AppCfg
-	}
-	return AppCfg
+// Init 初始化默认App，按 YAML < 环境变量 < --set参数 的优先级加载配置并校验
+func Init(appConfPath string) error {
+	return Default.Init(appConfPath)
 }
 
-// Run 启动
+// Run 启动默认App
 func Run() {
-	if __start {
-		return
-	}
-	__start = true
-	if mainModule == nil {
-		logger.Fatal().Msg("gox: 没有设置主模块")
-		return
-	}
-	defer app.Recover()
-
-	logger.Info().Uint("ID", Config.AppID).Str("Type", Config.AppType).Str("Version", Config.Version).Msg("服务启动")
-	logger.Info().Msgf("[ByteOrder:%s]", Config.Network.Endian)
-	timemgr.Start(30)
-	NetWork.Init()
-	mainModule.Init(mainModule)
-	NetWork.Start()
-	mainModule.Start(mainModule)
-
-	logger.Info().Msg("服务启动成功")
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-	shutdown()
-	os.Exit(1)
-}
-
-// Shutdown 关闭
-func shutdown() {
-	__start = false
-	ctxCancelFn()
-	timemgr.Stop()
-	mainModule.Destroy(mainModule)
-	NetWork.Destroy()
-	logger.Info().Msgf("服务退出[sid:%d]", Config.AppID)
+	Default.Run()
 }
 
 ////////////////////////////////////////////////////////////////
 
 // SetModule 设置网络模块
 func SetNetWork(network types.INetwork) {
-	NetWork = network
+	Default.SetNetWork(network)
 }
 
 // SetModule 设置初始模块
 func SetModule(module types.IModule) {
-	mainModule = module
+	Default.SetModule(module)
+}
+
+// GetModule 通过模块名获取模块
+func GetModule(name string) types.IModule {
+	return Default.GetModule(name)
+}
+
+// FindModule 通过类型获取模块 例:gox.FindModule[*gate.GateModule]()
+func FindModule[T types.IModule]() (T, bool) {
+	return FindAppModule[T](Default)
+}
+
+// FindAppModule 通过类型获取指定App的模块 例:gox.FindAppModule[*gate.GateModule](app)
+func FindAppModule[T types.IModule](a *App) (T, bool) {
+	var result T
+	var found bool
+	if a.mainModule == nil {
+		return result, false
+	}
+	walkModules(a.mainModule, func(mod types.IModule) bool {
+		if v, ok := mod.(T); ok {
+			result, found = v, true
+			return false
+		}
+		return true
+	})
+	return result, found
 }
 
 ////////////////////////////////////////////////////////////
@@ -0,0 +1,142 @@
+package goxtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network"
+)
+
+type (
+	//blockModule 启动时等待放行
+	blockModule struct {
+		gox.Module
+		starting chan struct{}
+		release  chan struct{}
+	}
+	//failRegistry 写入总是失败的注册表
+	failRegistry struct {
+		network.Registry
+	}
+)
+
+func (module *blockModule) OnStart() {
+	close(module.starting)
+	<-module.release
+}
+
+func (registry failRegistry) Put(key, value string) error {
+	return errors.New("注册失败")
+}
+
+func adminGet(t *testing.T, addr string, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get("http://" + addr + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// adminJson 请求管理接口并解析JSON
+func adminJson(t *testing.T, addr string, path string, v any) {
+	t.Helper()
+	code, body := adminGet(t, addr, path)
+	if code != http.StatusOK {
+		t.Fatalf("%s code = %d body=%s", path, code, body)
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("%s 解析失败 %v body=%s", path, err, body)
+	}
+}
+
+func TestAdminReadyz(t *testing.T) {
+	addr := FreeAddr(t)
+	module := &blockModule{starting: make(chan struct{}), release: make(chan struct{})}
+	cluster := NewCluster(t, NodeConf{AppID: 1, AppType: "gate", Location: true, Module: module, Setup: func(conf *gox.AppConf) {
+		conf.AdminAddr = addr
+	}})
+	started := make(chan struct{})
+	go func() {
+		cluster.Start()
+		close(started)
+	}()
+	select {
+	case <-module.starting:
+	case <-time.After(3 * time.Second):
+		t.Fatal("模块没有启动")
+	}
+
+	//模块启动完成前存活但没有就绪
+	if code, body := adminGet(t, addr, "/healthz"); code != http.StatusOK || body != "ok" {
+		t.Errorf("healthz = %d %s", code, body)
+	}
+	if code, body := adminGet(t, addr, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not started") {
+		t.Errorf("启动中 readyz = %d %s", code, body)
+	}
+	close(module.release)
+	<-started
+	if code, body := adminGet(t, addr, "/readyz"); code != http.StatusOK {
+		t.Errorf("启动后 readyz = %d %s", code, body)
+	}
+
+	var services []map[string]any
+	adminJson(t, addr, "/services", &services)
+	if len(services) != 1 {
+		t.Errorf("services = %v", services)
+	}
+	var sessions map[string]json.RawMessage
+	adminJson(t, addr, "/sessions", &sessions)
+	if _, ok := sessions["interior"]; !ok {
+		t.Errorf("sessions = %v", sessions)
+	}
+	var locations map[string]map[string]uint
+	adminJson(t, addr, "/locations", &locations)
+	if _, ok := locations["self"]; !ok {
+		t.Errorf("locations = %v", locations)
+	}
+	if _, ok := locations["other"]; !ok {
+		t.Errorf("locations = %v", locations)
+	}
+	var protocols []any
+	adminJson(t, addr, "/protocols", &protocols)
+	if len(protocols) == 0 {
+		t.Error("protocols 为空")
+	}
+
+	//开始关闭后在注册表中下线，不再就绪
+	cluster.Node(1).NetWork.Drain(context.Background())
+	if code, body := adminGet(t, addr, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not registered") {
+		t.Errorf("下线后 readyz = %d %s", code, body)
+	}
+}
+
+func TestAdminReadyzNotRegistered(t *testing.T) {
+	addr := FreeAddr(t)
+	cluster := NewCluster(t, NodeConf{AppID: 1, AppType: "gate", Setup: func(conf *gox.AppConf) {
+		conf.AdminAddr = addr
+	}})
+	node := cluster.Node(1)
+	node.NetWork.SetRegistry(failRegistry{cluster.Registry.Client()})
+	node.App.Start()
+	defer node.App.Shutdown()
+	if !node.App.IsReady() {
+		t.Fatal("模块应该已经启动")
+	}
+	//模块已启动但注册失败
+	if code, body := adminGet(t, addr, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not registered") {
+		t.Errorf("readyz = %d %s", code, body)
+	}
+}
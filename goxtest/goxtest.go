@@ -0,0 +1,176 @@
+// Package goxtest 在一个进程内启动多个节点组成集群，用于集成测试
+//
+// 节点之间通过本地回环地址通信，服务注册使用进程内的注册表，不需要etcd
+//
+//	cluster := goxtest.NewCluster(t,
+//		goxtest.NodeConf{AppID: 1, AppType: "gate"},
+//		goxtest.NodeConf{AppID: 2, AppType: "scene", Location: true},
+//	)
+//	cluster.Start()
+//	scene := cluster.Node(2)
+//	scene.App.Location.Register(unit)
+//	err := cluster.Node(1).App.Location.Call(unit.LocationID(), req, resp)
+//
+// protoreg 是进程内全局注册的，多个节点共用同一份协议处理函数，
+// 处理函数中通过 gox.FromContext(ctx) 获取收到消息的节点
+package goxtest
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network"
+	"github.com/xhaoh94/gox/engine/network/codec"
+	"github.com/xhaoh94/gox/engine/network/service/tcp"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	//NodeConf 节点配置
+	NodeConf struct {
+		AppID   uint
+		AppType string
+		//是否开启定位
+		Location bool
+		//主模块，为空时使用空模块
+		Module types.IModule
+		//内部通信解析方式，默认MsgPack
+		Codec types.ICodec
+		//启动前修改配置
+		Setup func(conf *gox.AppConf)
+	}
+	//Node 集群中的节点
+	Node struct {
+		App     *gox.App
+		NetWork *network.NetWork
+	}
+	//Cluster 进程内的多节点集群
+	Cluster struct {
+		tb       testing.TB
+		Registry *network.MemoryRegistry
+		nodes    []*Node
+		started  bool
+	}
+)
+
+// NewCluster 创建集群，测试结束时自动关闭
+func NewCluster(tb testing.TB, confs ...NodeConf) *Cluster {
+	tb.Helper()
+	cluster := &Cluster{
+		tb:       tb,
+		Registry: network.NewMemoryRegistry(),
+	}
+	for _, conf := range confs {
+		cluster.Add(conf)
+	}
+	tb.Cleanup(cluster.Stop)
+	return cluster
+}
+
+// Add 添加节点，需要在Start之前调用
+func (cluster *Cluster) Add(nodeConf NodeConf) *Node {
+	tb := cluster.tb
+	tb.Helper()
+	if cluster.started {
+		tb.Fatalf("goxtest: 集群已启动，不能再添加节点")
+	}
+	if cluster.Node(nodeConf.AppID) != nil {
+		tb.Fatalf("goxtest: 节点[%d]重复添加", nodeConf.AppID)
+	}
+	conf := gox.AppConf{
+		Development:  true,
+		AppID:        nodeConf.AppID,
+		AppType:      nodeConf.AppType,
+		Version:      "test",
+		InteriorAddr: FreeAddr(tb),
+		Location:     nodeConf.Location,
+		Network: gox.NetworkConf{
+			Endian:         binary.LittleEndian,
+			Heartbeat:      30 * time.Second,
+			ConnectTimeout: 3 * time.Second,
+		},
+		ShutdownTimeout: 3,
+	}
+	if nodeConf.Setup != nil {
+		nodeConf.Setup(&conf)
+	}
+	app := gox.NewApp()
+	if err := app.InitConf(conf); err != nil {
+		tb.Fatalf("goxtest: 节点[%d]初始化失败 %v", nodeConf.AppID, err)
+	}
+	netCodec := nodeConf.Codec
+	if netCodec == nil {
+		netCodec = codec.MsgPack
+	}
+	nw := network.NewWithApp(app)
+	nw.SetRegistry(cluster.Registry.Client())
+	nw.SetInteriorService(new(tcp.TService), netCodec)
+	app.SetNetWork(nw)
+	module := nodeConf.Module
+	if module == nil {
+		module = new(gox.Module)
+	}
+	app.SetModule(module)
+
+	node := &Node{App: app, NetWork: nw}
+	cluster.nodes = append(cluster.nodes, node)
+	return node
+}
+
+// Start 按添加顺序启动所有节点，并确认节点之间互相可见
+func (cluster *Cluster) Start() {
+	tb := cluster.tb
+	tb.Helper()
+	if cluster.started {
+		return
+	}
+	cluster.started = true
+	for _, node := range cluster.nodes {
+		node.App.Start()
+	}
+	for _, node := range cluster.nodes {
+		if cnt := len(node.NetWork.GetServiceEntitys()); cnt != len(cluster.nodes) {
+			tb.Fatalf("goxtest: 节点[%d]只发现了%d个服务，应为%d个", node.App.Conf().AppID, cnt, len(cluster.nodes))
+		}
+	}
+}
+
+// Stop 按启动的逆序关闭所有节点
+func (cluster *Cluster) Stop() {
+	if !cluster.started {
+		return
+	}
+	cluster.started = false
+	for i := len(cluster.nodes) - 1; i >= 0; i-- {
+		cluster.nodes[i].App.Shutdown()
+	}
+}
+
+// Node 通过AppID获取节点
+func (cluster *Cluster) Node(appID uint) *Node {
+	for _, node := range cluster.nodes {
+		if node.App.Conf().AppID == appID {
+			return node
+		}
+	}
+	return nil
+}
+
+// Nodes 获取所有节点
+func (cluster *Cluster) Nodes() []*Node {
+	return append([]*Node(nil), cluster.nodes...)
+}
+
+// FreeAddr 获取一个本地回环的空闲地址
+func FreeAddr(tb testing.TB) string {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("goxtest: 获取空闲端口失败 %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
@@ -0,0 +1,181 @@
+package goxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/location"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	EchoRequire struct {
+		Msg string
+		//处理前等待的毫秒数
+		Delay int
+	}
+	EchoResponse struct {
+		Msg   string
+		AppID uint
+	}
+	NotifyRequire struct {
+		Msg string
+	}
+	UnitRequire struct {
+		Msg string
+	}
+	UnitResponse struct {
+		Msg        string
+		LocationID uint32
+		AppID      uint
+	}
+
+	testUnit struct {
+		location.Location
+		id     uint32
+		inited chan struct{}
+	}
+)
+
+func (unit *testUnit) LocationID() uint32 {
+	return unit.id
+}
+func (unit *testUnit) OnInit() {
+	protoreg.AddLocationRpc(unit, unit.onCall)
+	close(unit.inited)
+}
+func (unit *testUnit) onCall(ctx context.Context, session types.ISession, req *UnitRequire) (*UnitResponse, error) {
+	return &UnitResponse{Msg: req.Msg, LocationID: unit.id, AppID: gox.FromContext(ctx).Conf().AppID}, nil
+}
+
+var notifies = make(chan *NotifyRequire, 8)
+
+func init() {
+	protoreg.RegisterRpc(func(ctx context.Context, session types.ISession, req *EchoRequire) (*EchoResponse, error) {
+		if req.Delay > 0 {
+			select {
+			case <-time.After(time.Duration(req.Delay) * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return &EchoResponse{Msg: req.Msg, AppID: gox.FromContext(ctx).Conf().AppID}, nil
+	})
+	protoreg.Register(notifyCmd, func(ctx context.Context, session types.ISession, req *NotifyRequire) {
+		notifies <- req
+	})
+}
+
+const notifyCmd uint32 = 90001
+
+func TestLocationCall(t *testing.T) {
+	cluster := NewCluster(t,
+		NodeConf{AppID: 1, AppType: "gate", Location: true},
+		NodeConf{AppID: 2, AppType: "scene", Location: true},
+	)
+	cluster.Start()
+
+	unit := &testUnit{id: 1001, inited: make(chan struct{})}
+	cluster.Node(2).App.Location.Register(unit)
+	defer cluster.Node(2).App.Location.UnRegister(unit)
+	select {
+	case <-unit.inited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("实体初始化超时")
+	}
+
+	//其他节点
+	response := &UnitResponse{}
+	if err := cluster.Node(1).App.Location.Call(unit.LocationID(), &UnitRequire{Msg: "remote"}, response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Msg != "remote" || response.LocationID != unit.id || response.AppID != 2 {
+		t.Errorf("response = %+v", response)
+	}
+
+	//本节点
+	response = &UnitResponse{}
+	if err := cluster.Node(2).App.Location.Call(unit.LocationID(), &UnitRequire{Msg: "local"}, response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Msg != "local" || response.AppID != 2 {
+		t.Errorf("response = %+v", response)
+	}
+
+	//不存在的实体
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := cluster.Node(1).App.Location.CallCtx(ctx, 9999, &UnitRequire{}, &UnitResponse{}); err == nil {
+		t.Error("不存在的实体应返回错误")
+	}
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	setup := func(conf *gox.AppConf) {
+		conf.Network.RpcTimeout = 500 * time.Millisecond
+	}
+	cluster := NewCluster(t,
+		NodeConf{AppID: 1, AppType: "gate", Setup: setup},
+		NodeConf{AppID: 2, AppType: "scene", Setup: setup},
+	)
+	cluster.Start()
+	session := cluster.Node(1).NetWork.GetSessionByAppID(2)
+	if session == nil {
+		t.Fatal("没有连接到节点2")
+	}
+
+	t.Run("Send", func(t *testing.T) {
+		if !session.Send(notifyCmd, &NotifyRequire{Msg: "hello"}) {
+			t.Fatal("发送失败")
+		}
+		select {
+		case req := <-notifies:
+			if req.Msg != "hello" {
+				t.Errorf("收到 %+v", req)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("没有收到消息")
+		}
+	})
+
+	t.Run("Call", func(t *testing.T) {
+		response := &EchoResponse{}
+		if err := session.Call(&EchoRequire{Msg: "call"}, response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Msg != "call" || response.AppID != 2 {
+			t.Errorf("response = %+v", response)
+		}
+	})
+
+	t.Run("CallCtx", func(t *testing.T) {
+		//处理时间超过network.rpc_timeout，ctx允许等待
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		response := &EchoResponse{}
+		delay := int(cluster.Node(1).App.Conf().Network.GetRpcTimeout()/time.Millisecond) + 500
+		if err := session.CallCtx(ctx, &EchoRequire{Msg: "slow", Delay: delay}, response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Msg != "slow" {
+			t.Errorf("response = %+v", response)
+		}
+	})
+
+	t.Run("CallCtx超时", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := session.CallCtx(ctx, &EchoRequire{Delay: 5000}, &EchoResponse{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, 应为超时", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("等待了 %v", elapsed)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package goxtest
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/helper/cmdhelper"
+	"github.com/xhaoh94/gox/engine/network/location"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	OrderRequire  struct{}
+	OrderResponse struct{}
+
+	orderUnit struct {
+		location.Location
+		id     uint32
+		inited chan struct{}
+	}
+)
+
+const orderCmd uint32 = 90002
+
+var (
+	orderLock sync.Mutex
+	orders    []string
+	orderOnce sync.Once
+)
+
+func (unit *orderUnit) LocationID() uint32 {
+	return unit.id
+}
+func (unit *orderUnit) OnInit() {
+	protoreg.AddLocationRpc(unit, onOrder)
+	close(unit.inited)
+}
+
+func onOrder(ctx context.Context, session types.ISession, req *OrderRequire) (*OrderResponse, error) {
+	addOrder("handler")
+	return &OrderResponse{}, nil
+}
+
+func addOrder(name string) {
+	orderLock.Lock()
+	orders = append(orders, name)
+	orderLock.Unlock()
+}
+
+// takeOrders 取出记录的执行顺序
+func takeOrders() []string {
+	orderLock.Lock()
+	defer orderLock.Unlock()
+	result := orders
+	orders = nil
+	return result
+}
+
+// orderInterceptor 只记录本测试的协议，全局和CMD拦截器注册后不能移除，不影响其他测试
+func orderInterceptor(name string) types.ProtoInterceptor {
+	return func(ctx context.Context, session types.ISession, cmd uint32, require any, next types.ProtoHandler) (any, error) {
+		switch require.(type) {
+		case *OrderRequire:
+			addOrder(name)
+		case *location.LocationRelayRequire:
+			addOrder(name + ":relay")
+		}
+		return next(ctx, session, cmd, require)
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	const unitID uint32 = 2001
+	orderOnce.Do(func() {
+		protoreg.Use(orderInterceptor("global"))
+		protoreg.RegisterRpcCmd(orderCmd, onOrder)
+		protoreg.UseCmd(orderCmd, orderInterceptor("cmd"))
+		unitCmd := cmdhelper.ToCmdByRtype(reflect.TypeOf(&OrderRequire{}), reflect.TypeOf(&OrderResponse{}), unitID)
+		protoreg.UseCmd(unitCmd, orderInterceptor("cmd"))
+	})
+	cluster := NewCluster(t,
+		NodeConf{AppID: 1, AppType: "gate", Location: true},
+		NodeConf{AppID: 2, AppType: "scene", Location: true},
+	)
+	cluster.Node(2).NetWork.Interior().Use(orderInterceptor("service"))
+	cluster.Start()
+	unit := &orderUnit{id: unitID, inited: make(chan struct{})}
+	cluster.Node(2).App.Location.Register(unit)
+	defer cluster.Node(2).App.Location.UnRegister(unit)
+	select {
+	case <-unit.inited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("实体初始化超时")
+	}
+	takeOrders()
+
+	want := []string{"global", "service", "cmd", "handler"}
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"直接发送", func() error {
+			return cluster.Node(1).NetWork.GetSessionByAppID(2).CallByCmd(orderCmd, &OrderRequire{}, &OrderResponse{})
+		}},
+		{"定位转发", func() error {
+			return cluster.Node(1).App.Location.Call(unitID, &OrderRequire{}, &OrderResponse{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err != nil {
+				t.Fatal(err)
+			}
+			if got := takeOrders(); !slices.Equal(got, want) {
+				t.Errorf("执行顺序 = %v, 应为 %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package goxtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/network/rpc"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	DeadlineRequire struct {
+		//等待ctx结束的最长毫秒数
+		Hold int
+	}
+	DeadlineResponse struct {
+		HasDeadline bool
+	}
+
+	//deadlineCall 接收方回调看到的ctx
+	deadlineCall struct {
+		hasDeadline bool
+		remain      time.Duration
+		//ctx在等待期间结束时写入ctx.Err()，否则写入nil
+		ended chan error
+	}
+)
+
+var deadlineCalls = make(chan deadlineCall, 8)
+
+func init() {
+	protoreg.RegisterRpc(func(ctx context.Context, session types.ISession, req *DeadlineRequire) (*DeadlineResponse, error) {
+		deadline, ok := ctx.Deadline()
+		call := deadlineCall{hasDeadline: ok, ended: make(chan error, 1)}
+		if ok {
+			call.remain = time.Until(deadline)
+		}
+		deadlineCalls <- call
+		select {
+		case <-ctx.Done():
+			call.ended <- ctx.Err()
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(req.Hold) * time.Millisecond):
+			call.ended <- nil
+		}
+		return &DeadlineResponse{HasDeadline: ok}, nil
+	})
+}
+
+func nextDeadlineCall(t *testing.T) deadlineCall {
+	t.Helper()
+	select {
+	case call := <-deadlineCalls:
+		return call
+	case <-time.After(3 * time.Second):
+		t.Fatal("接收方没有收到请求")
+	}
+	return deadlineCall{}
+}
+
+// waitEnded 等待接收方回调的ctx结束
+func waitEnded(t *testing.T, call deadlineCall) {
+	t.Helper()
+	select {
+	case err := <-call.ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("接收方ctx结束 err = %v, 应为取消", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("调用方放弃后接收方的ctx没有结束")
+	}
+}
+
+func TestRpcDeadline(t *testing.T) {
+	setup := func(conf *gox.AppConf) {
+		conf.Network.RpcTimeout = 300 * time.Millisecond
+		//inline方式处理期间收不到RPC_CANCEL
+		conf.Network.Dispatch = gox.DispatchPool
+	}
+	cluster := NewCluster(t,
+		NodeConf{AppID: 1, AppType: "gate", Setup: setup},
+		NodeConf{AppID: 2, AppType: "scene", Setup: setup},
+	)
+	cluster.Start()
+	session := cluster.Node(1).NetWork.GetSessionByAppID(2)
+	if session == nil {
+		t.Fatal("没有连接到节点2")
+	}
+
+	t.Run("Call不传递默认超时", func(t *testing.T) {
+		response := &DeadlineResponse{}
+		if err := session.Call(&DeadlineRequire{}, response); err != nil {
+			t.Fatal(err)
+		}
+		if call := nextDeadlineCall(t); call.hasDeadline || response.HasDeadline {
+			t.Errorf("接收方有截止时间 %v, 没有升级的节点收不到", call.remain)
+		}
+	})
+
+	t.Run("CallCtx传递截止时间", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := session.CallCtx(ctx, &DeadlineRequire{}, &DeadlineResponse{}); err != nil {
+			t.Fatal(err)
+		}
+		call := nextDeadlineCall(t)
+		if !call.hasDeadline || call.remain <= time.Second || call.remain > 2*time.Second {
+			t.Errorf("接收方截止时间 %v %v, 应在1s到2s之间", call.hasDeadline, call.remain)
+		}
+	})
+
+	t.Run("默认超时上设置更早的截止时间", func(t *testing.T) {
+		parent, cancelParent := rpc.WithDefaultTimeout(context.Background(), 5*time.Second)
+		defer cancelParent()
+		ctx, cancel := context.WithTimeout(parent, 2*time.Second)
+		defer cancel()
+		if err := session.CallCtx(ctx, &DeadlineRequire{}, &DeadlineResponse{}); err != nil {
+			t.Fatal(err)
+		}
+		if call := nextDeadlineCall(t); !call.hasDeadline || call.remain > 2*time.Second {
+			t.Errorf("接收方截止时间 %v %v, 应为2s以内", call.hasDeadline, call.remain)
+		}
+	})
+
+	t.Run("调用方取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			errs <- session.CallCtx(ctx, &DeadlineRequire{Hold: 5000}, &DeadlineResponse{})
+		}()
+		call := nextDeadlineCall(t)
+		if call.hasDeadline {
+			t.Errorf("没有截止时间的ctx传递了 %v", call.remain)
+		}
+		cancel()
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, 应为取消", err)
+		}
+		waitEnded(t, call)
+	})
+
+	t.Run("Call超时后取消", func(t *testing.T) {
+		start := time.Now()
+		err := session.Call(&DeadlineRequire{Hold: 5000}, &DeadlineResponse{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, 应为超时", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("等待了 %v", elapsed)
+		}
+		waitEnded(t, nextDeadlineCall(t))
+	})
+}
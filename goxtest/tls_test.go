@@ -0,0 +1,157 @@
+package goxtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhaoh94/gox"
+	"github.com/xhaoh94/gox/engine/network/protoreg"
+	"github.com/xhaoh94/gox/engine/types"
+)
+
+type (
+	PeerRequire  struct{}
+	PeerResponse struct {
+		CommonName string
+	}
+
+	//testCA 测试用的CA，签发节点证书
+	testCA struct {
+		dir  string
+		key  *ecdsa.PrivateKey
+		cert *x509.Certificate
+		file string
+	}
+)
+
+func init() {
+	//接收方返回连接的对端证书
+	protoreg.RegisterRpc(func(ctx context.Context, session types.ISession, req *PeerRequire) (*PeerResponse, error) {
+		return &PeerResponse{CommonName: session.PeerIdentity().CommonName}, nil
+	})
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gox test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{dir: t.TempDir(), key: key, cert: cert}
+	ca.file = ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(t *testing.T, name string, typ string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// issue 签发节点证书，同时用于服务端和客户端
+func (ca *testCA) issue(t *testing.T, commonName string) gox.TlsConf {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gox.TlsConf{
+		CertFile:     ca.write(t, commonName+".pem", "CERTIFICATE", der),
+		KeyFile:      ca.write(t, commonName+".key", "EC PRIVATE KEY", keyDer),
+		CAFile:       ca.file,
+		Mutual:       true,
+		VerifyEntity: true,
+	}
+}
+
+func TestTlsVerifyEntity(t *testing.T) {
+	ca := newTestCA(t)
+	withTls := func(tlsConf gox.TlsConf) func(conf *gox.AppConf) {
+		return func(conf *gox.AppConf) {
+			conf.Network.Interior.Tls = tlsConf
+		}
+	}
+	tests := []struct {
+		name string
+		//节点2证书的名字
+		commonName string
+		ok         bool
+	}{
+		{"证书是注册的服务", "scene-2", true},
+		{"证书是其他服务", "scene-3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := NewCluster(t,
+				NodeConf{AppID: 1, AppType: "gate", Setup: withTls(ca.issue(t, "gate-1"))},
+				NodeConf{AppID: 2, AppType: "scene", Setup: withTls(ca.issue(t, tt.commonName))},
+			)
+			cluster.Start()
+			session := cluster.Node(1).NetWork.GetSessionByAppID(2)
+			if !tt.ok {
+				if session != nil {
+					t.Fatalf("证书[%s]不应该连接成功", tt.commonName)
+				}
+				return
+			}
+			if session == nil {
+				t.Fatal("没有连接到节点2")
+			}
+			if cn := session.PeerIdentity().CommonName; cn != tt.commonName {
+				t.Errorf("连接方看到的证书 = %s, 应为 %s", cn, tt.commonName)
+			}
+			response := &PeerResponse{}
+			if err := session.Call(&PeerRequire{}, response); err != nil {
+				t.Fatal(err)
+			}
+			if response.CommonName != "gate-1" {
+				t.Errorf("接收方看到的证书 = %s, 应为 gate-1", response.CommonName)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package gox
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 
+	"github.com/xhaoh94/gox/engine/logger"
 	"github.com/xhaoh94/gox/engine/types"
 )
 
@@ -12,16 +18,20 @@ type (
 		childModules []types.IModule
 		lock         sync.Mutex
 	}
+	moduleTree interface {
+		modules() []types.IModule
+	}
 )
 
-// Init 初始化模块
+// Init 初始化模块，子模块按依赖顺序初始化
 func (m *Module) Init(self types.IModule) {
 	self.OnInit()
-	if m.childModules != nil {
-		for i := range m.childModules {
-			v := m.childModules[i]
-			v.Init(v)
-		}
+	if err := m.sortModules(); err != nil {
+		logger.Fatal().Err(err).Str("Module", ModuleName(self)).Msg("模块依赖错误")
+		return
+	}
+	for _, v := range m.modules() {
+		v.Init(v)
 	}
 }
 
@@ -30,13 +40,11 @@ func (mm *Module) OnInit() {
 
 }
 
+// Start 启动模块，子模块按依赖顺序启动
 func (m *Module) Start(self types.IModule) {
 	self.OnStart()
-	if m.childModules != nil {
-		for i := range m.childModules {
-			v := m.childModules[i]
-			v.Start(v)
-		}
+	for _, v := range m.modules() {
+		v.Start(v)
 	}
 }
 
@@ -45,10 +53,23 @@ func (mm *Module) OnStart() {
 
 }
 
-// Destroy 销毁模块
+// Drain 关闭前排空，子模块按依赖逆序先于自身
+func (m *Module) Drain(self types.IModule, ctx context.Context) {
+	list := m.modules()
+	for i := len(list) - 1; i >= 0; i-- {
+		v := list[i]
+		v.Drain(v, ctx)
+	}
+	if drain, ok := self.(types.IModuleDrain); ok {
+		drain.OnDrain(ctx)
+	}
+}
+
+// Destroy 销毁模块，子模块按依赖逆序销毁
 func (m *Module) Destroy(self types.IModule) {
-	for i := range m.childModules {
-		v := m.childModules[i]
+	list := m.modules()
+	for i := len(list) - 1; i >= 0; i-- {
+		v := list[i]
 		v.Destroy(v)
 	}
 	self.OnDestroy()
@@ -68,3 +89,111 @@ func (m *Module) Put(mod types.IModule) {
 	}
 	m.childModules = append(m.childModules, mod)
 }
+
+// GetModule 通过模块名获取子模块(包括子模块的子模块)
+func (m *Module) GetModule(name string) types.IModule {
+	var result types.IModule
+	for _, v := range m.modules() {
+		walkModules(v, func(mod types.IModule) bool {
+			if ModuleName(mod) == name {
+				result = mod
+				return false
+			}
+			return true
+		})
+		if result != nil {
+			break
+		}
+	}
+	return result
+}
+
+func (m *Module) modules() []types.IModule {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	return append([]types.IModule(nil), m.childModules...)
+}
+
+// sortModules 按依赖拓扑排序子模块，存在循环依赖或缺失依赖时返回错误
+func (m *Module) sortModules() error {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+	if len(m.childModules) == 0 {
+		return nil
+	}
+	var errs []error
+	nameToModule := make(map[string]types.IModule, len(m.childModules))
+	for _, v := range m.childModules {
+		name := ModuleName(v)
+		if _, ok := nameToModule[name]; ok {
+			errs = append(errs, fmt.Errorf("模块[%s]重复添加", name))
+			continue
+		}
+		nameToModule[name] = v
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(m.childModules))
+	sorted := make([]types.IModule, 0, len(m.childModules))
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case visited:
+			return
+		case visiting:
+			errs = append(errs, fmt.Errorf("模块循环依赖[%s]", strings.Join(append(path, name), "->")))
+			return
+		}
+		state[name] = visiting
+		mod := nameToModule[name]
+		if depend, ok := mod.(types.IModuleDepend); ok {
+			for _, dep := range depend.Depends() {
+				if _, ok := nameToModule[dep]; !ok {
+					errs = append(errs, fmt.Errorf("模块[%s]依赖的模块[%s]不存在", name, dep))
+					continue
+				}
+				visit(dep, append(path, name))
+			}
+		}
+		state[name] = visited
+		sorted = append(sorted, mod)
+	}
+	for _, v := range m.childModules {
+		visit(ModuleName(v), nil)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	m.childModules = sorted
+	return nil
+}
+
+// ModuleName 获取模块名，实现了IModuleName的模块使用自定义名字，否则为结构体名
+func ModuleName(mod types.IModule) string {
+	if named, ok := mod.(types.IModuleName); ok {
+		return named.ModuleName()
+	}
+	t := reflect.TypeOf(mod)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// walkModules 深度遍历模块树，fn返回false时停止
+func walkModules(mod types.IModule, fn func(types.IModule) bool) bool {
+	if !fn(mod) {
+		return false
+	}
+	if tree, ok := mod.(moduleTree); ok {
+		for _, v := range tree.modules() {
+			if !walkModules(v, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
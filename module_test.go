@@ -0,0 +1,68 @@
+package gox
+
+import (
+	"strings"
+	"testing"
+)
+
+type testModule struct {
+	Module
+	name    string
+	depends []string
+}
+
+func (mod *testModule) ModuleName() string { return mod.name }
+func (mod *testModule) Depends() []string  { return mod.depends }
+
+func TestSortModules(t *testing.T) {
+	tests := []struct {
+		name string
+		//模块名:依赖，按添加顺序
+		modules []string
+		order   string
+		errs    []string
+	}{
+		{"没有依赖保持添加顺序", []string{"a", "b", "c"}, "a,b,c", nil},
+		{"链式依赖", []string{"a:b", "b:c", "c"}, "c,b,a", nil},
+		{"菱形依赖", []string{"d:b,c", "b:a", "c:a", "a"}, "a,b,c,d", nil},
+		{"循环依赖", []string{"a:b", "b:c", "c:a"}, "", []string{"模块循环依赖[a->b->c->a]"}},
+		{"缺失依赖", []string{"a:x", "b"}, "", []string{"模块[a]依赖的模块[x]不存在"}},
+		{"重复添加", []string{"a", "b", "a"}, "", []string{"模块[a]重复添加"}},
+		{"多个错误", []string{"a:x", "a", "b:b"}, "", []string{"模块[a]依赖的模块[x]不存在", "模块[a]重复添加", "模块循环依赖[b->b]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &Module{}
+			for _, v := range tt.modules {
+				name, deps, _ := strings.Cut(v, ":")
+				mod := &testModule{name: name}
+				if deps != "" {
+					mod.depends = strings.Split(deps, ",")
+				}
+				root.Put(mod)
+			}
+			err := root.sortModules()
+			if len(tt.errs) > 0 {
+				if err == nil {
+					t.Fatal("应返回错误")
+				}
+				for _, want := range tt.errs {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("err = %v, 应包含 %s", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var order []string
+			for _, mod := range root.modules() {
+				order = append(order, ModuleName(mod))
+			}
+			if got := strings.Join(order, ","); got != tt.order {
+				t.Errorf("顺序 = %s, 应为 %s", got, tt.order)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/xhaoh94/gox/engine/app"
+	"github.com/xhaoh94/gox/engine/logger"
+)
+
+var (
+	//支持热更新的配置项，其余配置项变化会被拒绝
+	reloadableFields = map[string]bool{
+		"Network":         true,
+		"LogConfPath":     true,
+		"ShutdownTimeout": true,
+		"ReloadInterval":  true,
+	}
+)
+
+// watchConf 监听配置文件变化和SIGHUP信号，触发热更新
+func (a *App) watchConf(ctx context.Context) {
+	defer app.Recover()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	modTimes := a.confModTimes()
+	for {
+		var tick <-chan time.Time
+		if interval := a.Conf().ReloadInterval; interval > 0 {
+			tick = time.After(time.Duration(interval) * time.Second)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+			logger.Info().Msg("收到SIGHUP，重新加载配置")
+		case <-tick:
+			latest := a.confModTimes()
+			if reflect.DeepEqual(latest, modTimes) {
+				continue
+			}
+			logger.Info().Msg("配置文件发生变化，重新加载配置")
+		}
+		modTimes = a.confModTimes()
+		if err := a.Reload(); err != nil {
+			logger.Error().Err(err).Str("Path", a.confPath).Msg("配置热更新失败")
+		}
+	}
+}
+
+// confModTimes 获取配置文件和日志配置文件的修改时间
+func (a *App) confModTimes() []time.Time {
+	paths := []string{a.confPath, a.Conf().LogConfPath}
+	times := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// Reload 重新加载默认App的配置
+func Reload() error {
+	return Default.Reload()
+}
+
+// Reload 重新加载配置，只应用支持热更新的配置项，并派发EventConfigChange事件
+func (a *App) Reload() error {
+	if a.confPath == "" {
+		return errors.New("没有配置文件路径")
+	}
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+	parsed, err := loadConf(a.confPath)
+	if err != nil {
+		return err
+	}
+	old := *a.Conf()
+	next := mergeReloadable(old, parsed)
+	if err := logger.Init(next.LogConfPath, next.Development); err != nil {
+		return err
+	}
+	//整体替换，读取中的协程继续使用旧的配置
+	a.conf.Store(&next)
+	logger.Info().Msg("配置热更新成功")
+	a.Event.Run(EventConfigChange, ConfigChange{Old: old, New: next})
+	return nil
+}
+
+// mergeReloadable 把新配置中支持热更新的配置项合并到当前配置，拒绝其余变化
+func mergeReloadable(cur AppConf, parsed AppConf) AppConf {
+	next := cur
+	curValue := reflect.ValueOf(cur)
+	parsedValue := reflect.ValueOf(parsed)
+	nextValue := reflect.ValueOf(&next).Elem()
+	t := curValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if reflect.DeepEqual(curValue.Field(i).Interface(), parsedValue.Field(i).Interface()) {
+			continue
+		}
+		if !reloadableFields[name] {
+			logger.Error().Str("Field", t.Field(i).Tag.Get("yaml")).Msg("配置项不支持热更新，已忽略")
+			continue
+		}
+		nextValue.Field(i).Set(parsedValue.Field(i))
+	}
+	//影响已有连接编解码的网络配置
+	if cur.Network.Endian != parsed.Network.Endian {
+		logger.Error().Str("Field", "network.endian").Msg("配置项不支持热更新，已忽略")
+		next.Network.Endian = cur.Network.Endian
+	}
+	if cur.Network.FrameHeader != parsed.Network.FrameHeader {
+		logger.Error().Str("Field", "network.frame_header").Msg("配置项不支持热更新，已忽略")
+		next.Network.FrameHeader = cur.Network.FrameHeader
+	}
+	if cur.Network.Compress != parsed.Network.Compress {
+		logger.Error().Str("Field", "network.compress").Msg("配置项不支持热更新，已忽略")
+		next.Network.Compress = cur.Network.Compress
+	}
+	if cur.Network.Dispatch != parsed.Network.Dispatch {
+		logger.Error().Str("Field", "network.dispatch").Msg("配置项不支持热更新，已忽略")
+		next.Network.Dispatch = cur.Network.Dispatch
+	}
+	if cur.Network.Interior != parsed.Network.Interior {
+		logger.Error().Str("Field", "network.interior").Msg("配置项不支持热更新，已忽略")
+		next.Network.Interior = cur.Network.Interior
+	}
+	if cur.Network.Outside != parsed.Network.Outside {
+		logger.Error().Str("Field", "network.outside").Msg("配置项不支持热更新，已忽略")
+		next.Network.Outside = cur.Network.Outside
+	}
+	return next
+}
@@ -0,0 +1,142 @@
+package gox
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeReloadable(t *testing.T) {
+	cur := AppConf{
+		AppID:           1,
+		AppType:         "gate",
+		OutsideAddr:     "127.0.0.1:10002",
+		ShutdownTimeout: 10,
+		Network: NetworkConf{
+			Endian:      binary.LittleEndian,
+			FrameHeader: FrameHeaderUint16,
+			Compress:    "flate",
+			Dispatch:    DispatchInline,
+			Heartbeat:   30 * time.Second,
+			Outside:     ServiceConf{Encrypt: true},
+		},
+	}
+	tests := []struct {
+		name   string
+		change func(conf *AppConf)
+		want   func(conf *AppConf)
+	}{
+		{"没有变化", func(conf *AppConf) {}, func(conf *AppConf) {}},
+		{"热更新项", func(conf *AppConf) {
+			conf.ShutdownTimeout = 20
+			conf.ReloadInterval = 5
+			conf.LogConfPath = "log.yaml"
+			conf.Network.Heartbeat = 10 * time.Second
+			conf.Network.RpcTimeout = 5 * time.Second
+		}, func(conf *AppConf) {
+			conf.ShutdownTimeout = 20
+			conf.ReloadInterval = 5
+			conf.LogConfPath = "log.yaml"
+			conf.Network.Heartbeat = 10 * time.Second
+			conf.Network.RpcTimeout = 5 * time.Second
+		}},
+		{"不支持的配置项恢复", func(conf *AppConf) {
+			conf.AppID = 2
+			conf.AppType = "login"
+			conf.OutsideAddr = "127.0.0.1:20002"
+			conf.FrameRate = 60
+		}, func(conf *AppConf) {}},
+		{"不支持的网络配置恢复", func(conf *AppConf) {
+			conf.Network.Endian = binary.BigEndian
+			conf.Network.FrameHeader = FrameHeaderVarint
+			conf.Network.Compress = "gzip"
+			conf.Network.Dispatch = DispatchPool
+			conf.Network.Interior = ServiceConf{Encrypt: true}
+			conf.Network.Outside = ServiceConf{}
+		}, func(conf *AppConf) {}},
+		{"同时变化只应用热更新项", func(conf *AppConf) {
+			conf.AppID = 2
+			conf.Network.Endian = binary.BigEndian
+			conf.Network.Heartbeat = 10 * time.Second
+		}, func(conf *AppConf) {
+			conf.Network.Heartbeat = 10 * time.Second
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, want := cur, cur
+			tt.change(&parsed)
+			tt.want(&want)
+			next := mergeReloadable(cur, parsed)
+			if next.AppID != want.AppID || next.AppType != want.AppType || next.OutsideAddr != want.OutsideAddr || next.FrameRate != want.FrameRate {
+				t.Errorf("基础配置 = %+v, 应为 %+v", next, want)
+			}
+			if next.ShutdownTimeout != want.ShutdownTimeout || next.ReloadInterval != want.ReloadInterval || next.LogConfPath != want.LogConfPath {
+				t.Errorf("热更新项 = %+v, 应为 %+v", next, want)
+			}
+			if next.Network != want.Network {
+				t.Errorf("network = %+v, 应为 %+v", next.Network, want.Network)
+			}
+		})
+	}
+}
+
+func TestReloadPublishesConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	write := func(appType string, heartbeat int) {
+		data := "app_id: 1\napp_type: " + appType + "\ninterioraddr: \"127.0.0.1:10001\"\nnetwork:\n    heartbeat: " + strconv.Itoa(heartbeat) + "\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("gate", 30)
+	a := NewApp()
+	if err := a.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	held := a.Conf()
+	if held.Network.Heartbeat != 30*time.Second {
+		t.Fatalf("heartbeat = %v", held.Network.Heartbeat)
+	}
+
+	//热更新期间读取配置的协程
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = a.Conf().Network.GetRpcTimeout()
+			}
+		}
+	}()
+	write("login", 10)
+	err := a.Reload()
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := a.Conf()
+	if conf.Network.Heartbeat != 10*time.Second {
+		t.Errorf("heartbeat = %v, 应为 10s", conf.Network.Heartbeat)
+	}
+	if conf.AppType != "gate" {
+		t.Errorf("app_type = %s, 不支持热更新应为 gate", conf.AppType)
+	}
+	if held.Network.Heartbeat != 30*time.Second {
+		t.Errorf("热更新修改了旧的配置 heartbeat = %v", held.Network.Heartbeat)
+	}
+	if a.Config.Network.Heartbeat != 30*time.Second {
+		t.Errorf("热更新修改了启动时的配置 heartbeat = %v", a.Config.Network.Heartbeat)
+	}
+}
@@ -0,0 +1,73 @@
+package gox
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Enabled 是否开启TLS
+func (conf TlsConf) Enabled() bool {
+	return conf.CertFile != "" || conf.CAFile != ""
+}
+
+// ServerConfig 监听使用的TLS配置
+func (conf TlsConf) ServerConfig() (*tls.Config, error) {
+	if conf.CertFile == "" {
+		return nil, errors.New("tls: 监听需要配置certfile和keyfile")
+	}
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: 加载证书失败 %w", err)
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.Mutual {
+		pool, err := conf.caPool()
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.ClientCAs = pool
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConf, nil
+}
+
+// ClientConfig 连接使用的TLS配置，配置了证书时同时作为客户端证书
+func (conf TlsConf) ClientConfig() (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		ServerName: conf.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if conf.CAFile != "" {
+		pool, err := conf.caPool()
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.RootCAs = pool
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: 加载证书失败 %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
+
+func (conf TlsConf) caPool() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(conf.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: 读取CA失败 %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: CA文件[%s]没有有效的证书", conf.CAFile)
+	}
+	return pool, nil
+}